@@ -0,0 +1,148 @@
+package traefik_plugin_blockip
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminTokenHeader carries the token authenticating admin requests
+const adminTokenHeader = "X-Admin-Token"
+
+// ruleTemporaryUnblock identifies decisions made by an unblock override
+const ruleTemporaryUnblock = "temporary-unblock"
+
+// isAdminRequest checks if the request targets the admin endpoint
+func (b *BlockIP) isAdminRequest(req *http.Request) bool {
+	return b.adminPath != "" && strings.HasPrefix(req.URL.Path, b.adminPath+"/")
+}
+
+// hasAdminToken reports whether req carries the admin token, either in
+// the X-Admin-Token header or as a bearer token for Prometheus scrapers
+func (b *BlockIP) hasAdminToken(req *http.Request) bool {
+	token := req.Header.Get(adminTokenHeader)
+	if token == "" {
+		token = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	}
+	return b.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(b.adminToken)) == 1
+}
+
+// serveAdmin handles admin endpoint requests
+func (b *BlockIP) serveAdmin(rw http.ResponseWriter, req *http.Request) {
+	if !b.hasAdminToken(req) {
+		writeJSON(rw, http.StatusUnauthorized, map[string]string{"error": "invalid admin token"})
+		return
+	}
+
+	switch strings.TrimPrefix(req.URL.Path, b.adminPath) {
+	case "/unblock":
+		b.serveUnblock(rw, req)
+	case "/client-ip":
+		b.serveClientIP(rw, req)
+	case "/stats":
+		writeJSON(rw, http.StatusOK, b.Stats())
+	default:
+		writeJSON(rw, http.StatusNotFound, map[string]string{"error": "unknown admin action"})
+	}
+}
+
+// serveUnblock temporarily unblocks an IP. The duration accepts a Go
+// duration string or a number of seconds.
+func (b *BlockIP) serveUnblock(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		writeJSON(rw, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	ip := strings.TrimSpace(req.FormValue("ip"))
+	if !isValidIP(ip) {
+		writeJSON(rw, http.StatusBadRequest, map[string]string{"error": "invalid ip"})
+		return
+	}
+
+	ip = canonicalIP(ip)
+
+	duration, err := parseAdminDuration(req.FormValue("duration"))
+	if err != nil || duration <= 0 {
+		writeJSON(rw, http.StatusBadRequest, map[string]string{"error": "invalid duration"})
+		return
+	}
+
+	expires := time.Now().Add(duration)
+	b.lookup.addUnblock(ip, expires)
+
+	if b.debug {
+		b.logger.Debug("[%s] Temporarily unblocked IP %s until %s", b.name, ip, expires.Format(time.RFC3339))
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]string{
+		"ip":      ip,
+		"expires": expires.UTC().Format(time.RFC3339),
+	})
+}
+
+// serveClientIP reports the client IP that would be used for the request
+// and the source it came from, without making a block decision
+func (b *BlockIP) serveClientIP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		rw.Header().Set("Allow", http.MethodGet)
+		writeJSON(rw, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	ip, source := b.clientIPSource(req)
+	writeJSON(rw, http.StatusOK, map[string]string{
+		"ip":     ip,
+		"source": source,
+	})
+}
+
+// parseAdminDuration parses a duration string or a number of seconds
+func parseAdminDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// addUnblock overrides list membership for ip until expires
+func (s *ipLookupService) addUnblock(ip string, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unblocks[ip] = expires.UnixNano()
+}
+
+// isUnblocked checks for an active unblock override, purging it once expired
+func (s *ipLookupService) isUnblocked(ip string) bool {
+	s.mu.RLock()
+	expires, ok := s.unblocks[ip]
+	s.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	if time.Now().UnixNano() < expires {
+		return true
+	}
+
+	s.mu.Lock()
+	if s.unblocks[ip] == expires {
+		delete(s.unblocks, ip)
+	}
+	s.mu.Unlock()
+	return false
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
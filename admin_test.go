@@ -0,0 +1,174 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAdminHandler(t *testing.T) http.Handler {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"203.0.113.0/24"}
+	config.AdminPath = "/_blockip"
+	config.AdminToken = "secret"
+	return newTestHandler(t, config)
+}
+
+func unblockRequest(ip, duration, token string) *http.Request {
+	form := url.Values{"ip": {ip}, "duration": {duration}}
+	req := httptest.NewRequest("POST", "/_blockip/unblock", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Admin-Token", token)
+	req.RemoteAddr = "10.0.0.1:12345"
+	return req
+}
+
+func TestAdminTemporaryUnblock(t *testing.T) {
+	handler := newAdminHandler(t)
+
+	if code := requestFrom(handler, "203.0.113.5:12345"); code != 403 {
+		t.Fatalf("Expected listed IP to be blocked, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, unblockRequest("203.0.113.5", "100ms", "secret"))
+	if w.Code != 200 {
+		t.Fatalf("Expected unblock to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if code := requestFrom(handler, "203.0.113.5:12345"); code != 200 {
+		t.Errorf("Expected unblocked IP to be allowed, got %d", code)
+	}
+	if code := requestFrom(handler, "203.0.113.6:12345"); code != 403 {
+		t.Errorf("Expected other listed IP to stay blocked, got %d", code)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if code := requestFrom(handler, "203.0.113.5:12345"); code != 403 {
+		t.Errorf("Expected IP to be blocked again after cooldown, got %d", code)
+	}
+}
+
+func TestAdminUnblockRejected(t *testing.T) {
+	handler := newAdminHandler(t)
+
+	tests := []struct {
+		req      *http.Request
+		expected int
+		testName string
+	}{
+		{unblockRequest("203.0.113.5", "60", "wrong"), 401, "Wrong token"},
+		{unblockRequest("203.0.113.5", "60", ""), 401, "Missing token"},
+		{unblockRequest("not-an-ip", "60", "secret"), 400, "Invalid IP"},
+		{unblockRequest("203.0.113.5", "forever", "secret"), 400, "Invalid duration"},
+		{unblockRequest("203.0.113.5", "-5", "secret"), 400, "Negative duration"},
+	}
+
+	get := httptest.NewRequest("GET", "/_blockip/unblock?ip=203.0.113.5&duration=60", nil)
+	get.Header.Set("X-Admin-Token", "secret")
+	tests = append(tests, struct {
+		req      *http.Request
+		expected int
+		testName string
+	}{get, 405, "Wrong method"})
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, test.req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+
+	if code := requestFrom(handler, "203.0.113.5:12345"); code != 403 {
+		t.Errorf("Expected IP to remain blocked after rejected requests, got %d", code)
+	}
+}
+
+func TestAdminPathRequiresToken(t *testing.T) {
+	config := CreateConfig()
+	config.AdminPath = "/_blockip"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for admin path without token")
+	}
+}
+
+func TestAdminClientIP(t *testing.T) {
+	handler := newAdminHandler(t)
+
+	tests := []struct {
+		remoteAddr     string
+		headers        map[string]string
+		expectedIP     string
+		expectedSource string
+		testName       string
+	}{
+		{"203.0.113.5:12345", nil, "203.0.113.5", "RemoteAddr", "RemoteAddr only"},
+		{"10.0.0.1:12345", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.1"}, "198.51.100.1", "X-Forwarded-For", "X-Forwarded-For"},
+		{"10.0.0.1:12345", map[string]string{"X-Forwarded-For": "garbage", "X-Real-IP": "198.51.100.2"}, "198.51.100.2", "X-Real-IP", "Invalid X-Forwarded-For skipped"},
+		{"10.0.0.1:12345", map[string]string{"CF-Connecting-IP": "2001:db8::1"}, "2001:db8::1", "CF-Connecting-IP", "CF-Connecting-IP"},
+		{"invalid", nil, "", "", "No usable source"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/_blockip/client-ip", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set("X-Admin-Token", "secret")
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != 200 {
+			t.Errorf("%s: expected 200, got %d", test.testName, w.Code)
+			continue
+		}
+
+		var body map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Errorf("%s: invalid JSON response: %v", test.testName, err)
+			continue
+		}
+		if body["ip"] != test.expectedIP || body["source"] != test.expectedSource {
+			t.Errorf("%s: expected %s from %s, got %s from %s",
+				test.testName, test.expectedIP, test.expectedSource, body["ip"], body["source"])
+		}
+	}
+}
+
+func TestAdminClientIPNoDecision(t *testing.T) {
+	handler := newAdminHandler(t)
+
+	req := httptest.NewRequest("GET", "/_blockip/client-ip", nil)
+	req.RemoteAddr = "203.0.113.5:12345"
+	req.Header.Set("X-Admin-Token", "secret")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 200 {
+		t.Errorf("Expected blocked client to get the extraction result, got %d", w.Code)
+	}
+
+	req.Header.Set("X-Admin-Token", "wrong")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 401 {
+		t.Errorf("Expected 401 without a valid admin token, got %d", w.Code)
+	}
+}
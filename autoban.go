@@ -0,0 +1,102 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// autoBanner counts blocked attempts per IP and reports IPs exceeding the
+// threshold within the window, which are then temporarily blocked
+type autoBanner struct {
+	mu        sync.Mutex
+	attempts  map[string][]int64 // unix nanos of recent blocked attempts
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+}
+
+// newAutoBanner validates the auto-ban settings
+func newAutoBanner(threshold int, window, duration time.Duration) (*autoBanner, error) {
+	if threshold < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("autoBanThreshold must not be negative, got %d", threshold), nil)
+	}
+	if window <= 0 || duration <= 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "autoBanWindow and autoBanDuration must be positive when autoBanThreshold is set", nil)
+	}
+	return &autoBanner{
+		attempts:  make(map[string][]int64),
+		threshold: threshold,
+		window:    window,
+		duration:  duration,
+	}, nil
+}
+
+// record counts a blocked attempt of ip at now and reports whether ip
+// exceeded the threshold, resetting its count when it did
+func (a *autoBanner) record(ip string, now time.Time) bool {
+	cutoff := now.Add(-a.window).UnixNano()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	attempts := a.attempts[ip]
+	for len(attempts) > 0 && attempts[0] <= cutoff {
+		attempts = attempts[1:]
+	}
+	attempts = append(attempts, now.UnixNano())
+
+	if len(attempts) > a.threshold {
+		delete(a.attempts, ip)
+		return true
+	}
+	a.attempts[ip] = attempts
+	return false
+}
+
+// purge forgets IPs without attempts within the window
+func (a *autoBanner) purge(now time.Time) {
+	cutoff := now.Add(-a.window).UnixNano()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for ip, attempts := range a.attempts {
+		if attempts[len(attempts)-1] <= cutoff {
+			delete(a.attempts, ip)
+		}
+	}
+}
+
+// countBlockedAttempt records a blocked attempt of clientIP and bans it
+// temporarily once it crosses the auto-ban threshold
+func (b *BlockIP) countBlockedAttempt(clientIP string, d decision) {
+	if d.rule == ruleTemporaryBlock || !b.autoBan.record(clientIP, time.Now()) {
+		return
+	}
+
+	if err := b.AddTemporaryBlock(clientIP, b.autoBan.duration); err != nil {
+		b.logger.Warn("[%s] Error auto-banning IP %s: %v", b.name, clientIP, err)
+		return
+	}
+	b.stats.autoBans.Add(1)
+	b.logger.Info("[%s] Auto-banned IP %s for %s after more than %d blocked attempts within %s",
+		b.name, clientIP, b.autoBan.duration, b.autoBan.threshold, b.autoBan.window)
+}
+
+// sweepAttempts periodically forgets the stale attempt counts of a until
+// ctx is done
+func sweepAttempts(ctx context.Context, a *autoBanner) {
+	ticker := time.NewTicker(a.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.purge(now)
+		}
+	}
+}
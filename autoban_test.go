@@ -0,0 +1,93 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newAutoBanHandler(t *testing.T, threshold int, window string) *BlockIP {
+	config := CreateConfig()
+	config.WhitelistIPs = []string{"203.0.113.9"}
+	config.PathRules = []PathRule{{Paths: []string{"/admin"}, BlockedCIDRs: []string{"203.0.113.0/24"}}}
+	config.AutoBanThreshold = threshold
+	config.AutoBanWindowDuration = window
+	return newTestHandler(t, config)
+}
+
+func TestAutoBan(t *testing.T) {
+	b := newAutoBanHandler(t, 3, "1m")
+
+	for i := 0; i < 3; i++ {
+		if code := requestPath(b, "203.0.113.5:12345", "/admin"); code != 403 {
+			t.Fatalf("Attempt %d: expected blocked path, got %d", i+1, code)
+		}
+	}
+	if code := requestPath(b, "203.0.113.5:12345", "/public"); code != 200 {
+		t.Errorf("Expected IP to be allowed elsewhere at the threshold, got %d", code)
+	}
+
+	requestPath(b, "203.0.113.5:12345", "/admin")
+	if code := requestPath(b, "203.0.113.5:12345", "/public"); code != 403 {
+		t.Errorf("Expected IP to be banned after crossing the threshold, got %d", code)
+	}
+	if code := requestPath(b, "203.0.113.6:12345", "/public"); code != 200 {
+		t.Errorf("Expected other IPs to be unaffected, got %d", code)
+	}
+	if bans := b.Stats()["auto_bans"]; bans != 1 {
+		t.Errorf("Expected 1 auto-ban, got %d", bans)
+	}
+
+	// Requests rejected by the ban itself do not ban again
+	requestPath(b, "203.0.113.5:12345", "/public")
+	if bans := b.Stats()["auto_bans"]; bans != 1 {
+		t.Errorf("Expected banned requests not to count, got %d auto-bans", bans)
+	}
+}
+
+func TestAutoBanWindow(t *testing.T) {
+	b := newAutoBanHandler(t, 2, "50ms")
+
+	for i := 0; i < 4; i++ {
+		requestPath(b, "203.0.113.5:12345", "/admin")
+		time.Sleep(30 * time.Millisecond)
+	}
+	if code := requestPath(b, "203.0.113.5:12345", "/public"); code != 200 {
+		t.Errorf("Expected attempts spread beyond the window not to ban, got %d", code)
+	}
+
+	for i := 0; i < 3; i++ {
+		requestPath(b, "203.0.113.5:12345", "/admin")
+	}
+	if code := requestPath(b, "203.0.113.5:12345", "/public"); code != 403 {
+		t.Errorf("Expected attempts within the window to ban, got %d", code)
+	}
+}
+
+func TestAutoBanConfig(t *testing.T) {
+	tests := []struct {
+		threshold int
+		window    int
+		duration  int
+		testName  string
+	}{
+		{-1, 60, 3600, "Negative threshold"},
+		{3, 0, 3600, "Zero window"},
+		{3, 60, 0, "Zero duration"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.AutoBanThreshold = test.threshold
+		config.AutoBanWindow = test.window
+		config.AutoBanDuration = test.duration
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", test.testName)
+		}
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -277,6 +280,57 @@ func TestWhitelistCIDR(t *testing.T) {
 	}
 }
 
+func TestAllowInternalOrchestrationNets(t *testing.T) {
+	tests := []struct {
+		enabled    bool
+		nets       []string
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{true, nil, "172.17.0.5:12345", 200, "Docker bridge IP allowed"},
+		{true, nil, "10.244.3.7:12345", 200, "Kubernetes pod IP allowed"},
+		{true, nil, "10.1.0.1:12345", 403, "Other blocked IP stays blocked"},
+		{false, nil, "172.17.0.5:12345", 403, "Disabled by default"},
+		{true, []string{"10.1.0.0/16"}, "10.1.0.1:12345", 200, "Overridden range allowed"},
+		{true, []string{"10.1.0.0/16"}, "172.17.0.5:12345", 403, "Default range replaced by override"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedCIDRs = []string{"10.0.0.0/8", "172.16.0.0/12"}
+		config.AllowInternalOrchestrationNets = test.enabled
+		if test.nets != nil {
+			config.OrchestrationNets = test.nets
+		}
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestInvalidOrchestrationNets(t *testing.T) {
+	config := CreateConfig()
+	config.AllowInternalOrchestrationNets = true
+	config.OrchestrationNets = []string{"10.0.0.0/33"}
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid orchestration network")
+	}
+}
+
 func TestIPv6Blocking(t *testing.T) {
 	config := CreateConfig()
 	config.BlockedCIDRs = []string{"2001:db8::/32"}
@@ -341,6 +395,96 @@ func TestEmptyClientIP(t *testing.T) {
 	}
 }
 
+func TestRemoteAddrWithoutPort(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		action     string
+		expected   int
+		testName   string
+	}{
+		{"192.168.1.100", "", 403, "Bare IPv4"},
+		{"2001:db8::1", "", 403, "Bare IPv6"},
+		{"[2001:db8::1]", "", 403, "Bracketed IPv6 without port"},
+		{"192.168.1.50", "", 200, "Bare allowed IPv4"},
+		{"not-an-address", "", 200, "Unparsable fails open by default"},
+		{"not-an-address", "allow", 200, "Unparsable with allow action"},
+		{"not-an-address", "block", 403, "Unparsable with block action"},
+		{"", "block", 403, "Empty RemoteAddr with block action"},
+		{"192.168.1.50", "block", 200, "Bare IP unaffected by block action"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100", "2001:db8::1"}
+		config.UnparsableClientIPAction = test.action
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestInvalidUnparsableClientIPAction(t *testing.T) {
+	config := CreateConfig()
+	config.UnparsableClientIPAction = "drop"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid unparsable client IP action")
+	}
+}
+
+func TestZonedLinkLocalWhitelist(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"fe00::/8"}
+	config.WhitelistCIDRs = []string{"fe80::/10"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		expected   int
+		testName   string
+	}{
+		{"[fe80::1%eth0]:12345", "", 200, "Zoned link-local RemoteAddr"},
+		{"fe80::1%eth0", "", 200, "Zoned link-local without port"},
+		{"[fe80::1%25en0]:12345", "", 200, "Percent-encoded zone"},
+		{"192.0.2.1:12345", "fe80::abcd%eth1", 200, "Zoned link-local in X-Forwarded-For"},
+		{"[fec0::1%eth0]:12345", "", 403, "Zoned address outside the whitelist"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.xff != "" {
+			req.Header.Set("X-Forwarded-For", test.xff)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
 func TestWhitelistPriority(t *testing.T) {
 	config := CreateConfig()
 	config.BlockedIPs = []string{"192.168.1.100"}
@@ -363,106 +507,1340 @@ func TestWhitelistPriority(t *testing.T) {
 	}
 }
 
-// Benchmarks
-func BenchmarkIPLookupDirect(b *testing.B) {
+func TestListGroupMessages(t *testing.T) {
 	config := CreateConfig()
-	config.BlockedIPs = make([]string, 100)
-	for i := 0; i < 100; i++ {
-		config.BlockedIPs[i] = fmt.Sprintf("192.168.%d.%d", i/256, i%256)
+	config.BlockedIPs = []string{"198.51.100.1"}
+	config.ListGroups = []ListGroup{
+		{Name: "spam", BlockedCIDRs: []string{"203.0.113.0/24"}, Message: "Spam source"},
+		{Name: "abuse", BlockedIPs: []string{"192.0.2.10"}, StatusCode: 451, Message: "Abuse report"},
 	}
 
-	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-	}), config, "blockip-bench")
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
 
-	req := httptest.NewRequest("GET", "/", nil)
-	req.RemoteAddr = "192.168.0.50:12345"
+	tests := []struct {
+		remoteAddr string
+		code       int
+		body       string
+		testName   string
+	}{
+		{"203.0.113.7:12345", 403, "Spam source", "Group message with global status"},
+		{"192.0.2.10:12345", 451, "Abuse report", "Group message and status"},
+		{"198.51.100.1:12345", 403, "Access Denied", "Global defaults"},
+	}
 
-	w := httptest.NewRecorder()
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
 		handler.ServeHTTP(w, req)
+
+		if w.Code != test.code {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.code, w.Code)
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("%s: expected body %q, got %q", test.testName, test.body, w.Body.String())
+		}
 	}
 }
 
-func BenchmarkCIDRLookup(b *testing.B) {
+func TestListGroupInvalidStatusCode(t *testing.T) {
 	config := CreateConfig()
-	config.BlockedCIDRs = []string{"192.168.0.0/16", "10.0.0.0/8", "172.16.0.0/12"}
+	config.ListGroups = []ListGroup{{Name: "bad", StatusCode: 200}}
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid list group status code")
+	}
+}
+
+func TestSkipTraefikInternalPaths(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.SkipTraefikInternalPaths = true
 
 	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-	}), config, "blockip-bench")
+	}), config, "blockip-test")
 
-	req := httptest.NewRequest("GET", "/", nil)
-	req.RemoteAddr = "192.168.1.50:12345"
+	tests := []struct {
+		path     string
+		expected int
+		testName string
+	}{
+		{"/ping", 200, "Ping bypasses block"},
+		{"/dashboard/", 200, "Dashboard bypasses block"},
+		{"/api/overview", 200, "API prefix bypasses block"},
+		{"/pingpong", 403, "Exact entry does not match as prefix"},
+		{"/app", 403, "Application path is blocked"},
+	}
 
-	w := httptest.NewRecorder()
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.RemoteAddr = "192.168.1.100:12345"
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
 		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
 	}
 }
 
-func BenchmarkCacheLookup(b *testing.B) {
+func TestSkipTraefikInternalPathsOverride(t *testing.T) {
 	config := CreateConfig()
 	config.BlockedIPs = []string{"192.168.1.100"}
-	config.CacheTTL = 3600
+	config.SkipTraefikInternalPaths = true
+	config.TraefikInternalPaths = []string{"/healthz"}
 
 	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-	}), config, "blockip-bench")
+	}), config, "blockip-test")
 
-	req := httptest.NewRequest("GET", "/", nil)
-	req.RemoteAddr = "192.168.1.50:12345"
+	for path, expected := range map[string]int{"/healthz": 200, "/ping": 403} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.168.1.100:12345"
 
-	w := httptest.NewRecorder()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
 
-	// Prime the cache
+		if w.Code != expected {
+			t.Errorf("Path %s: expected status %d, got %d", path, expected, w.Code)
+		}
+	}
+}
+
+func TestInternalPathsNotSkippedByDefault(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = "192.168.1.100:12345"
+
+	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		handler.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("Expected status 403 with skipping disabled, got %d", w.Code)
 	}
 }
 
-func BenchmarkWhitelistCheck(b *testing.B) {
+func TestDryRunFlagHeader(t *testing.T) {
 	config := CreateConfig()
 	config.BlockedCIDRs = []string{"192.168.0.0/16"}
-	config.WhitelistIPs = []string{"192.168.1.50"}
+	config.WhitelistIPs = []string{"192.168.1.1"}
+	config.DryRun = true
+	config.FlagHeader = "X-BlockIP-Flagged"
 
+	var flagged string
 	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flagged = r.Header.Get("X-BlockIP-Flagged")
 		w.WriteHeader(http.StatusOK)
-	}), config, "blockip-bench")
+	}), config, "blockip-test")
 
-	req := httptest.NewRequest("GET", "/", nil)
-	req.RemoteAddr = "192.168.1.50:12345"
+	tests := []struct {
+		remoteAddr string
+		flag       string
+		testName   string
+	}{
+		{"192.168.1.50:12345", "192.168.0.0/16", "Flagged allow"},
+		{"192.168.1.1:12345", "", "Whitelisted"},
+		{"10.0.0.1:12345", "", "Not matched"},
+	}
 
-	w := httptest.NewRecorder()
+	for _, test := range tests {
+		flagged = ""
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
 		handler.ServeHTTP(w, req)
+
+		if w.Code != 200 {
+			t.Errorf("%s: expected status 200 in dry run, got %d", test.testName, w.Code)
+		}
+		if flagged != test.flag {
+			t.Errorf("%s: expected flag header %q, got %q", test.testName, test.flag, flagged)
+		}
 	}
 }
 
-func BenchmarkHeaderExtraction(b *testing.B) {
+func TestFlagHeaderStrippedFromClients(t *testing.T) {
 	config := CreateConfig()
-	config.BlockedIPs = []string{"203.0.113.50"}
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WhitelistIPs = []string{"192.168.1.1"}
+	config.DryRun = true
+	config.FlagHeader = "X-BlockIP-Flagged"
 
+	var flagged []string
 	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flagged = r.Header.Values("X-BlockIP-Flagged")
 		w.WriteHeader(http.StatusOK)
-	}), config, "blockip-bench")
+	}), config, "blockip-test")
+
+	tests := []struct {
+		remoteAddr string
+		flag       string
+		testName   string
+	}{
+		{"192.168.1.100:12345", "192.168.1.100", "Flagged request overwrites the client value"},
+		{"192.168.1.1:12345", "", "Whitelisted request"},
+		{"10.0.0.1:12345", "", "Unflagged request"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Add("X-BlockIP-Flagged", "spoofed")
+		req.Header.Add("X-BlockIP-Flagged", "spoofed-again")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if strings.Join(flagged, ",") != test.flag {
+			t.Errorf("%s: expected flag header %q, got %q", test.testName, test.flag, flagged)
+		}
+	}
+}
+
+func TestDryRunWouldBlock(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.DryRun = true
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	if code := requestPath(b, "192.168.1.100:12345", "/login"); code != 200 {
+		t.Errorf("Expected blocked IP to receive 200 in dry run, got %d", code)
+	}
+	requestPath(b, "10.0.0.1:12345", "/")
+
+	logs := strings.Join(b.logger.GetLogs(0), "\n")
+	if !strings.Contains(logs, "WOULD BLOCK ip=192.168.1.100 path=/login rule=192.168.1.100") {
+		t.Errorf("Expected a WOULD BLOCK log line, got:\n%s", logs)
+	}
+	if strings.Contains(logs, "ip=10.0.0.1") {
+		t.Errorf("Expected no WOULD BLOCK line for allowed IPs, got:\n%s", logs)
+	}
+
+	metrics := b.Metrics()
+	if metrics["would_block_total"] != 1 || metrics["blocked_total"] != 1 {
+		t.Errorf("Expected 1 would-be block and 1 blocked decision, got %d and %d",
+			metrics["would_block_total"], metrics["blocked_total"])
+	}
+}
+
+func TestFlagHeaderIgnoredWhenEnforcing(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.FlagHeader = "X-BlockIP-Flagged"
+
+	called := false
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
 
 	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Set("X-Forwarded-For", "203.0.113.50, 192.168.1.1")
+	req.RemoteAddr = "192.168.1.100:12345"
 
 	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
+	if w.Code != 403 || called {
+		t.Errorf("Expected blocked request without reaching next, got %d (next called: %v)", w.Code, called)
+	}
+}
+
+func TestSanitizedIPInputs(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"[203.0.113.5]", `"198.51.100.7"`}
+	config.BlockedCIDRs = []string{"'192.0.2.0/24'"}
+	config.Debug = false
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	tests := []struct {
+		header   string
+		value    string
+		testName string
+	}{
+		{"X-Forwarded-For", "203.0.113.5", "Bracketed config entry"},
+		{"X-Forwarded-For", `"198.51.100.7"`, "Quoted header value"},
+		{"X-Real-IP", "[203.0.113.5]", "Bracketed header value"},
+		{"CF-Connecting-IP", "198.51.100.7.", "Trailing dot header value"},
+		{"X-Forwarded-For", "192.0.2.9", "Quoted CIDR entry"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set(test.header, test.value)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != 403 {
+			t.Errorf("%s: expected status 403, got %d", test.testName, w.Code)
+		}
+	}
+}
+
+func TestWWWAuthenticateOn401(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		configured string
+		expected   string
+		testName   string
+	}{
+		{401, `Bearer realm="api"`, `Bearer realm="api"`, "Configured challenge"},
+		{401, "", `Basic realm="Restricted"`, "Default challenge"},
+		{403, `Bearer realm="api"`, "", "Not sent for 403"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.StatusCode = test.statusCode
+		config.WWWAuthenticate = test.configured
+
+		handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+
+		w := httptest.NewRecorder()
 		handler.ServeHTTP(w, req)
+
+		if w.Code != test.statusCode {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.statusCode, w.Code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); got != test.expected {
+			t.Errorf("%s: expected WWW-Authenticate %q, got %q", test.testName, test.expected, got)
+		}
 	}
-}
\ No newline at end of file
+}
+
+func TestEmptyListsWarning(t *testing.T) {
+	tests := []struct {
+		warn     bool
+		blocked  []string
+		expected bool
+		testName string
+	}{
+		{true, nil, true, "Warns on empty lists"},
+		{false, nil, false, "Warning disabled"},
+		{true, []string{"192.168.1.100"}, false, "No warning with rules loaded"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = test.blocked
+		config.WarnOnEmptyLists = test.warn
+
+		var err error
+		output := captureStdout(t, func() {
+			_, err = New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), config, "blockip-test")
+		})
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+		}
+		if warned := strings.Contains(output, "No blocked IPs or CIDRs were loaded"); warned != test.expected {
+			t.Errorf("%s: expected warning %v, got output %q", test.testName, test.expected, output)
+		}
+	}
+}
+
+func TestEmptyListsError(t *testing.T) {
+	tests := []struct {
+		blocked     []string
+		expectError bool
+		testName    string
+	}{
+		{nil, true, "Empty lists"},
+		{[]string{"not-an-ip"}, true, "Only invalid entries"},
+		{[]string{"192.168.1.100"}, false, "Rules loaded"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = test.blocked
+		config.ErrorOnEmptyLists = true
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if test.expectError && err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+		}
+	}
+}
+
+func TestDefaultDeny(t *testing.T) {
+	config := CreateConfig()
+	config.DefaultAction = "deny"
+	config.WhitelistIPs = []string{"10.0.0.1"}
+	config.WhitelistCIDRs = []string{"192.168.0.0/24"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"10.0.0.1:12345", 200, "Whitelisted IP"},
+		{"192.168.0.20:12345", 200, "Whitelisted CIDR"},
+		{"8.8.8.8:12345", 403, "Unlisted IP denied"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestRequireWhitelistInDenyMode(t *testing.T) {
+	tests := []struct {
+		defaultAction string
+		whitelistIPs  []string
+		expectError   bool
+		testName      string
+	}{
+		{"deny", nil, true, "Empty whitelist in deny mode"},
+		{"deny", []string{"10.0.0.1"}, false, "Populated whitelist in deny mode"},
+		{"deny", []string{"invalid"}, true, "Only invalid whitelist entries"},
+		{"allow", nil, false, "Allow mode ignores the guard"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.DefaultAction = test.defaultAction
+		config.RequireWhitelistInDenyMode = true
+		config.WhitelistIPs = test.whitelistIPs
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if test.expectError && err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+		}
+	}
+}
+
+func TestInvalidDefaultAction(t *testing.T) {
+	config := CreateConfig()
+	config.DefaultAction = "drop"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid default action")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.BlockedCIDRs = []string{"10.0.0.0/8"}
+	config.WhitelistIPs = []string{"10.0.0.5"}
+	config.SkipTraefikInternalPaths = true
+
+	called := false
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	tests := []struct {
+		path         string
+		remoteAddr   string
+		headers      map[string]string
+		expected     string
+		expectedRule string
+		testName     string
+	}{
+		{"/", "192.168.1.100:12345", nil, statusBlocked, "192.168.1.100", "Blocked IP"},
+		{"/", "10.1.2.3:12345", nil, statusBlocked, "10.0.0.0/8", "Blocked CIDR"},
+		{"/", "10.0.0.5:12345", nil, statusWhitelisted, "", "Whitelisted IP"},
+		{"/", "8.8.8.8:12345", nil, statusAllowed, "", "Allowed IP"},
+		{"/", "8.8.8.8:12345", map[string]string{"X-Forwarded-For": "192.168.1.100"}, statusBlocked, "192.168.1.100", "Blocked IP from header"},
+		{"/ping", "192.168.1.100:12345", nil, statusAllowed, "", "Skipped path"},
+		{"/", "invalid", nil, statusAllowed, "", "No client IP"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.RemoteAddr = test.remoteAddr
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+
+		status, rule := b.Evaluate(req)
+		if status != test.expected || rule != test.expectedRule {
+			t.Errorf("%s: expected (%s, %q), got (%s, %q)", test.testName, test.expected, test.expectedRule, status, rule)
+		}
+	}
+
+	if called {
+		t.Error("Evaluate should not call the next handler")
+	}
+}
+
+func TestCacheLRUEviction(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.CacheMaxEntries = 4
+	config.CacheShards = 1
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+	cache := b.lookup.allowedCache
+
+	for i := 1; i <= 4; i++ {
+		requestFrom(handler, fmt.Sprintf("10.0.0.%d:12345", i))
+	}
+	// Using 10.0.0.1 again makes 10.0.0.2 the least recently used entry
+	if _, ok := b.lookup.checkCache("10.0.0.1"); !ok {
+		t.Fatal("Expected 10.0.0.1 to be cached")
+	}
+	for i := 5; i <= 7; i++ {
+		requestFrom(handler, fmt.Sprintf("10.0.0.%d:12345", i))
+	}
+
+	if size := cache.len(); size != 4 {
+		t.Errorf("Expected cache to stay at 4 entries, got %d", size)
+	}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		if _, ok := b.lookup.checkCache(ip); ok {
+			t.Errorf("Expected least recently used %s to be evicted", ip)
+		}
+	}
+	for _, ip := range []string{"10.0.0.1", "10.0.0.5", "10.0.0.6", "10.0.0.7"} {
+		if _, ok := b.lookup.checkCache(ip); !ok {
+			t.Errorf("Expected recently used %s to stay cached", ip)
+		}
+	}
+	if evictions := b.Stats()["cache_evictions"]; evictions != 3 {
+		t.Errorf("Expected 3 evictions, got %d", evictions)
+	}
+
+	// Evicted IPs are evaluated again
+	if code := requestFrom(handler, "192.168.1.100:12345"); code != 403 {
+		t.Errorf("Expected blocked IP to be blocked with a full cache, got %d", code)
+	}
+}
+
+func TestCacheHardLimit(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.CacheMaxEntries = 4
+	config.DisableCacheEviction = true
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	b := handler.(*BlockIP)
+	cache := b.lookup.allowedCache
+
+	output := captureStdout(t, func() {
+		for i := 1; i <= 10; i++ {
+			requestFrom(handler, fmt.Sprintf("10.0.0.%d:12345", i))
+		}
+	})
+
+	if !cache.isDisabled() {
+		t.Fatal("Expected caching to be disabled past the hard limit")
+	}
+	if size := cache.len(); size != 4 {
+		t.Errorf("Expected cache to stay at 4 entries, got %d", size)
+	}
+	if !strings.Contains(output, "caching disabled") {
+		t.Errorf("Expected a warning when caching is disabled, got output %q", output)
+	}
+
+	// Decisions are still made while caching is disabled
+	if code := requestFrom(handler, "192.168.1.100:12345"); code != 403 {
+		t.Errorf("Expected blocked IP to be blocked with caching disabled, got %d", code)
+	}
+
+	// Expire the cached entries so usage drops below the threshold
+	ageCache(cache, 24*time.Hour)
+	cache.lastCleanup.Store(0)
+
+	output = captureStdout(t, func() {
+		requestFrom(handler, "10.0.1.1:12345")
+	})
+
+	if cache.isDisabled() {
+		t.Error("Expected caching to be re-enabled once usage dropped")
+	}
+	if _, ok := b.lookup.checkCache("10.0.1.1"); !ok {
+		t.Error("Expected decision to be cached after re-enabling")
+	}
+	if !strings.Contains(output, "caching re-enabled") {
+		t.Errorf("Expected a log line when caching is re-enabled, got output %q", output)
+	}
+}
+
+func TestCacheEvictionAcrossShards(t *testing.T) {
+	c := newIPCache(time.Hour, 10, 4)
+	for i := 0; i < 100; i++ {
+		c.put(fmt.Sprintf("10.0.%d.%d", i/256, i%256), decision{status: statusAllowed})
+	}
+	if size := c.len(); size != 10 {
+		t.Errorf("Expected the cache to be capped at 10 entries, got %d", size)
+	}
+	if _, ok := c.get("10.0.0.99"); !ok {
+		t.Error("Expected the last entry to stay cached")
+	}
+}
+
+func TestCacheEvictionWithMoreShardsThanEntries(t *testing.T) {
+	c := newIPCache(time.Hour, 2, 64)
+
+	// Pick three IPs that land in different shards
+	var ips []string
+	seen := make(map[*cacheShard]bool)
+	for i := 1; len(ips) < 3; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		if shard := c.shardFor(ip); !seen[shard] {
+			seen[shard] = true
+			ips = append(ips, ip)
+		}
+	}
+
+	for _, ip := range ips {
+		c.put(ip, decision{status: statusAllowed})
+	}
+
+	if size := c.len(); size != 2 {
+		t.Errorf("Expected the cache to be capped at 2 entries, got %d", size)
+	}
+	if _, ok := c.get(ips[2]); !ok {
+		t.Error("Expected the newest entry to stay cached")
+	}
+	if _, ok := c.get(ips[1]); !ok {
+		t.Error("Expected the second entry to stay cached")
+	}
+	if _, ok := c.get(ips[0]); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	if evictions := c.evictions.Load(); evictions != 1 {
+		t.Errorf("Expected 1 eviction, got %d", evictions)
+	}
+}
+
+func TestSeparateCacheTTLs(t *testing.T) {
+	lookup := newIPLookupService(time.Hour, time.Minute, 0, 0)
+
+	lookup.cacheFor(statusAllowed).put("10.0.0.1", decision{status: statusAllowed})
+	lookup.cacheFor(statusBlocked).put("10.0.0.2", decision{status: statusBlocked, rule: "10.0.0.2"})
+	lookup.cacheFor(statusWhitelisted).put("10.0.0.3", decision{status: statusWhitelisted})
+
+	if size := lookup.allowedCache.len(); size != 1 {
+		t.Errorf("Expected 1 entry in the allowed cache, got %d", size)
+	}
+	if size := lookup.cache.len(); size != 2 {
+		t.Errorf("Expected 2 entries in the decided cache, got %d", size)
+	}
+
+	// Age every entry past the allowed TTL but within the decided TTL
+	ageCache(lookup.allowedCache, 2*time.Minute)
+	ageCache(lookup.cache, 2*time.Minute)
+
+	if _, ok := lookup.checkCache("10.0.0.1"); ok {
+		t.Error("Expected allowed entry to expire after its own TTL")
+	}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3"} {
+		if _, ok := lookup.checkCache(ip); !ok {
+			t.Errorf("Expected %s to stay cached under the longer TTL", ip)
+		}
+	}
+
+	// Filling the allowed cache does not disturb decided entries
+	full := newIPLookupService(time.Hour, time.Minute, 2, 0)
+	full.cacheFor(statusBlocked).put("10.0.0.2", decision{status: statusBlocked})
+	for i := 1; i <= 5; i++ {
+		full.cacheFor(statusAllowed).put(fmt.Sprintf("10.0.1.%d", i), decision{status: statusAllowed})
+	}
+	if size := full.allowedCache.len(); size != 2 {
+		t.Errorf("Expected allowed cache to be capped at 2 entries, got %d", size)
+	}
+	if entry, ok := full.checkCache("10.0.0.2"); !ok || entry.Status != statusBlocked {
+		t.Errorf("Expected blocked entry to stay cached, got %+v, %v", entry, ok)
+	}
+}
+
+// ageCache moves the timestamp of every entry in c back by the given age
+func ageCache(c *IPCache, by time.Duration) {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		for _, elem := range shard.cache {
+			elem.Value.(*cacheItem).entry.Timestamp -= int64(by)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+func TestCacheShards(t *testing.T) {
+	shards := defaultCacheShards()
+	if shards&(shards-1) != 0 || shards > maxCacheShards {
+		t.Errorf("Expected a power of two up to %d shards, got %d", maxCacheShards, shards)
+	}
+	if procs := runtime.GOMAXPROCS(0); shards < procs && shards != maxCacheShards {
+		t.Errorf("Expected at least %d shards for GOMAXPROCS %d, got %d", procs, procs, shards)
+	}
+
+	tests := []struct {
+		cacheShards int
+		expected    int
+		testName    string
+	}{
+		{0, defaultCacheShards(), "Auto-tuned"},
+		{1, 1, "Single shard"},
+		{16, 16, "Explicit shard count"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.CacheShards = test.cacheShards
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+		if got := handler.(*BlockIP).Stats()["cache_shards"]; got != int64(test.expected) {
+			t.Errorf("%s: expected %d cache shards in stats, got %d", test.testName, test.expected, got)
+		}
+	}
+
+	config := CreateConfig()
+	config.CacheShards = -1
+	if _, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), config, "blockip-test"); err == nil {
+		t.Error("Expected error for negative cacheShards")
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	cache := newIPCache(time.Hour, 0, 8)
+
+	for i := 0; i < 200; i++ {
+		cache.put(fmt.Sprintf("10.0.%d.%d", i/256, i%256), decision{status: statusBlocked, rule: "10.0.0.0/16"})
+	}
+	if size := cache.len(); size != 200 {
+		t.Errorf("Expected 200 entries, got %d", size)
+	}
+
+	used := 0
+	for _, shard := range cache.shards {
+		if len(shard.cache) > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("Expected entries spread over several shards, got %d", used)
+	}
+
+	// Overwriting an entry does not change the size
+	cache.put("10.0.0.1", decision{status: statusAllowed})
+	if entry, ok := cache.get("10.0.0.1"); !ok || entry.Status != statusAllowed {
+		t.Errorf("Expected overwritten entry, got %+v, %v", entry, ok)
+	}
+	if size := cache.len(); size != 200 {
+		t.Errorf("Expected 200 entries after overwrite, got %d", size)
+	}
+
+	ageCache(cache, 2*time.Hour)
+	if purged := cache.cleanup(); purged != 200 || cache.len() != 0 {
+		t.Errorf("Expected all 200 entries purged, got %d with %d left", purged, cache.len())
+	}
+
+	cache.put("10.0.0.1", decision{status: statusBlocked})
+	cache.clear()
+	if _, ok := cache.get("10.0.0.1"); ok || cache.len() != 0 {
+		t.Errorf("Expected empty cache after clear, got %d entries", cache.len())
+	}
+}
+
+func TestAllowedCacheTTLCapped(t *testing.T) {
+	config := CreateConfig()
+	config.CacheTTL = 30
+	config.AllowedCacheTTL = 120
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	if ttl := handler.(*BlockIP).lookup.allowedCache.ttl; ttl != 30*time.Second {
+		t.Errorf("Expected allowed cache TTL capped at 30s, got %v", ttl)
+	}
+}
+
+func TestBlockPlaintextHTTP(t *testing.T) {
+	tests := []struct {
+		enabled    bool
+		remoteAddr string
+		tls        bool
+		expected   int
+		testName   string
+	}{
+		{true, "8.8.8.8:12345", false, 403, "Plaintext request blocked"},
+		{true, "8.8.8.8:12345", true, 200, "TLS request allowed"},
+		{true, "10.0.0.1:12345", false, 200, "Whitelisted plaintext request allowed"},
+		{true, "192.168.1.100:12345", true, 403, "Blocked IP over TLS"},
+		{false, "8.8.8.8:12345", false, 200, "Disabled by default"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.WhitelistIPs = []string{"10.0.0.1"}
+		config.BlockPlaintextHTTP = test.enabled
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		if test.tls {
+			req = httptest.NewRequest("GET", "https://example.com/", nil)
+		}
+		req.RemoteAddr = test.remoteAddr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+// Benchmarks
+func BenchmarkIPLookupDirect(b *testing.B) {
+	config := CreateConfig()
+	config.BlockedIPs = make([]string, 100)
+	for i := 0; i < 100; i++ {
+		config.BlockedIPs[i] = fmt.Sprintf("192.168.%d.%d", i/256, i%256)
+	}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-bench")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.0.50:12345"
+
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkCIDRLookup(b *testing.B) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"192.168.0.0/16", "10.0.0.0/8", "172.16.0.0/12"}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-bench")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.1.50:12345"
+
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkCacheLookup(b *testing.B) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.CacheTTL = 3600
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-bench")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.1.50:12345"
+
+	w := httptest.NewRecorder()
+
+	// Prime the cache
+	handler.ServeHTTP(w, req)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkWhitelistCheck(b *testing.B) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"192.168.0.0/16"}
+	config.WhitelistIPs = []string{"192.168.1.50"}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-bench")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.1.50:12345"
+
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkHeaderExtraction(b *testing.B) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"203.0.113.50"}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-bench")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.50, 192.168.1.1")
+
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func TestRejectCatchAllCIDR(t *testing.T) {
+	listFile := writeListFile(t, "192.0.2.1\n0.0.0.0/0\n")
+
+	tests := []struct {
+		configure   func(*Config)
+		reject      bool
+		expectError bool
+		testName    string
+	}{
+		{func(c *Config) { c.BlockedCIDRs = []string{"0.0.0.0/0"} }, true, true, "IPv4 catch-all"},
+		{func(c *Config) { c.BlockedCIDRs = []string{"::/0"} }, true, true, "IPv6 catch-all"},
+		{func(c *Config) {
+			c.ListGroups = []ListGroup{{Name: "all", BlockedCIDRs: []string{"0.0.0.0/0"}}}
+		}, true, true, "Catch-all in list group"},
+		{func(c *Config) { c.BlockedIPsFile = listFile }, true, true, "Catch-all in list file"},
+		{func(c *Config) {
+			c.HostRules = []HostRule{{Hosts: []string{"example.com"}, BlockedCIDRs: []string{"::/0"}}}
+		}, true, true, "Catch-all in host rule"},
+		{func(c *Config) { c.WhitelistCIDRs = []string{"0.0.0.0/0"} }, true, false, "Catch-all whitelist allowed"},
+		{func(c *Config) { c.BlockedCIDRs = []string{"10.0.0.0/8"} }, true, false, "Regular CIDR"},
+		{func(c *Config) { c.BlockedCIDRs = []string{"0.0.0.0/0"} }, false, false, "Flag disabled"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.RejectCatchAllCIDR = test.reject
+		test.configure(config)
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if test.expectError && err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+		}
+		if test.expectError && err != nil && !strings.Contains(err.Error(), "catch-all CIDR") {
+			t.Errorf("%s: expected a catch-all error, got %v", test.testName, err)
+		}
+	}
+}
+
+func TestPeriodicCacheCleanup(t *testing.T) {
+	config := CreateConfig()
+	config.CacheTTLDuration = "50ms"
+	config.CacheCleanupIntervalDuration = "10ms"
+	config.BlockedIPs = []string{"203.0.113.5"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+	defer b.Stop()
+
+	requestFrom(handler, "203.0.113.5:12345")
+	requestFrom(handler, "198.51.100.1:12345")
+
+	size := func() int {
+		return b.lookup.cache.len() + b.lookup.allowedCache.len()
+	}
+	if n := size(); n != 2 {
+		t.Fatalf("Expected 2 cached entries, got %d", n)
+	}
+
+	// Stays far below the size that triggers an inline cleanup
+	deadline := time.Now().Add(time.Second)
+	for size() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := size(); n != 0 {
+		t.Errorf("Expected expired entries to be swept, %d left", n)
+	}
+}
+
+func TestInvalidCacheCleanupInterval(t *testing.T) {
+	config := CreateConfig()
+	config.CacheCleanupIntervalDuration = "soon"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid cacheCleanupIntervalDuration")
+	}
+}
+
+func TestNoIPAction(t *testing.T) {
+	tests := []struct {
+		action          string
+		legacy          string
+		expected        int
+		wwwAuthenticate bool
+		testName        string
+	}{
+		{"", "", 200, false, "Default allows"},
+		{"allow", "", 200, false, "Allow"},
+		{"block", "", 403, false, "Block"},
+		{"challenge", "", 401, true, "Challenge"},
+		{"", "block", 403, false, "Deprecated field honored"},
+		{"allow", "block", 200, false, "NoIPAction takes precedence"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.NoIPAction = test.action
+		config.UnparsableClientIPAction = test.legacy
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "not-an-address"
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+		if got := w.Header().Get("WWW-Authenticate") != ""; got != test.wwwAuthenticate {
+			t.Errorf("%s: expected WWW-Authenticate present %v, got %v", test.testName, test.wwwAuthenticate, got)
+		}
+
+		status, _ := handler.(*BlockIP).Evaluate(req)
+		if (status == statusBlocked) != (test.expected != 200) {
+			t.Errorf("%s: Evaluate returned %s", test.testName, status)
+		}
+	}
+}
+
+func TestInvalidNoIPAction(t *testing.T) {
+	config := CreateConfig()
+	config.NoIPAction = "drop"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid no IP action")
+	}
+}
+
+func TestPassthroughMode(t *testing.T) {
+	tests := []struct {
+		passthrough bool
+		remoteAddr  string
+		expected    int
+		called      bool
+		header      string
+		testName    string
+	}{
+		{false, "192.168.1.50:12345", 403, false, "", "Enforcing blocks"},
+		{false, "10.0.0.1:12345", 200, true, "", "Enforcing allows"},
+		{true, "192.168.1.50:12345", 200, true, "true", "Passthrough flags blocked"},
+		{true, "192.168.1.1:12345", 200, true, "", "Passthrough whitelisted"},
+		{true, "10.0.0.1:12345", 200, true, "", "Passthrough allowed"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedCIDRs = []string{"192.168.0.0/16"}
+		config.WhitelistIPs = []string{"192.168.1.1"}
+		config.PassthroughMode = test.passthrough
+
+		called := false
+		var header string
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			header = r.Header.Get("X-Blocked-IP")
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set("X-Blocked-IP", "spoofed")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+		if called != test.called {
+			t.Errorf("%s: expected next called %v, got %v", test.testName, test.called, called)
+		}
+		if test.passthrough && header != test.header {
+			t.Errorf("%s: expected X-Blocked-IP %q, got %q", test.testName, test.header, header)
+		}
+	}
+}
+
+func TestPassthroughModeDoesNotLogWouldBlock(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"192.168.0.0/16"}
+	config.PassthroughMode = true
+	b := newTestHandler(t, config)
+
+	if code := requestFrom(b, "192.168.1.50:12345"); code != 200 {
+		t.Fatalf("Expected blocked IP to pass through, got %d", code)
+	}
+
+	if logs := strings.Join(b.logger.GetLogs(0), "\n"); strings.Contains(logs, "WOULD BLOCK") {
+		t.Errorf("Expected no WOULD BLOCK line in passthrough mode, got:\n%s", logs)
+	}
+}
+
+func TestCanonicalIP(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		testName string
+	}{
+		{"2001:db8::1", "2001:db8::1", "Compressed IPv6"},
+		{"2001:DB8::1", "2001:db8::1", "Uppercase IPv6"},
+		{"2001:db8:0:0:0:0:0:1", "2001:db8::1", "Expanded IPv6"},
+		{"2001:0db8:0000::0001", "2001:db8::1", "Leading zeros"},
+		{"::ffff:1.2.3.4", "1.2.3.4", "IPv4-mapped IPv6"},
+		{"::FFFF:0102:0304", "1.2.3.4", "Hex IPv4-mapped IPv6"},
+		{"1.2.3.4", "1.2.3.4", "IPv4"},
+		{"not-an-ip", "not-an-ip", "Invalid kept"},
+	}
+
+	for _, test := range tests {
+		if result := canonicalIP(test.input); result != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.testName, test.expected, result)
+		}
+	}
+}
+
+func TestIPNormalization(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"2001:DB8::1", "::ffff:198.51.100.7", "2001:db8::2"}
+	config.WhitelistIPs = []string{"2001:db8:0:0:0:0:0:2"}
+	config.ClientIPHeaders = []string{"X-Real-IP"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		realIP     string
+		expected   int
+		testName   string
+	}{
+		{"[2001:db8::1]:12345", "", 403, "Compressed RemoteAddr"},
+		{"[2001:0db8:0:0:0:0:0:1]:12345", "", 403, "Expanded RemoteAddr"},
+		{"10.0.0.1:12345", "2001:db8:0000::1", 403, "Expanded header"},
+		{"198.51.100.7:12345", "", 403, "IPv4 matching a mapped entry"},
+		{"10.0.0.1:12345", "::ffff:198.51.100.7", 403, "Mapped header"},
+		{"[2001:DB8::2]:12345", "", 200, "Whitelisted in another form"},
+		{"[2001:db8::3]:12345", "", 200, "Other address"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.realIP != "" {
+			req.Header.Set("X-Real-IP", test.realIP)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestParseCanonicalCIDR(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		testName string
+	}{
+		{"203.0.113.0/24", "203.0.113.0/24", "IPv4"},
+		{"::ffff:203.0.113.0/120", "203.0.113.0/24", "IPv4-mapped"},
+		{"::ffff:203.0.113.5/128", "203.0.113.5/32", "IPv4-mapped single address"},
+		{"::ffff:0:0/96", "0.0.0.0/0", "Whole IPv4-mapped range"},
+		{"2001:db8::/32", "2001:db8::/32", "IPv6"},
+		{"::/0", "::/0", "IPv6 catch-all"},
+	}
+
+	for _, test := range tests {
+		ipnet, err := parseCanonicalCIDR(test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+			continue
+		}
+		if ipnet.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.testName, test.expected, ipnet)
+		}
+	}
+}
+
+func TestIPv4MappedAddresses(t *testing.T) {
+	for _, bloom := range []bool{false, true} {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.0.2.7"}
+		config.BlockedCIDRs = []string{"203.0.113.0/24", "::ffff:198.51.100.0/120"}
+		config.WhitelistIPs = []string{"::ffff:203.0.113.9"}
+		config.ClientIPHeaders = []string{"X-Forwarded-For"}
+		config.CIDRBloomFilter = bloom
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("Failed to create plugin: %v", err)
+		}
+
+		tests := []struct {
+			remoteAddr string
+			xff        string
+			expected   int
+			testName   string
+		}{
+			{"[::ffff:192.0.2.7]:12345", "", 403, "Mapped RemoteAddr matching an IP"},
+			{"[::ffff:203.0.113.5]:12345", "", 403, "Mapped RemoteAddr in an IPv4 CIDR"},
+			{"[::ffff:198.51.100.5]:12345", "", 403, "Mapped RemoteAddr in a mapped CIDR"},
+			{"198.51.100.5:12345", "", 403, "IPv4 RemoteAddr in a mapped CIDR"},
+			{"10.0.0.1:12345", "::ffff:203.0.113.5", 403, "Mapped X-Forwarded-For in an IPv4 CIDR"},
+			{"10.0.0.1:12345", "[::ffff:198.51.100.5]", 403, "Mapped X-Forwarded-For in a mapped CIDR"},
+			{"10.0.0.1:12345", "203.0.113.9", 200, "IPv4 matching a mapped whitelist entry"},
+			{"[::ffff:10.0.0.1]:12345", "", 200, "Mapped RemoteAddr not blocked"},
+		}
+
+		for _, test := range tests {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.xff != "" {
+				req.Header.Set("X-Forwarded-For", test.xff)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != test.expected {
+				t.Errorf("%s (bloom filter %v): expected status %d, got %d", test.testName, bloom, test.expected, w.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// blockPageIndex is the page served to blocked clients
+const blockPageIndex = "index.html"
+
+// blockPageAssetPrefix is the URL path under which the other files of the
+// block page are served, so the page must reference them absolutely, e.g.
+// /.blockip/style.css
+const blockPageAssetPrefix = "/.blockip/"
+
+// Bounds on the block page bundle, which is held in memory
+const (
+	maxBlockPageFiles = 32
+	maxBlockPageBytes = 1 << 20
+)
+
+// blockPageAsset is one file of the block page bundle
+type blockPageAsset struct {
+	contentType string
+	body        []byte
+}
+
+// blockPage is a static block page with its stylesheets, images and
+// scripts, keyed by file name
+type blockPage struct {
+	index  blockPageAsset
+	assets map[string]blockPageAsset
+}
+
+// loadBlockPage reads the files at the top level of dir, which must
+// include index.html. Subdirectories are ignored.
+func loadBlockPage(dir string) (*blockPage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("cannot read blockPageDir %s", dir), err)
+	}
+
+	page := &blockPage{assets: make(map[string]blockPageAsset)}
+	total := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if len(page.assets) >= maxBlockPageFiles {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig,
+				fmt.Sprintf("blockPageDir %s has more than %d files", dir, maxBlockPageFiles), nil)
+		}
+
+		body, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("cannot read blockPageDir file %s", entry.Name()), err)
+		}
+		if total += len(body); total > maxBlockPageBytes {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig,
+				fmt.Sprintf("blockPageDir %s exceeds %d bytes", dir, maxBlockPageBytes), nil)
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(entry.Name()))
+		if contentType == "" {
+			contentType = http.DetectContentType(body)
+		}
+		page.assets[entry.Name()] = blockPageAsset{contentType: contentType, body: body}
+	}
+
+	index, ok := page.assets[blockPageIndex]
+	if !ok {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("blockPageDir %s has no %s", dir, blockPageIndex), nil)
+	}
+	page.index = index
+	delete(page.assets, blockPageIndex)
+	return page, nil
+}
+
+// asset returns the bundled file urlPath names under blockPageAssetPrefix.
+// Any other path, including a nested one, is not an asset.
+func (p *blockPage) asset(urlPath string) (blockPageAsset, bool) {
+	name, ok := strings.CutPrefix(urlPath, blockPageAssetPrefix)
+	if !ok {
+		return blockPageAsset{}, false
+	}
+	asset, ok := p.assets[name]
+	return asset, ok
+}
+
+// serveBlockPage writes the requested asset with 200, or the index page
+// with the block status code
+func (b *BlockIP) serveBlockPage(rw http.ResponseWriter, req *http.Request, statusCode int) {
+	asset, ok := b.blockPage.asset(req.URL.Path)
+	if ok {
+		statusCode = http.StatusOK
+	} else {
+		asset = b.blockPage.index
+		b.stats.countResponse(statusCode)
+	}
+
+	rw.Header().Set("Content-Type", asset.contentType)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(asset.body)))
+	rw.WriteHeader(statusCode)
+	if _, err := rw.Write(asset.body); err != nil {
+		b.logger.Error("[%s] Error writing response: %v", b.name, err)
+	}
+}
@@ -0,0 +1,108 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBlockPage writes the given files to a new directory
+func writeBlockPage(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestBlockPageDir(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.BlockPageDir = writeBlockPage(t, map[string]string{
+		"index.html": `<html><head><link rel="stylesheet" href="/.blockip/style.css"></head><body>Blocked</body></html>`,
+		"style.css":  "body { color: red; }",
+	})
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+		testName    string
+	}{
+		{"/account/settings", 403, "text/html", "Blocked", "Index page"},
+		{"/.blockip/style.css", 200, "text/css", "color: red", "Stylesheet under the asset prefix"},
+		{"/style.css", 403, "text/html", "Blocked", "Asset name outside the prefix"},
+		{"/account/style.css", 403, "text/html", "Blocked", "Asset name at a nested path"},
+		{"/.blockip/nested/style.css", 403, "text/html", "Blocked", "Nested path under the prefix"},
+		{"/.blockip/index.html", 403, "text/html", "Blocked", "Index by name"},
+		{"/.blockip/missing.js", 403, "text/html", "Blocked", "Unknown asset"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.status, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, test.contentType) {
+			t.Errorf("%s: expected content type %s, got %q", test.testName, test.contentType, contentType)
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s: expected body containing %q, got %q", test.testName, test.body, w.Body.String())
+		}
+	}
+
+	// Allowed clients reach the backend, even for asset paths
+	if code := requestPath(handler, "10.0.0.1:12345", "/.blockip/style.css"); code != 200 {
+		t.Errorf("Expected allowed request to pass, got %d", code)
+	}
+}
+
+func TestInvalidBlockPageDir(t *testing.T) {
+	tooMany := map[string]string{"index.html": "Blocked"}
+	for i := 0; i < maxBlockPageFiles; i++ {
+		tooMany[strings.Repeat("a", i+1)+".css"] = ""
+	}
+
+	tests := []struct {
+		dir      string
+		template string
+		testName string
+	}{
+		{"/nonexistent/blockpage", "", "Missing directory"},
+		{writeBlockPage(t, map[string]string{"style.css": ""}), "", "Missing index"},
+		{writeBlockPage(t, tooMany), "", "Too many files"},
+		{writeBlockPage(t, map[string]string{"index.html": strings.Repeat("x", maxBlockPageBytes+1)}), "", "Too large"},
+		{writeBlockPage(t, map[string]string{"index.html": "Blocked"}), "blocked {{.ClientIP}}", "Combined with a template"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockPageDir = test.dir
+		config.ResponseTemplate = test.template
+		config.ResponseContentType = "text/plain"
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
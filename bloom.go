@@ -0,0 +1,110 @@
+package traefik_plugin_blockip
+
+import (
+	"hash/fnv"
+	"net"
+	"sort"
+)
+
+// bloomBitsPerEntry and bloomHashes give roughly a 1% false positive rate
+const (
+	bloomBitsPerEntry = 10
+	bloomHashes       = 7
+)
+
+// cidrBloom is a bloom filter over masked CIDR prefixes. It answers whether
+// an IP may be inside one of the networks; a negative answer is definite.
+type cidrBloom struct {
+	bits      []uint64
+	prefixes4 []int
+	prefixes6 []int
+}
+
+// newCIDRBloom builds a bloom filter containing every network in nets
+func newCIDRBloom(nets []*net.IPNet) *cidrBloom {
+	size := len(nets) * bloomBitsPerEntry
+	if size < 64 {
+		size = 64
+	}
+
+	f := &cidrBloom{bits: make([]uint64, (size+63)/64)}
+	seen4 := make(map[int]bool)
+	seen6 := make(map[int]bool)
+
+	for _, ipnet := range nets {
+		ones, _ := ipnet.Mask.Size()
+		if ip4 := ipnet.IP.To4(); ip4 != nil && len(ipnet.Mask) == net.IPv4len {
+			if !seen4[ones] {
+				seen4[ones] = true
+				f.prefixes4 = append(f.prefixes4, ones)
+			}
+			f.add(bloomKey(ip4, ones))
+			continue
+		}
+		if !seen6[ones] {
+			seen6[ones] = true
+			f.prefixes6 = append(f.prefixes6, ones)
+		}
+		f.add(bloomKey(ipnet.IP.To16(), ones))
+	}
+
+	sort.Ints(f.prefixes4)
+	sort.Ints(f.prefixes6)
+	return f
+}
+
+// mayContain reports whether ip may fall inside one of the filter's networks
+func (f *cidrBloom) mayContain(ip net.IP) bool {
+	prefixes := f.prefixes6
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		prefixes = f.prefixes4
+	} else {
+		ip = ip.To16()
+	}
+
+	for _, ones := range prefixes {
+		masked := ip.Mask(net.CIDRMask(ones, len(ip)*8))
+		if f.test(bloomKey(masked, ones)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *cidrBloom) add(key []byte) {
+	h1, h2 := bloomHash(key)
+	m := uint64(len(f.bits) * 64)
+	for i := uint64(0); i < bloomHashes; i++ {
+		pos := (h1 + i*h2) % m
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (f *cidrBloom) test(key []byte) bool {
+	h1, h2 := bloomHash(key)
+	m := uint64(len(f.bits) * 64)
+	for i := uint64(0); i < bloomHashes; i++ {
+		pos := (h1 + i*h2) % m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomKey encodes a masked network address and its prefix length
+func bloomKey(ip net.IP, ones int) []byte {
+	key := make([]byte, 0, len(ip)+1)
+	key = append(key, byte(ones))
+	return append(key, ip...)
+}
+
+// bloomHash derives the two base hashes used for double hashing
+func bloomHash(key []byte) (uint64, uint64) {
+	ha := fnv.New64a()
+	ha.Write(key)
+	hb := fnv.New64()
+	hb.Write(key)
+	return ha.Sum64(), hb.Sum64() | 1
+}
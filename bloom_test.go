@@ -0,0 +1,135 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sparseCIDRs returns n /24 networks spread across 10.0.0.0/8
+func sparseCIDRs(n int) []string {
+	cidrs := make([]string, n)
+	for i := 0; i < n; i++ {
+		cidrs[i] = fmt.Sprintf("10.%d.%d.0/24", (i*7)/256%256, (i*7)%256)
+	}
+	return cidrs
+}
+
+func TestCIDRBloomNoFalseNegatives(t *testing.T) {
+	cidrs := append(sparseCIDRs(2000), "2001:db8::/32", "2001:db8:ffff::/48", "172.16.0.0/12", "192.0.2.128/25")
+
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Invalid test CIDR %s: %v", cidr, err)
+		}
+		nets = append(nets, ipnet)
+	}
+
+	filter := newCIDRBloom(nets)
+
+	for _, ipnet := range nets {
+		first := ipnet.IP
+		last := make(net.IP, len(first))
+		for i := range first {
+			last[i] = first[i] | ^ipnet.Mask[i]
+		}
+		for _, ip := range []net.IP{first, last} {
+			if !filter.mayContain(ip) {
+				t.Errorf("False negative for %s in %s", ip, ipnet)
+			}
+		}
+	}
+
+	if !filter.mayContain(net.ParseIP("::ffff:172.20.1.1")) {
+		t.Error("False negative for IPv4-mapped address")
+	}
+}
+
+func TestCIDRBloomRejectsMostNonMembers(t *testing.T) {
+	nets := make([]*net.IPNet, 0)
+	for _, cidr := range sparseCIDRs(1000) {
+		_, ipnet, _ := net.ParseCIDR(cidr)
+		nets = append(nets, ipnet)
+	}
+
+	filter := newCIDRBloom(nets)
+
+	positives := 0
+	for i := 0; i < 1000; i++ {
+		if filter.mayContain(net.IPv4(203, 0, byte(i/256), byte(i%256))) {
+			positives++
+		}
+	}
+
+	if positives > 50 {
+		t.Errorf("Expected a low false positive rate, got %d/1000", positives)
+	}
+}
+
+func TestCIDRBloomBlocking(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCIDRs = append(sparseCIDRs(500), "2001:db8::/32")
+	config.CIDRBloomFilter = true
+	config.CacheTTL = 0
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"10.0.7.9:12345", 403, "IPv4 member"},
+		{"[2001:db8::1]:12345", 403, "IPv6 member"},
+		{"10.0.8.9:12345", 200, "IPv4 non-member"},
+		{"[2001:db9::1]:12345", 200, "IPv6 non-member"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func benchmarkSparseCIDRLookup(b *testing.B, bloom bool) {
+	config := CreateConfig()
+	config.BlockedCIDRs = sparseCIDRs(5000)
+	config.CIDRBloomFilter = bloom
+	config.CacheTTL = 0
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-bench")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.50:12345"
+
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkSparseCIDRLookupLinear(b *testing.B) {
+	benchmarkSparseCIDRLookup(b, false)
+}
+
+func BenchmarkSparseCIDRLookupBloom(b *testing.B) {
+	benchmarkSparseCIDRLookup(b, true)
+}
@@ -0,0 +1,60 @@
+package traefik_plugin_blockip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ruleBodySignature identifies blocks on a request body signature
+const ruleBodySignature = "body-signature"
+
+// Request body peek sizes
+const (
+	defaultBodyPeekSize = 4096
+	maxBodyPeekSize     = 64 * 1024
+)
+
+// peekedBody replays the peeked bytes before the rest of the original body
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// parseBodyPeekSize validates the peek size, applying the default when unset
+func parseBodyPeekSize(size int) (int, error) {
+	if size == 0 {
+		return defaultBodyPeekSize, nil
+	}
+	if size < 0 || size > maxBodyPeekSize {
+		return 0, NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid body peek size: %d, must be between 1 and %d", size, maxBodyPeekSize), nil)
+	}
+	return size, nil
+}
+
+// matchBodySignature reads up to the peek size from the request body and
+// checks it against the configured signatures. The body is restored so the
+// next handler still reads it in full.
+func (b *BlockIP) matchBodySignature(req *http.Request) (string, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", false
+	}
+
+	peeked, err := io.ReadAll(io.LimitReader(req.Body, int64(b.bodyPeekSize)))
+	req.Body = peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked), req.Body), Closer: req.Body}
+	if err != nil {
+		if b.debug {
+			b.logger.Debug("[%s] Error peeking request body: %v", b.name, err)
+		}
+		return "", false
+	}
+
+	for _, signature := range b.bodySignatures {
+		if bytes.Contains(peeked, signature) {
+			return string(signature), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,99 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodySignature(t *testing.T) {
+	tests := []struct {
+		body     string
+		peekSize int
+		expected int
+		testName string
+	}{
+		{`{"q":"1 UNION SELECT password FROM users"}`, 0, 403, "Signature in body"},
+		{`{"q":"hello"}`, 0, 200, "Clean body"},
+		{strings.Repeat("a", 100) + "UNION SELECT", 64, 200, "Signature beyond peek size"},
+		{"", 0, 200, "Empty body"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BodySignatures = []string{"UNION SELECT", "<script>"}
+		config.BodyPeekSize = test.peekSize
+
+		var received string
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			received = string(data)
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("POST", "/search", strings.NewReader(test.body))
+		req.RemoteAddr = "8.8.8.8:12345"
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+		if test.expected == 200 && received != test.body {
+			t.Errorf("%s: expected downstream to read the full body, got %q", test.testName, received)
+		}
+	}
+}
+
+func TestBodySignatureWhitelisted(t *testing.T) {
+	config := CreateConfig()
+	config.WhitelistIPs = []string{"10.0.0.1"}
+	config.BodySignatures = []string{"<script>"}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("<script>alert(1)</script>"))
+	req.RemoteAddr = "10.0.0.1:12345"
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 200 {
+		t.Errorf("Expected whitelisted IP to skip body inspection, got %d", w.Code)
+	}
+}
+
+func TestInvalidBodyPeekConfig(t *testing.T) {
+	tests := []struct {
+		signatures []string
+		peekSize   int
+		testName   string
+	}{
+		{[]string{"x"}, -1, "Negative peek size"},
+		{[]string{"x"}, maxBodyPeekSize + 1, "Peek size over the bound"},
+		{[]string{""}, 0, "Empty signature"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BodySignatures = test.signatures
+		config.BodyPeekSize = test.peekSize
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
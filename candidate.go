@@ -0,0 +1,113 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
+)
+
+// CandidateLists is a set of lists evaluated alongside the active ones for
+// a sample of requests. Their verdict is only logged, never served.
+type CandidateLists struct {
+	BlockedIPs     []string `json:"blockedIPs,omitempty"`
+	BlockedCIDRs   []string `json:"blockedCIDRs,omitempty"`
+	WhitelistIPs   []string `json:"whitelistIPs,omitempty"`
+	WhitelistCIDRs []string `json:"whitelistCIDRs,omitempty"`
+}
+
+// candidateEvaluator compares the candidate lists against the active ones
+type candidateEvaluator struct {
+	lookup     *ipLookupService
+	sampleRate float64
+}
+
+// newCandidateEvaluator builds the candidate lookup. It returns nil when
+// sampling is disabled.
+func newCandidateEvaluator(lists *CandidateLists, sampleRate float64) (*candidateEvaluator, error) {
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("candidateListSampleRate must be between 0 and 1, got %v", sampleRate), nil)
+	}
+	if sampleRate == 0 {
+		return nil, nil
+	}
+	if lists == nil {
+		lists = &CandidateLists{}
+	}
+
+	lookup := newIPLookupService(0, 0, 0, 1)
+
+	var err error
+	if lookup.blockedIPsSet, err = parseCandidateIPs(lists.BlockedIPs); err != nil {
+		return nil, err
+	}
+	if lookup.whitelistIPsSet, err = parseCandidateIPs(lists.WhitelistIPs); err != nil {
+		return nil, err
+	}
+	if lookup.blockedNets, err = parseCandidateCIDRs(lists.BlockedCIDRs); err != nil {
+		return nil, err
+	}
+	if lookup.whitelistNets, err = parseCandidateCIDRs(lists.WhitelistCIDRs); err != nil {
+		return nil, err
+	}
+
+	lookup.buildIndex()
+
+	return &candidateEvaluator{lookup: lookup, sampleRate: sampleRate}, nil
+}
+
+// parseCandidateIPs parses a candidate IP list into a set
+func parseCandidateIPs(ips []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		clean := ipsanitize.Clean(ip)
+		if !isValidIP(clean) {
+			return nil, NewBlockIPError(ErrCodeInvalidIP, fmt.Sprintf("invalid candidate list IP: %q", ip), nil)
+		}
+		set[canonicalIP(clean)] = true
+	}
+	return set, nil
+}
+
+// parseCandidateCIDRs parses a candidate CIDR list
+func parseCandidateCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		ipnet, err := parseCanonicalCIDR(ipsanitize.Clean(cidr))
+		if err != nil {
+			return nil, NewBlockIPError(ErrCodeInvalidCIDR, fmt.Sprintf("invalid candidate list CIDR: %q", cidr), err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// listVerdict returns the status and rule the lists of s give clientIP
+func listVerdict(s *ipLookupService, clientIP string) (string, string) {
+	if s.isWhitelisted(clientIP) {
+		return statusWhitelisted, ""
+	}
+	if rule, ok := s.matchBlocked(clientIP); ok {
+		return statusBlocked, rule
+	}
+	return statusAllowed, ""
+}
+
+// evaluateCandidate logs the candidate lists' verdict for a sampled request
+// next to the active lists' verdict, counting disagreements
+func (b *BlockIP) evaluateCandidate(clientIP string) {
+	if rand.Float64() >= b.candidate.sampleRate {
+		return
+	}
+
+	active, activeRule := listVerdict(b.lookup, clientIP)
+	candidate, candidateRule := listVerdict(b.candidate.lookup, clientIP)
+	if active != candidate {
+		b.stats.candidateMismatches.Add(1)
+	}
+
+	b.logger.Info("[%s] Candidate lists: IP %s would be %s (rule %q), active lists: %s (rule %q)",
+		b.name, clientIP, candidate, candidateRule, active, activeRule)
+}
@@ -0,0 +1,100 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCandidateLists(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"203.0.113.5"}
+	config.CandidateLists = &CandidateLists{
+		BlockedCIDRs: []string{"198.51.100.0/24"},
+		WhitelistIPs: []string{"203.0.113.5"},
+	}
+	config.CandidateListSampleRate = 1
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		logged     string
+		testName   string
+	}{
+		{"198.51.100.1:12345", 200, `IP 198.51.100.1 would be blocked (rule "198.51.100.0/24"), active lists: allowed`, "Candidate block not served"},
+		{"203.0.113.5:12345", 403, "IP 203.0.113.5 would be whitelisted", "Active block still served"},
+		{"192.0.2.1:12345", 200, "IP 192.0.2.1 would be allowed", "Agreeing verdicts logged"},
+	}
+
+	for _, test := range tests {
+		var code int
+		output := captureStdout(t, func() {
+			code = requestFrom(handler, test.remoteAddr)
+		})
+
+		if code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+		if !strings.Contains(output, test.logged) {
+			t.Errorf("%s: expected log containing %q, got %q", test.testName, test.logged, output)
+		}
+	}
+
+	if mismatches := handler.(*BlockIP).Stats()["candidate_mismatches"]; mismatches != 2 {
+		t.Errorf("Expected 2 candidate mismatches, got %d", mismatches)
+	}
+}
+
+func TestCandidateListsNotSampled(t *testing.T) {
+	config := CreateConfig()
+	config.CandidateLists = &CandidateLists{BlockedIPs: []string{"198.51.100.1"}}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	output := captureStdout(t, func() {
+		requestFrom(handler, "198.51.100.1:12345")
+	})
+	if strings.Contains(output, "Candidate lists") {
+		t.Errorf("Expected no candidate evaluation with a zero sample rate, got %q", output)
+	}
+}
+
+func TestInvalidCandidateLists(t *testing.T) {
+	tests := []struct {
+		lists      *CandidateLists
+		sampleRate float64
+		testName   string
+	}{
+		{nil, 1.5, "Sample rate above 1"},
+		{nil, -0.1, "Negative sample rate"},
+		{&CandidateLists{BlockedIPs: []string{"not-an-ip"}}, 0.5, "Invalid IP"},
+		{&CandidateLists{WhitelistCIDRs: []string{"10.0.0.0/33"}}, 0.5, "Invalid CIDR"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.CandidateLists = test.lists
+		config.CandidateListSampleRate = test.sampleRate
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("%s: expected error", test.testName)
+		}
+	}
+}
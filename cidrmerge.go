@@ -0,0 +1,123 @@
+package traefik_plugin_blockip
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// mergedCIDR is a network of a merged list along with the networks it was
+// made of
+type mergedCIDR struct {
+	net   *net.IPNet
+	rules []*net.IPNet
+}
+
+// mergeCIDRsWithRules merges nets like mergeCIDRs and attributes every
+// network of nets to the merged network covering it
+func mergeCIDRsWithRules(nets []*net.IPNet) []mergedCIDR {
+	sorted := sortCIDRs(nets)
+	merged := mergeSortedCIDRs(sorted)
+
+	// Each network of nets lies in exactly one merged network, and both
+	// lists are sorted, so the networks of each merged one are contiguous
+	result := make([]mergedCIDR, len(merged))
+	i := 0
+	for k, ipnet := range merged {
+		result[k].net = ipnet
+		for i < len(sorted) && containsNetwork(ipnet, sorted[i]) {
+			result[k].rules = append(result[k].rules, sorted[i])
+			i++
+		}
+	}
+	return result
+}
+
+// mergeCIDRs returns the smallest sorted list of networks covering the same
+// addresses as nets: networks inside another one are dropped and adjacent
+// halves of a larger network are replaced by it. IPv4 networks come first.
+func mergeCIDRs(nets []*net.IPNet) []*net.IPNet {
+	return mergeSortedCIDRs(sortCIDRs(nets))
+}
+
+// sortCIDRs returns nets sorted by family, address and then prefix length,
+// broadest first
+func sortCIDRs(nets []*net.IPNet) []*net.IPNet {
+	sorted := make([]*net.IPNet, 0, len(nets))
+	for _, ipnet := range nets {
+		if ip4 := ipnet.IP.To4(); ip4 != nil && len(ipnet.Mask) == net.IPv4len {
+			ipnet = &net.IPNet{IP: ip4, Mask: ipnet.Mask}
+		}
+		sorted = append(sorted, ipnet)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if len(a.IP) != len(b.IP) {
+			return len(a.IP) < len(b.IP)
+		}
+		if c := bytes.Compare(a.IP, b.IP); c != 0 {
+			return c < 0
+		}
+		onesA, _ := a.Mask.Size()
+		onesB, _ := b.Mask.Size()
+		return onesA < onesB
+	})
+	return sorted
+}
+
+// mergeSortedCIDRs merges networks sorted by sortCIDRs
+func mergeSortedCIDRs(sorted []*net.IPNet) []*net.IPNet {
+	merged := make([]*net.IPNet, 0, len(sorted))
+	for _, ipnet := range sorted {
+		// Sorted networks that survive are disjoint, so only the last one
+		// can contain the next
+		if n := len(merged); n > 0 && containsNetwork(merged[n-1], ipnet) {
+			continue
+		}
+		merged = append(merged, ipnet)
+
+		for n := len(merged); n >= 2; n = len(merged) {
+			parent, ok := siblingParent(merged[n-2], merged[n-1])
+			if !ok {
+				break
+			}
+			merged = append(merged[:n-2], parent)
+		}
+	}
+	return merged
+}
+
+// containsNetwork reports whether outer contains every address of inner
+func containsNetwork(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+// siblingParent returns the network made of lower and upper when they are
+// the two halves of it
+func siblingParent(lower, upper *net.IPNet) (*net.IPNet, bool) {
+	ones, bits := lower.Mask.Size()
+	upperOnes, upperBits := upper.Mask.Size()
+	if ones == 0 || ones != upperOnes || bits != upperBits {
+		return nil, false
+	}
+
+	mask := net.CIDRMask(ones-1, bits)
+	if !lower.IP.Mask(mask).Equal(lower.IP) || !upper.IP.Mask(mask).Equal(lower.IP) {
+		return nil, false
+	}
+	return &net.IPNet{IP: lower.IP, Mask: mask}, true
+}
+
+// collapsedCIDRs returns how many block and whitelist networks the index
+// saved by merging overlapping and adjacent ones
+func (s *ipLookupService) collapsedCIDRs() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.blockedTrie == nil {
+		return 0
+	}
+	return len(s.blockedNets) + len(s.whitelistNets) - s.blockedTrie.networks - s.whitelistTrie.networks
+}
@@ -0,0 +1,111 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMergeCIDRs(t *testing.T) {
+	tests := []struct {
+		input    []string
+		expected []string
+		testName string
+	}{
+		{[]string{"10.0.0.0/8", "10.1.0.0/16"}, []string{"10.0.0.0/8"}, "Subset removed"},
+		{[]string{"10.1.0.0/16", "10.0.0.0/8"}, []string{"10.0.0.0/8"}, "Subset listed first"},
+		{[]string{"192.168.0.0/24", "192.168.1.0/24"}, []string{"192.168.0.0/23"}, "Adjacent halves merged"},
+		{[]string{"192.168.1.0/24", "192.168.2.0/24"}, []string{"192.168.1.0/24", "192.168.2.0/24"}, "Adjacent but not halves"},
+		{[]string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/23"}, []string{"10.0.0.0/22"}, "Cascading merge"},
+		{[]string{"10.0.0.0/25", "10.0.0.0/24", "10.0.0.128/25"}, []string{"10.0.0.0/24"}, "Halves of a listed network"},
+		{[]string{"10.0.0.0/8", "10.0.0.0/8"}, []string{"10.0.0.0/8"}, "Duplicate"},
+		{[]string{"2001:db8::/33", "2001:db8:8000::/33", "10.0.0.0/8"}, []string{"10.0.0.0/8", "2001:db8::/32"}, "IPv6 merged, IPv4 first"},
+		{[]string{"0.0.0.0/1", "128.0.0.0/1"}, []string{"0.0.0.0/0"}, "Whole IPv4 range"},
+		{[]string{"0.0.0.0/0", "::/0"}, []string{"0.0.0.0/0", "::/0"}, "Families kept apart"},
+		{nil, []string{}, "Empty"},
+	}
+
+	for _, test := range tests {
+		nets := make([]*net.IPNet, 0, len(test.input))
+		for _, cidr := range test.input {
+			ipnet, err := parseCanonicalCIDR(cidr)
+			if err != nil {
+				t.Fatalf("%s: invalid CIDR %s: %v", test.testName, cidr, err)
+			}
+			nets = append(nets, ipnet)
+		}
+
+		merged := mergeCIDRs(nets)
+		result := make([]string, 0, len(merged))
+		for _, ipnet := range merged {
+			result = append(result, ipnet.String())
+		}
+		if strings.Join(result, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", test.testName, test.expected, result)
+		}
+	}
+}
+
+func TestMergeConfiguredCIDRs(t *testing.T) {
+	config := CreateConfig()
+	config.Debug = true
+	config.BlockedCIDRs = []string{"10.0.0.0/8", "10.1.0.0/16", "192.168.0.0/24", "192.168.1.0/24"}
+	config.WhitelistCIDRs = []string{"172.16.0.0/12", "172.16.5.0/24"}
+	config.ListGroups = []ListGroup{{Name: "legal", StatusCode: 451, BlockedCIDRs: []string{"192.168.2.0/24", "192.168.3.0/24"}}}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	if stats := b.Stats(); stats["blocked_ipv4"] != 6 || stats["whitelist_ipv4"] != 2 {
+		t.Errorf("Expected the 6 blocked and 2 whitelisted networks as configured, got %d and %d", stats["blocked_ipv4"], stats["whitelist_ipv4"])
+	}
+	if b.lookup.blockedTrie.networks != 2 || b.lookup.whitelistTrie.networks != 1 {
+		t.Errorf("Expected 2 blocked and 1 whitelisted merged networks in the index, got %d and %d",
+			b.lookup.blockedTrie.networks, b.lookup.whitelistTrie.networks)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		rule       string
+		testName   string
+	}{
+		{"10.1.2.3:1", 403, "10.0.0.0/8", "Broadest configured network"},
+		{"192.168.1.9:1", 403, "192.168.1.0/24", "Half of a merged network"},
+		{"192.168.2.9:1", 451, "192.168.2.0/24", "List group inside a merged network"},
+		{"172.16.5.1:1", 200, "", "Whitelisted"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if status, rule := b.Evaluate(req); rule != test.rule {
+			t.Errorf("%s: expected rule %q, got %q (%s)", test.testName, test.rule, rule, status)
+		}
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+
+	hits := b.RuleHits()
+	for _, rule := range []string{"10.0.0.0/8", "192.168.1.0/24", "192.168.2.0/24"} {
+		if hits[rule] != 1 {
+			t.Errorf("Expected 1 hit for configured rule %s, got %d", rule, hits[rule])
+		}
+	}
+	if _, ok := hits["192.168.0.0/22"]; ok {
+		t.Error("Expected no hits attributed to the merged network")
+	}
+
+	if logs := strings.Join(b.logger.GetLogs(0), "\n"); !strings.Contains(logs, "Collapsed 5 overlapping or adjacent CIDRs") {
+		t.Errorf("Expected the collapsed count in the debug log, got:\n%s", logs)
+	}
+}
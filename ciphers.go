@@ -0,0 +1,53 @@
+package traefik_plugin_blockip
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ruleCipherSuitePrefix identifies blocks of requests negotiated with a
+// blocked TLS cipher suite
+const ruleCipherSuitePrefix = "cipher-suite:"
+
+// parseCipherSuites maps the blocked cipher suite names, such as
+// "TLS_RSA_WITH_AES_128_CBC_SHA", to their IDs. Names are case-insensitive.
+func parseCipherSuites(names []string) (map[uint16]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]*tls.CipherSuite)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite
+	}
+
+	blocked := make(map[uint16]string, len(names))
+	for _, name := range names {
+		suite, ok := known[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig,
+				fmt.Sprintf("blockedCipherSuites contains an unknown cipher suite: %q", name), nil)
+		}
+		blocked[suite.ID] = suite.Name
+	}
+	return blocked, nil
+}
+
+// matchCipherSuite returns the cipher suite rule req is blocked by, if any.
+// Plaintext requests never match.
+func (b *BlockIP) matchCipherSuite(req *http.Request, clientIP string) (string, bool) {
+	if req.TLS == nil {
+		return "", false
+	}
+	name, ok := b.blockedCipherSuites[req.TLS.CipherSuite]
+	if !ok {
+		return "", false
+	}
+
+	if b.debug {
+		b.logger.Debug("[%s] Request from IP %s negotiated blocked cipher suite %s", b.name, clientIP, name)
+	}
+	return ruleCipherSuitePrefix + name, true
+}
@@ -0,0 +1,65 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlockedCipherSuites(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCipherSuites = []string{"TLS_RSA_WITH_3DES_EDE_CBC_SHA", "tls_rsa_with_aes_128_cbc_sha"}
+	config.WhitelistIPs = []string{"192.168.1.10"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr  string
+		cipherSuite uint16
+		tls         bool
+		expected    int
+		testName    string
+	}{
+		{"203.0.113.5:12345", tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA, true, 403, "Weak 3DES suite blocked"},
+		{"203.0.113.5:12345", tls.TLS_RSA_WITH_AES_128_CBC_SHA, true, 403, "Lowercase configured name blocked"},
+		{"203.0.113.5:12345", tls.TLS_AES_128_GCM_SHA256, true, 200, "TLS 1.3 suite allowed"},
+		{"203.0.113.5:12345", tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, true, 200, "Strong TLS 1.2 suite allowed"},
+		{"203.0.113.5:12345", 0, false, 200, "Plaintext request not matched"},
+		{"192.168.1.10:12345", tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA, true, 200, "Whitelisted IP"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.tls {
+			req.TLS = &tls.ConnectionState{CipherSuite: test.cipherSuite}
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestInvalidBlockedCipherSuite(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCipherSuites = []string{"TLS_NOT_A_SUITE"}
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for unknown cipher suite")
+	}
+}
@@ -0,0 +1,115 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ruleCompositePrefix identifies blocks by a composite rule
+const ruleCompositePrefix = "composite:"
+
+// CompositeRule blocks an IP only when it satisfies every configured
+// condition: it lies in all of CIDRs, its ASN is one of ASNs and its country
+// is one of Countries. ASN and country conditions need a GeoIP resolver.
+type CompositeRule struct {
+	Name      string   `json:"name,omitempty"`
+	CIDRs     []string `json:"cidrs,omitempty"`
+	ASNs      []uint32 `json:"asns,omitempty"`
+	Countries []string `json:"countries,omitempty"`
+}
+
+// compositeRule is a loaded composite rule
+type compositeRule struct {
+	name      string
+	nets      []*net.IPNet
+	asns      map[uint32]bool
+	countries map[string]bool
+}
+
+// loadCompositeRules validates and parses the composite rules
+func loadCompositeRules(rules []CompositeRule) ([]*compositeRule, error) {
+	loaded := make([]*compositeRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("composite rule %d has no name", i), nil)
+		}
+		if len(rule.CIDRs) == 0 && len(rule.ASNs) == 0 && len(rule.Countries) == 0 {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("composite rule %q has no conditions", rule.Name), nil)
+		}
+
+		nets, err := parseNetworks(fmt.Sprintf("composite rule %q cidrs", rule.Name), rule.CIDRs)
+		if err != nil {
+			return nil, err
+		}
+
+		cr := &compositeRule{name: rule.Name, nets: nets}
+		if len(rule.ASNs) > 0 {
+			cr.asns = make(map[uint32]bool, len(rule.ASNs))
+			for _, asn := range rule.ASNs {
+				cr.asns[asn] = true
+			}
+		}
+		if len(rule.Countries) > 0 {
+			cr.countries = make(map[string]bool, len(rule.Countries))
+			for _, country := range rule.Countries {
+				cr.countries[strings.ToUpper(strings.TrimSpace(country))] = true
+			}
+		}
+		loaded = append(loaded, cr)
+	}
+	return loaded, nil
+}
+
+// usesGeo reports whether the rule has conditions needing a geo record
+func (r *compositeRule) usesGeo() bool {
+	return r.asns != nil || r.countries != nil
+}
+
+// matches reports whether ip and its geo record satisfy every condition
+func (r *compositeRule) matches(ip net.IP, record *GeoRecord) bool {
+	for _, ipnet := range r.nets {
+		if !ipnet.Contains(ip) {
+			return false
+		}
+	}
+
+	if r.usesGeo() && record == nil {
+		return false
+	}
+	if r.asns != nil && !r.asns[record.ASN] {
+		return false
+	}
+	if r.countries != nil && !r.countries[strings.ToUpper(record.Country)] {
+		return false
+	}
+	return true
+}
+
+// compositeRulesUseGeo reports whether any composite rule needs a geo record
+func (b *BlockIP) compositeRulesUseGeo() bool {
+	for _, rule := range b.compositeRules {
+		if rule.usesGeo() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCompositeRules returns the first composite rule clientIP satisfies
+func (b *BlockIP) matchCompositeRules(clientIP string, record *GeoRecord) (string, bool) {
+	if len(b.compositeRules) == 0 {
+		return "", false
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return "", false
+	}
+	for _, rule := range b.compositeRules {
+		if rule.matches(ip, record) {
+			return ruleCompositePrefix + rule.name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,80 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompositeRules(t *testing.T) {
+	config := CreateConfig()
+	config.CompositeRules = []CompositeRule{
+		{Name: "hosting-overlap", CIDRs: []string{"203.0.113.0/24", "203.0.113.0/25"}},
+		{Name: "asn-range", CIDRs: []string{"198.51.100.0/24"}, ASNs: []uint32{64500}},
+		{Name: "asn-country", ASNs: []uint32{64501}, Countries: []string{"nl"}},
+	}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+	b.SetGeoResolver(mockGeoResolver{
+		"198.51.100.1": {Country: "US", ASN: 64500},
+		"198.51.100.2": {Country: "US", ASN: 64999},
+		"192.0.2.1":    {Country: "NL", ASN: 64501},
+		"192.0.2.2":    {Country: "DE", ASN: 64501},
+	})
+
+	tests := []struct {
+		remoteAddr string
+		expected   string
+		rule       string
+		testName   string
+	}{
+		{"203.0.113.5:12345", statusBlocked, "composite:hosting-overlap", "In both CIDRs"},
+		{"203.0.113.200:12345", statusAllowed, "", "In only one CIDR"},
+		{"198.51.100.1:12345", statusBlocked, "composite:asn-range", "CIDR and ASN match"},
+		{"198.51.100.2:12345", statusAllowed, "", "CIDR matches but ASN does not"},
+		{"198.51.100.3:12345", statusAllowed, "", "Geo condition without a record"},
+		{"192.0.2.1:12345", statusBlocked, "composite:asn-country", "ASN and country match"},
+		{"192.0.2.2:12345", statusAllowed, "", "ASN matches but country does not"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+
+		status, rule := b.Evaluate(req)
+		if status != test.expected || rule != test.rule {
+			t.Errorf("%s: expected %s/%q, got %s/%q", test.testName, test.expected, test.rule, status, rule)
+		}
+	}
+}
+
+func TestInvalidCompositeRules(t *testing.T) {
+	tests := []struct {
+		rule     CompositeRule
+		testName string
+	}{
+		{CompositeRule{CIDRs: []string{"10.0.0.0/8"}}, "Missing name"},
+		{CompositeRule{Name: "empty"}, "No conditions"},
+		{CompositeRule{Name: "bad", CIDRs: []string{"10.0.0.0/33"}}, "Invalid CIDR"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.CompositeRules = []CompositeRule{test.rule}
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
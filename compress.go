@@ -0,0 +1,56 @@
+package traefik_plugin_blockip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipBody compresses a response body
+func gzipBody(body []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(body)
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// prepareCompressedBodies compresses every block response body once so
+// requests only pick the precomputed result
+func (b *BlockIP) prepareCompressedBodies() {
+	b.gzipBodies = make(map[string][]byte)
+
+	bodies := [][]byte{b.response.body, b.rateLimitResponse.body, b.challengeResponse.body}
+	for _, response := range b.groupResponses {
+		bodies = append(bodies, response.body)
+	}
+	for _, body := range bodies {
+		if _, ok := b.gzipBodies[string(body)]; !ok {
+			b.gzipBodies[string(body)] = gzipBody(body)
+		}
+	}
+}
+
+// acceptsGzip checks if the request's Accept-Encoding allows gzip
+func acceptsGzip(req *http.Request) bool {
+	for _, header := range req.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "gzip" && name != "*" {
+				continue
+			}
+
+			params = strings.ReplaceAll(strings.ToLower(params), " ", "")
+			if q, ok := strings.CutPrefix(params, "q="); ok {
+				if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+					continue
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
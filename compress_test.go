@@ -0,0 +1,115 @@
+package traefik_plugin_blockip
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompressBlockResponse(t *testing.T) {
+	message := strings.Repeat("<p>Access to this site has been denied.</p>\n", 50)
+
+	tests := []struct {
+		compress       bool
+		acceptEncoding string
+		expectGzip     bool
+		testName       string
+	}{
+		{true, "gzip", true, "Compressed for gzip clients"},
+		{true, "deflate, gzip;q=0.8", true, "Gzip among other codings"},
+		{true, "*", true, "Wildcard coding"},
+		{true, "", false, "No Accept-Encoding"},
+		{true, "br", false, "Unsupported coding"},
+		{true, "gzip;q=0", false, "Gzip refused"},
+		{false, "gzip", false, "Compression disabled"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.Message = message
+		config.CompressBlockResponse = test.compress
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+		if test.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != 403 {
+			t.Errorf("%s: expected 403, got %d", test.testName, w.Code)
+		}
+		if length := w.Header().Get("Content-Length"); length != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("%s: Content-Length %s does not match body size %d", test.testName, length, w.Body.Len())
+		}
+
+		gzipped := w.Header().Get("Content-Encoding") == "gzip"
+		if gzipped != test.expectGzip {
+			t.Errorf("%s: expected gzip %v, got Content-Encoding %q", test.testName, test.expectGzip, w.Header().Get("Content-Encoding"))
+			continue
+		}
+
+		body := w.Body.String()
+		if gzipped {
+			if w.Body.Len() >= len(message) {
+				t.Errorf("%s: expected compressed body to be smaller, got %d bytes", test.testName, w.Body.Len())
+			}
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("%s: invalid gzip body: %v", test.testName, err)
+			}
+			data, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("%s: cannot decompress body: %v", test.testName, err)
+			}
+			body = string(data)
+		}
+		if body != message {
+			t.Errorf("%s: unexpected body content", test.testName)
+		}
+	}
+}
+
+func TestCompressGroupResponse(t *testing.T) {
+	config := CreateConfig()
+	config.CompressBlockResponse = true
+	config.ListGroups = []ListGroup{{Name: "spam", BlockedIPs: []string{"10.0.0.1"}, Message: "Spam source blocked"}}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Expected gzip body: %v", err)
+	}
+	data, _ := io.ReadAll(zr)
+	if string(data) != "Spam source blocked" {
+		t.Errorf("Expected group message, got %q", data)
+	}
+}
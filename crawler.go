@@ -0,0 +1,95 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// crawlerLookupTimeout bounds the DNS lookups verifying a crawler
+const crawlerLookupTimeout = 2 * time.Second
+
+// defaultCrawlerDomains are the PTR domains of the major search engine crawlers
+func defaultCrawlerDomains() []string {
+	return []string{"googlebot.com", "google.com", "search.msn.com"}
+}
+
+// DNSResolver performs the reverse and forward lookups used to verify
+// crawlers. *net.Resolver satisfies it.
+type DNSResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// SetDNSResolver installs the resolver used to verify crawlers. It must be
+// called before the handler starts serving requests.
+func (b *BlockIP) SetDNSResolver(r DNSResolver) {
+	b.dnsResolver = r
+}
+
+// isVerifiedCrawler reports whether ip reverse-resolves to an allowed
+// crawler domain whose name forward-resolves back to ip
+func (b *BlockIP) isVerifiedCrawler(ctx context.Context, ip string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, crawlerLookupTimeout)
+	defer cancel()
+
+	names, err := b.dnsResolver.LookupAddr(ctx, ip)
+	if err != nil {
+		return false, err
+	}
+
+	parsedIP := net.ParseIP(ip)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if !b.isCrawlerDomain(name) {
+			continue
+		}
+
+		addrs, err := b.dnsResolver.LookupHost(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		for _, addr := range addrs {
+			if parsedIP.Equal(net.ParseIP(addr)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// isCrawlerDomain checks if name is an allowed crawler domain or a subdomain of one
+func (b *BlockIP) isCrawlerDomain(name string) bool {
+	for _, domain := range b.crawlerDomains {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowVerifiedCrawler lets a blocked verified crawler through. Lookup
+// failures keep the block but are not cached.
+func (b *BlockIP) allowVerifiedCrawler(ctx context.Context, clientIP string, d decision) decision {
+	verified, err := b.isVerifiedCrawler(ctx, clientIP)
+	if err != nil {
+		if b.debug {
+			b.logger.Debug("[%s] Crawler verification failed for IP %s: %v", b.name, clientIP, err)
+		}
+		d.transient = true
+		return d
+	}
+	if !verified {
+		return d
+	}
+
+	if b.debug {
+		b.logger.Debug("[%s] IP %s is a verified crawler", b.name, clientIP)
+	}
+	allowed := decision{status: statusWhitelisted}
+	if b.logWhitelistOverrides {
+		allowed.rule = d.rule
+	}
+	return allowed
+}
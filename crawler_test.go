@@ -0,0 +1,107 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// mockDNSResolver serves reverse and forward records from maps
+type mockDNSResolver struct {
+	ptr     map[string][]string
+	hosts   map[string][]string
+	fail    bool
+	lookups int32
+}
+
+func (r *mockDNSResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	if r.fail {
+		return nil, errors.New("dns timeout")
+	}
+	return r.ptr[addr], nil
+}
+
+func (r *mockDNSResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return r.hosts[host], nil
+}
+
+func newCrawlerHandler(t *testing.T, resolver DNSResolver) *BlockIP {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"66.249.64.0/19", "203.0.113.0/24"}
+	config.AllowVerifiedCrawlers = true
+
+	b := newTestHandler(t, config)
+	b.SetDNSResolver(resolver)
+	return b
+}
+
+func TestVerifiedCrawler(t *testing.T) {
+	resolver := &mockDNSResolver{
+		ptr: map[string][]string{
+			// Verified Googlebot
+			"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."},
+			// Spoofed PTR that does not resolve back
+			"203.0.113.9": {"crawl-203-0-113-9.googlebot.com."},
+			// PTR outside the allowed domains
+			"203.0.113.10": {"bot.example.net."},
+		},
+		hosts: map[string][]string{
+			"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"},
+			"crawl-203-0-113-9.googlebot.com": {"66.249.66.9"},
+			"bot.example.net":                 {"203.0.113.10"},
+		},
+	}
+	b := newCrawlerHandler(t, resolver)
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"66.249.66.1:12345", 200, "Verified crawler allowed"},
+		{"203.0.113.9:12345", 403, "Spoofed crawler blocked"},
+		{"203.0.113.10:12345", 403, "Unlisted crawler domain blocked"},
+		{"203.0.113.11:12345", 403, "No PTR record"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(b, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestVerifiedCrawlerCached(t *testing.T) {
+	resolver := &mockDNSResolver{
+		ptr:   map[string][]string{"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."}},
+		hosts: map[string][]string{"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"}},
+	}
+	b := newCrawlerHandler(t, resolver)
+
+	for i := 0; i < 3; i++ {
+		requestFrom(b, "66.249.66.1:12345")
+	}
+	// Allowed IPs never reach the resolver
+	requestFrom(b, "8.8.8.8:12345")
+
+	if lookups := atomic.LoadInt32(&resolver.lookups); lookups != 1 {
+		t.Errorf("Expected 1 DNS lookup, got %d", lookups)
+	}
+}
+
+func TestVerifiedCrawlerLookupFailure(t *testing.T) {
+	resolver := &mockDNSResolver{fail: true}
+	b := newCrawlerHandler(t, resolver)
+
+	for i := 0; i < 2; i++ {
+		if code := requestFrom(b, "66.249.66.1:12345"); code != 403 {
+			t.Errorf("Expected block to stand when verification fails, got %d", code)
+		}
+	}
+
+	if lookups := atomic.LoadInt32(&resolver.lookups); lookups != 2 {
+		t.Errorf("Expected failed verifications not to be cached, got %d lookups", lookups)
+	}
+}
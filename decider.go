@@ -0,0 +1,98 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Actions applied when a decision cannot be made normally
+const (
+	actionAllow = "allow"
+	actionBlock = "block"
+)
+
+// ruleDecider and ruleDeciderOverflow identify decider-made decisions
+const (
+	ruleDecider         = "decider"
+	ruleDeciderOverflow = "decider-overflow"
+)
+
+// Decider is an external source of block decisions, consulted for IPs that
+// match no configured list. Decide reports whether ip should be blocked.
+type Decider interface {
+	Decide(ctx context.Context, ip string) (bool, error)
+}
+
+// SetDecider installs an external decider. It must be called before the
+// handler starts serving requests.
+func (b *BlockIP) SetDecider(d Decider) {
+	b.decider = d
+}
+
+// parseOverflowAction maps the configured overflow action to a status
+func parseOverflowAction(action string) (string, error) {
+	switch action {
+	case "", actionAllow:
+		return statusAllowed, nil
+	case actionBlock:
+		return statusBlocked, nil
+	default:
+		return "", NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid lookup overflow action: %q, must be %q or %q", action, actionAllow, actionBlock), nil)
+	}
+}
+
+// consultDecider asks the decider about clientIP, respecting the
+// concurrency limit. Decider errors fail open.
+func (b *BlockIP) consultDecider(ctx context.Context, clientIP string) decision {
+	if b.lookupSlots != nil {
+		if !b.acquireLookupSlot(ctx) {
+			if b.debug {
+				b.logger.Debug("[%s] Decider busy, applying overflow action for IP %s: %s", b.name, clientIP, b.overflowStatus)
+			}
+			return decision{status: b.overflowStatus, rule: ruleDeciderOverflow, transient: true}
+		}
+		defer func() { <-b.lookupSlots }()
+	}
+
+	blocked, err := b.decider.Decide(ctx, clientIP)
+	if err != nil {
+		b.logger.Warn("[%s] Decider error for IP %s: %v", b.name, clientIP, err)
+		return decision{status: statusAllowed, transient: true}
+	}
+
+	if blocked {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is blocked by decider", b.name, clientIP)
+		}
+		return decision{status: statusBlocked, rule: ruleDecider}
+	}
+
+	return decision{status: statusAllowed}
+}
+
+// acquireLookupSlot takes a decider slot, waiting at most lookupWait
+func (b *BlockIP) acquireLookupSlot(ctx context.Context) bool {
+	select {
+	case b.lookupSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if b.lookupWait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(b.lookupWait)
+	defer timer.Stop()
+
+	select {
+	case b.lookupSlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,194 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingDecider blocks every call until release is closed
+type blockingDecider struct {
+	release  chan struct{}
+	inFlight int32
+	maxSeen  int32
+	calls    int32
+}
+
+func (d *blockingDecider) Decide(ctx context.Context, ip string) (bool, error) {
+	atomic.AddInt32(&d.calls, 1)
+	current := atomic.AddInt32(&d.inFlight, 1)
+	defer atomic.AddInt32(&d.inFlight, -1)
+
+	for {
+		seen := atomic.LoadInt32(&d.maxSeen)
+		if current <= seen || atomic.CompareAndSwapInt32(&d.maxSeen, seen, current) {
+			break
+		}
+	}
+
+	<-d.release
+	return true, nil
+}
+
+func TestDeciderConcurrencyCap(t *testing.T) {
+	config := CreateConfig()
+	config.CacheTTL = 0
+	config.MaxConcurrentLookups = 2
+	config.LookupOverflowAction = "allow"
+
+	decider := &blockingDecider{release: make(chan struct{})}
+	handler := newTestHandler(t, config)
+	handler.SetDecider(decider)
+
+	// Occupy both slots
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = fmt.Sprintf("203.0.113.%d:12345", i+1)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}(i)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&decider.inFlight) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Decider calls never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Excess requests fall to the overflow action without reaching the decider
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = fmt.Sprintf("198.51.100.%d:12345", i+1)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != 200 {
+			t.Errorf("Expected overflow request to be allowed, got %d", w.Code)
+		}
+	}
+
+	close(decider.release)
+	wg.Wait()
+
+	if maxSeen := atomic.LoadInt32(&decider.maxSeen); maxSeen > 2 {
+		t.Errorf("Expected at most 2 concurrent decider calls, saw %d", maxSeen)
+	}
+	if calls := atomic.LoadInt32(&decider.calls); calls != 2 {
+		t.Errorf("Expected 2 decider calls, got %d", calls)
+	}
+}
+
+func TestDeciderOverflowBlockAfterWait(t *testing.T) {
+	config := CreateConfig()
+	config.CacheTTL = 0
+	config.MaxConcurrentLookups = 1
+	config.LookupWaitTimeout = 20
+	config.LookupOverflowAction = "block"
+
+	decider := &blockingDecider{release: make(chan struct{})}
+	handler := newTestHandler(t, config)
+	handler.SetDecider(decider)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "203.0.113.1:12345"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&decider.inFlight) < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Decider call never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.2:12345"
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(w, req)
+	waited := time.Since(start)
+
+	if w.Code != 403 {
+		t.Errorf("Expected overflow request to be blocked, got %d", w.Code)
+	}
+	if waited < 20*time.Millisecond {
+		t.Errorf("Expected request to wait for a slot, waited %v", waited)
+	}
+
+	close(decider.release)
+	<-done
+}
+
+func TestInvalidLookupOverflowAction(t *testing.T) {
+	config := CreateConfig()
+	config.LookupOverflowAction = "maybe"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid lookup overflow action")
+	}
+}
+
+// slowDecider allows every IP after a delay
+type slowDecider struct {
+	delay time.Duration
+}
+
+func (d slowDecider) Decide(ctx context.Context, ip string) (bool, error) {
+	time.Sleep(d.delay)
+	return false, nil
+}
+
+func TestSlowDecisionWarning(t *testing.T) {
+	config := CreateConfig()
+	config.SlowDecisionThresholdMs = 10
+	handler := newTestHandler(t, config)
+	handler.SetDecider(slowDecider{delay: 30 * time.Millisecond})
+
+	output := captureStdout(t, func() {
+		requestFrom(handler, "203.0.113.5:12345")
+	})
+	if !strings.Contains(output, "WARN - [blockip-test] Slow decision for IP 203.0.113.5 took") || !strings.Contains(output, "over the 10ms threshold") {
+		t.Errorf("Expected a slow decision warning, got output %q", output)
+	}
+
+	// Cached decisions are fast
+	output = captureStdout(t, func() {
+		requestFrom(handler, "203.0.113.5:12345")
+	})
+	if strings.Contains(output, "Slow decision") {
+		t.Errorf("Expected no warning for a cached decision, got output %q", output)
+	}
+}
+
+func TestSlowDecisionWarningDisabled(t *testing.T) {
+	config := CreateConfig()
+	handler := newTestHandler(t, config)
+	handler.SetDecider(slowDecider{delay: 20 * time.Millisecond})
+
+	output := captureStdout(t, func() {
+		requestFrom(handler, "203.0.113.5:12345")
+	})
+	if strings.Contains(output, "Slow decision") {
+		t.Errorf("Expected no warning without a threshold, got output %q", output)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	// "net/http/httptest"
 	"strings"
+	"sync"
 )
 
 // Checker allows to check that addresses are in a denied IPs.
@@ -18,14 +19,17 @@ type Checker struct {
 
 // Config the plugin configuration.
 type Config struct {
-	IPDenyList []string
+	IPDenyList  []string
+	IPAllowList []string
 }
 
 // DenyIP plugin.
 type denyIP struct {
-	next    http.Handler
-	checker *Checker
-	name    string
+	next         http.Handler
+	mu           sync.RWMutex
+	checker      *Checker
+	allowChecker *Checker
+	name         string
 }
 
 // New creates a new DenyIP plugin.
@@ -35,19 +39,63 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 		return nil, err
 	}
 
+	allowChecker, err := newAllowChecker(config.IPAllowList)
+	if err != nil {
+		return nil, err
+	}
+
 	return &denyIP{
-		checker: checker,
-		next:    next,
-		name:    name,
+		checker:      checker,
+		allowChecker: allowChecker,
+		next:         next,
+		name:         name,
 	}, nil
 }
 
+// UpdateDenyList replaces the denied IPs. The current list is kept when
+// entries are invalid.
+func (a *denyIP) UpdateDenyList(entries []string) error {
+	checker, err := NewChecker(entries)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.checker = checker
+	a.mu.Unlock()
+	return nil
+}
+
+// UpdateAllowList replaces the allowed IPs, which are never denied. An empty
+// list clears it. The current list is kept when entries are invalid.
+func (a *denyIP) UpdateAllowList(entries []string) error {
+	allowChecker, err := newAllowChecker(entries)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.allowChecker = allowChecker
+	a.mu.Unlock()
+	return nil
+}
+
 func (a *denyIP) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	a.mu.RLock()
+	checker, allowChecker := a.checker, a.allowChecker
+	a.mu.RUnlock()
+
 	reqIPAddr := a.GetRemoteIP(req)
 	reqIPAddrLenOffset := len(reqIPAddr) - 1
 
 	for i := reqIPAddrLenOffset; i >= 0; i-- {
-		isBlocked, err := a.checker.Contains(reqIPAddr[i])
+		if allowChecker != nil {
+			if isAllowed, _ := allowChecker.Contains(reqIPAddr[i]); isAllowed {
+				continue
+			}
+		}
+
+		isBlocked, err := checker.Contains(reqIPAddr[i])
 		if err != nil {
 			fmt.Printf("Error checking IP: %v\n", err)
 		}
@@ -70,8 +118,7 @@ func (a *denyIP) GetRemoteIP(req *http.Request) []string {
 	xffs := strings.Split(xff, ",")
 
 	for i := len(xffs) - 1; i >= 0; i-- {
-		xffsTrim := strings.TrimSpace(xffs[i])
-		xffsTrim = strings.Trim(xffsTrim, "[]")
+		xffsTrim := cleanIP(xffs[i])
 
 		if len(xffsTrim) > 0 {
 			ipList = append(ipList, xffsTrim)
@@ -80,15 +127,13 @@ func (a *denyIP) GetRemoteIP(req *http.Request) []string {
 
 	ip, _, err := net.SplitHostPort(req.RemoteAddr)
 	if err != nil {
-		remoteAddrTrim := strings.TrimSpace(req.RemoteAddr)
+		remoteAddrTrim := cleanIP(req.RemoteAddr)
 		if len(remoteAddrTrim) > 0 {
-			remoteAddrTrim = strings.Trim(remoteAddrTrim, "[]")
 			ipList = append(ipList, remoteAddrTrim)
 		}
 	} else {
-		ipTrim := strings.TrimSpace(ip)
+		ipTrim := cleanIP(ip)
 		if len(ipTrim) > 0 {
-			ipTrim = strings.Trim(ipTrim, "[]")
 			ipList = append(ipList, ipTrim)
 		}
 	}
@@ -105,7 +150,7 @@ func NewChecker(deniedIPs []string) (*Checker, error) {
 	checker := &Checker{}
 
 	for _, ipMask := range deniedIPs {
-		ipMask = strings.Trim(ipMask, "[]")
+		ipMask = cleanIP(ipMask)
 
 		_, ipNet, err := net.ParseCIDR(ipMask)
 		if err == nil {
@@ -123,6 +168,14 @@ func NewChecker(deniedIPs []string) (*Checker, error) {
 	return checker, nil
 }
 
+// newAllowChecker builds the Checker for allowed IPs, nil when there are none.
+func newAllowChecker(allowedIPs []string) (*Checker, error) {
+	if len(allowedIPs) == 0 {
+		return nil, nil
+	}
+	return NewChecker(allowedIPs)
+}
+
 // Contains checks if provided address is in the denied IPs.
 func (ip *Checker) Contains(addr string) (bool, error) {
 	if len(addr) == 0 {
@@ -155,7 +208,7 @@ func (ip *Checker) ContainsIP(addr net.IP) bool {
 }
 
 func parseIP(addr string) (net.IP, error) {
-	addr = strings.Trim(addr, "[]")
+	addr = cleanIP(addr)
 
 	userIP := net.ParseIP(addr)
 	if userIP == nil {
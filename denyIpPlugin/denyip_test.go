@@ -0,0 +1,159 @@
+package denyip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func newTestHandler(t *testing.T, config *Config) *denyIP {
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "denyip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	return handler.(*denyIP)
+}
+
+func statusFor(handler http.Handler, remoteAddr string) int {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestCleanIP(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		testName string
+	}{
+		{"203.0.113.5", "203.0.113.5", "Plain IP"},
+		{" 203.0.113.5 ", "203.0.113.5", "Surrounding whitespace"},
+		{`"203.0.113.5"`, "203.0.113.5", "Double quoted"},
+		{"'203.0.113.5'", "203.0.113.5", "Single quoted"},
+		{"[203.0.113.5]", "203.0.113.5", "Bracketed"},
+		{`"[203.0.113.5]"`, "203.0.113.5", "Quoted and bracketed"},
+		{"203.0.113.5.", "203.0.113.5", "Trailing dot"},
+		{"[fe80::1%eth0]", "fe80::1", "Bracketed IPv6 with zone"},
+		{`"10.0.0.0/24"`, "10.0.0.0/24", "Quoted CIDR"},
+		{`"203.0.113.5`, `"203.0.113.5`, "Unbalanced quote"},
+	}
+
+	for _, test := range tests {
+		if got := cleanIP(test.input); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.testName, test.expected, got)
+		}
+	}
+}
+
+func TestQuotedAndBracketedEntries(t *testing.T) {
+	handler := newTestHandler(t, &Config{IPDenyList: []string{`"[203.0.113.5]"`, "203.0.113.6.", `"10.0.0.0/24"`}})
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.5:12345", http.StatusForbidden, "Quoted and bracketed entry"},
+		{"203.0.113.6:12345", http.StatusForbidden, "Entry with a trailing dot"},
+		{"10.0.0.7:12345", http.StatusForbidden, "Quoted CIDR entry"},
+		{"203.0.113.7:12345", http.StatusOK, "Unlisted IP"},
+	}
+
+	for _, test := range tests {
+		if code := statusFor(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestUpdateDenyList(t *testing.T) {
+	handler := newTestHandler(t, &Config{IPDenyList: []string{"10.0.0.1"}})
+
+	if code := statusFor(handler, "10.0.0.2:12345"); code != http.StatusOK {
+		t.Fatalf("Expected 200 before update, got %d", code)
+	}
+
+	if err := handler.UpdateDenyList([]string{"10.0.0.0/24"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"10.0.0.2:12345", http.StatusForbidden, "Newly denied range"},
+		{"10.0.1.1:12345", http.StatusOK, "Outside the new range"},
+	}
+
+	for _, test := range tests {
+		if code := statusFor(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestUpdateAllowList(t *testing.T) {
+	handler := newTestHandler(t, &Config{IPDenyList: []string{"10.0.0.0/24"}})
+
+	if err := handler.UpdateAllowList([]string{"10.0.0.5"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := statusFor(handler, "10.0.0.5:12345"); code != http.StatusOK {
+		t.Errorf("Expected allowed IP to pass, got %d", code)
+	}
+	if code := statusFor(handler, "10.0.0.6:12345"); code != http.StatusForbidden {
+		t.Errorf("Expected denied IP to stay blocked, got %d", code)
+	}
+
+	if err := handler.UpdateAllowList(nil); err != nil {
+		t.Fatalf("Unexpected error clearing the allow list: %v", err)
+	}
+	if code := statusFor(handler, "10.0.0.5:12345"); code != http.StatusForbidden {
+		t.Errorf("Expected IP to be denied once the allow list is cleared, got %d", code)
+	}
+}
+
+func TestUpdateListsInvalid(t *testing.T) {
+	handler := newTestHandler(t, &Config{IPDenyList: []string{"10.0.0.1"}})
+
+	if err := handler.UpdateDenyList([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected error for invalid deny list entry")
+	}
+	if err := handler.UpdateDenyList(nil); err == nil {
+		t.Error("Expected error for empty deny list")
+	}
+	if err := handler.UpdateAllowList([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected error for invalid allow list entry")
+	}
+
+	if code := statusFor(handler, "10.0.0.1:12345"); code != http.StatusForbidden {
+		t.Errorf("Expected previous deny list to be kept, got %d", code)
+	}
+}
+
+func TestUpdateListsConcurrent(t *testing.T) {
+	handler := newTestHandler(t, &Config{IPDenyList: []string{"10.0.0.1"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			statusFor(handler, "10.0.0.1:12345")
+		}()
+		go func() {
+			defer wg.Done()
+			_ = handler.UpdateDenyList([]string{"10.0.0.1", "10.0.0.2"})
+			_ = handler.UpdateAllowList([]string{"10.0.0.3"})
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,47 @@
+package denyip
+
+import "strings"
+
+// cleanIP strips surrounding whitespace, quotes and brackets, trailing dots
+// and IPv6 zones from an IP or CIDR string.
+//
+// This is a copy of ipsanitize.Clean from the blockip module. This plugin is
+// its own go1.18 module with no requirements, and Traefik loads it from its
+// own directory, so it cannot import the parent module without a require
+// and replace pair that would break standalone builds. Keep both copies in
+// sync.
+func cleanIP(s string) string {
+	for {
+		prev := s
+		s = strings.TrimSpace(s)
+		s = trimPair(s, '"', '"')
+		s = trimPair(s, '\'', '\'')
+		s = trimPair(s, '[', ']')
+		s = strings.TrimRight(s, ".")
+		s = stripZone(s)
+		if s == prev {
+			return s
+		}
+	}
+}
+
+// trimPair removes open and close from the ends of s when both are present
+func trimPair(s string, open, close byte) string {
+	if len(s) >= 2 && s[0] == open && s[len(s)-1] == close {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// stripZone removes the zone of a scoped IPv6 address such as "fe80::1%eth0",
+// keeping any CIDR suffix
+func stripZone(s string) string {
+	i := strings.IndexByte(s, '%')
+	if i < 0 || !strings.Contains(s[:i], ":") {
+		return s
+	}
+	if j := strings.IndexByte(s[i:], '/'); j >= 0 {
+		return s[:i] + s[i+j:]
+	}
+	return s[:i]
+}
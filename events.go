@@ -0,0 +1,51 @@
+package traefik_plugin_blockip
+
+import (
+	"net/http"
+	"time"
+)
+
+// DecisionEvent describes the decision made for a request
+type DecisionEvent struct {
+	Time       time.Time
+	ClientIP   string
+	Method     string
+	Host       string
+	Path       string
+	Decision   string // "allowed", "blocked" or "whitelisted"
+	Rule       string // the matched rule, "" when none matched
+	RuleSource string // the list file or feed the rule came from, if known
+	Country    string // resolved country, "" when not looked up
+	DryRun     bool
+}
+
+// Events returns the channel receiving an event for each decision, or nil
+// when eventBufferSize is 0. Events are dropped while the channel is full,
+// so a slow consumer never delays requests.
+func (b *BlockIP) Events() <-chan DecisionEvent {
+	return b.events
+}
+
+// emitEvent sends the event for a decision without blocking
+func (b *BlockIP) emitEvent(req *http.Request, clientIP string, d decision) {
+	event := DecisionEvent{
+		Time:       time.Now(),
+		ClientIP:   clientIP,
+		Method:     req.Method,
+		Host:       req.Host,
+		Path:       req.URL.Path,
+		Decision:   d.status,
+		Rule:       d.rule,
+		RuleSource: b.ruleSource(d.rule),
+		DryRun:     (b.dryRun || b.passthrough) && d.status == statusBlocked,
+	}
+	if d.geo != nil {
+		event.Country = d.geo.Country
+	}
+
+	select {
+	case b.events <- event:
+	default:
+		b.stats.eventsDropped.Add(1)
+	}
+}
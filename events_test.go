@@ -0,0 +1,108 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestDecisionEvents(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WhitelistIPs = []string{"10.0.0.1"}
+	config.EventBufferSize = 10
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	requestPath(b, "192.168.1.100:12345", "/login")
+	requestPath(b, "10.0.0.1:12345", "/admin")
+	requestPath(b, "203.0.113.5:12345", "/")
+	requestPath(b, "192.168.1.100:12345", "/again")
+
+	expected := []struct {
+		clientIP string
+		path     string
+		decision string
+		rule     string
+	}{
+		{"192.168.1.100", "/login", "blocked", "192.168.1.100"},
+		{"10.0.0.1", "/admin", "whitelisted", ""},
+		{"203.0.113.5", "/", "allowed", ""},
+		{"192.168.1.100", "/again", "blocked", "192.168.1.100"},
+	}
+
+	events := b.Events()
+	for i, want := range expected {
+		select {
+		case event := <-events:
+			if event.ClientIP != want.clientIP || event.Path != want.path || event.Decision != want.decision || event.Rule != want.rule {
+				t.Errorf("Event %d: expected %+v, got %+v", i, want, event)
+			}
+			if event.Method != "GET" || event.Time.IsZero() {
+				t.Errorf("Event %d: missing request details: %+v", i, event)
+			}
+		default:
+			t.Fatalf("Event %d: expected an event, channel is empty", i)
+		}
+	}
+
+	select {
+	case event := <-events:
+		t.Errorf("Expected no more events, got %+v", event)
+	default:
+	}
+}
+
+func TestDecisionEventsDropWhenFull(t *testing.T) {
+	config := CreateConfig()
+	config.EventBufferSize = 2
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	for i := 0; i < 5; i++ {
+		if code := requestFrom(b, "203.0.113.5:12345"); code != http.StatusOK {
+			t.Fatalf("Expected requests to be served with a full channel, got %d", code)
+		}
+	}
+
+	if n := len(b.Events()); n != 2 {
+		t.Errorf("Expected 2 buffered events, got %d", n)
+	}
+	if dropped := b.Stats()["events_dropped"]; dropped != 3 {
+		t.Errorf("Expected 3 dropped events, got %d", dropped)
+	}
+}
+
+func TestDecisionEventsDisabled(t *testing.T) {
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), CreateConfig(), "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	requestFrom(handler, "203.0.113.5:12345")
+	if events := handler.(*BlockIP).Events(); events != nil {
+		t.Error("Expected no event channel without eventBufferSize")
+	}
+
+	config := CreateConfig()
+	config.EventBufferSize = -1
+	if _, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test"); err == nil {
+		t.Error("Expected error for negative eventBufferSize")
+	}
+}
@@ -0,0 +1,118 @@
+package traefik_plugin_blockip
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+)
+
+// addrRange is an inclusive range of addresses of a single family
+type addrRange struct {
+	from netip.Addr
+	to   netip.Addr
+}
+
+// ExportMergedCIDRs returns the blocked IPs and CIDRs as a minimal list of
+// CIDRs covering exactly the same addresses, IPv4 first. Single IPs become
+// /32 or /128 networks, and negated CIDRs contribute everything outside them.
+func (b *BlockIP) ExportMergedCIDRs() []string {
+	return mergeRanges(b.lookup.blockedRanges())
+}
+
+// blockedRanges returns the address range of every blocked IP and CIDR
+func (s *ipLookupService) blockedRanges() []addrRange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ranges := make([]addrRange, 0, len(s.blockedIPsSet)+len(s.blockedNets))
+	for ip := range s.blockedIPsSet {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			addr = addr.Unmap().WithZone("")
+			ranges = append(ranges, addrRange{from: addr, to: addr})
+		}
+	}
+	for _, ipnet := range s.blockedNets {
+		if prefix, ok := netPrefix(ipnet); ok {
+			ranges = append(ranges, addrRange{from: prefix.Addr(), to: lastAddr(prefix)})
+		}
+	}
+	return append(ranges, s.negatedRanges()...)
+}
+
+// netPrefix converts ipnet to a masked prefix. IPv4-mapped IPv6 networks
+// become IPv4 prefixes, as they match IPv4 addresses.
+func netPrefix(ipnet *net.IPNet) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(ipnet.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, bits := ipnet.Mask.Size()
+	if bits == 0 {
+		return netip.Prefix{}, false
+	}
+	if addr.Is4In6() && bits == 128 && ones >= 96 {
+		addr, ones = addr.Unmap(), ones-96
+	}
+	return netip.PrefixFrom(addr, ones).Masked(), true
+}
+
+// lastAddr returns the highest address in prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// mergeRanges merges overlapping and adjacent ranges and splits the result
+// into the fewest CIDRs
+func mergeRanges(ranges []addrRange) []string {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].from.Less(ranges[j].from)
+	})
+
+	merged := make([]addrRange, 0, len(ranges))
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			next := last.to.Next()
+			if last.from.Is4() == r.from.Is4() && (!next.IsValid() || r.from.Compare(next) <= 0) {
+				if last.to.Less(r.to) {
+					last.to = r.to
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+
+	cidrs := make([]string, 0, len(merged))
+	for _, r := range merged {
+		cidrs = appendRangeCIDRs(cidrs, r)
+	}
+	return cidrs
+}
+
+// appendRangeCIDRs appends the fewest CIDRs covering r to cidrs
+func appendRangeCIDRs(cidrs []string, r addrRange) []string {
+	from := r.from
+	for {
+		// The largest aligned prefix starting at from that stays within r
+		var prefix netip.Prefix
+		for ones := 0; ones <= from.BitLen(); ones++ {
+			prefix = netip.PrefixFrom(from, ones)
+			if prefix.Masked().Addr() == from && lastAddr(prefix).Compare(r.to) <= 0 {
+				break
+			}
+		}
+		cidrs = append(cidrs, prefix.String())
+
+		last := lastAddr(prefix)
+		if last.Compare(r.to) >= 0 {
+			return cidrs
+		}
+		from = last.Next()
+	}
+}
@@ -0,0 +1,109 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestExportMergedCIDRs(t *testing.T) {
+	tests := []struct {
+		ips      []string
+		cidrs    []string
+		expected []string
+		testName string
+	}{
+		{[]string{"192.0.2.1"}, nil, []string{"192.0.2.1/32"}, "Single IP"},
+		{[]string{"192.0.2.0", "192.0.2.1", "192.0.2.2", "192.0.2.3"}, nil, []string{"192.0.2.0/30"}, "Adjacent IPs"},
+		{nil, []string{"10.0.0.0/24", "10.0.1.0/24"}, []string{"10.0.0.0/23"}, "Adjacent networks"},
+		{[]string{"10.0.0.5"}, []string{"10.0.0.0/8", "10.1.0.0/16"}, []string{"10.0.0.0/8"}, "Nested entries"},
+		{nil, []string{"10.0.1.0/24", "10.0.2.0/24"}, []string{"10.0.1.0/24", "10.0.2.0/24"}, "Unaligned neighbours stay apart"},
+		{[]string{"192.0.2.4"}, []string{"192.0.2.0/30"}, []string{"192.0.2.0/30", "192.0.2.4/32"}, "Range split into aligned blocks"},
+		{[]string{"2001:db8::1"}, []string{"2001:db8::/127", "192.0.2.0/24"}, []string{"192.0.2.0/24", "2001:db8::/127"}, "Both families"},
+		{nil, []string{"0.0.0.0/1", "128.0.0.0/1", "::/0"}, []string{"0.0.0.0/0", "::/0"}, "Whole address space"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = test.ips
+		config.BlockedCIDRs = test.cidrs
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		if merged := handler.(*BlockIP).ExportMergedCIDRs(); !reflect.DeepEqual(merged, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.testName, test.expected, merged)
+		}
+	}
+}
+
+func TestExportMergedCIDRsCoverage(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"10.0.0.255", "10.0.2.0", "10.0.2.1", "172.16.255.255", "2001:db8::ffff"}
+	config.BlockedCIDRs = append(sparseCIDRs(300), "10.0.1.0/24", "172.17.0.0/16", "2001:db8::/112", "2001:db8::1:0/112")
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	merged := b.ExportMergedCIDRs()
+	nets := make([]*net.IPNet, 0, len(merged))
+	for _, cidr := range merged {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Invalid merged CIDR %s: %v", cidr, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	if len(merged) >= len(config.BlockedIPs)+len(config.BlockedCIDRs) {
+		t.Errorf("Expected fewer merged CIDRs than entries, got %d", len(merged))
+	}
+
+	// Probe the edges of every input and merged range and their neighbours
+	probes := make([]net.IP, 0)
+	for _, r := range append(b.lookup.blockedRanges(), rangesOf(t, merged)...) {
+		for _, addr := range []string{r.from.Prev().String(), r.from.String(), r.to.String(), r.to.Next().String()} {
+			if ip := net.ParseIP(addr); ip != nil {
+				probes = append(probes, ip)
+			}
+		}
+	}
+
+	for _, ip := range probes {
+		_, expected := b.lookup.matchBlocked(ip.String())
+		covered := false
+		for _, ipnet := range nets {
+			if ipnet.Contains(ip) {
+				covered = true
+				break
+			}
+		}
+		if covered != expected {
+			t.Errorf("IP %s: blocked %v but covered by merged CIDRs %v", ip, expected, covered)
+		}
+	}
+}
+
+// rangesOf returns the address ranges of cidrs
+func rangesOf(t *testing.T, cidrs []string) []addrRange {
+	ranges := make([]addrRange, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Invalid CIDR %s: %v", cidr, err)
+		}
+		prefix, _ := netPrefix(ipnet)
+		ranges = append(ranges, addrRange{from: prefix.Addr(), to: lastAddr(prefix)})
+	}
+	return ranges
+}
@@ -0,0 +1,82 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
+)
+
+// familyCounts holds the number of IPv4 and IPv6 list entries
+type familyCounts struct {
+	ipv4 int
+	ipv6 int
+}
+
+// addFamilyEntries adds IP and CIDR entries to the block list, rejecting
+// entries that are not of the section's address family
+func (b *BlockIP) addFamilyEntries(field string, entries []string, ipv6 bool) error {
+	for _, entry := range entries {
+		entry = ipsanitize.Clean(entry)
+
+		isIPv6, err := entryIsIPv6(entry)
+		if err != nil {
+			return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid %s entry %q", field, entry), err)
+		}
+		if isIPv6 != ipv6 {
+			return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("%s entry %q has the wrong address family", field, entry), nil)
+		}
+
+		if err := b.addBlockedEntry(entry); err != nil {
+			return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid %s entry %q", field, entry), err)
+		}
+	}
+	return nil
+}
+
+// entryIsIPv6 reports whether an IP or CIDR entry is written as IPv6
+func entryIsIPv6(entry string) (bool, error) {
+	addr := entry
+	if strings.Contains(entry, "/") {
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return false, err
+		}
+		addr = entry[:strings.Index(entry, "/")]
+	} else if !isValidIP(entry) {
+		return false, fmt.Errorf("invalid IP format: %s", entry)
+	}
+	return strings.Contains(addr, ":"), nil
+}
+
+// familyCounts counts block and whitelist entries per address family
+func (s *ipLookupService) familyCounts() (blocked, whitelist familyCounts) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	countIPs(s.blockedIPsSet, &blocked)
+	countNets(s.blockedNets, &blocked)
+	countIPs(s.whitelistIPsSet, &whitelist)
+	countNets(s.whitelistNets, &whitelist)
+	return blocked, whitelist
+}
+
+func countIPs(ips map[string]bool, counts *familyCounts) {
+	for ip := range ips {
+		if strings.Contains(ip, ":") {
+			counts.ipv6++
+		} else {
+			counts.ipv4++
+		}
+	}
+}
+
+func countNets(nets []*net.IPNet, counts *familyCounts) {
+	for _, ipnet := range nets {
+		if len(ipnet.Mask) == net.IPv4len {
+			counts.ipv4++
+		} else {
+			counts.ipv6++
+		}
+	}
+}
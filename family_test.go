@@ -0,0 +1,100 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestFamilySections(t *testing.T) {
+	tests := []struct {
+		ipv4        []string
+		ipv6        []string
+		expectError bool
+		testName    string
+	}{
+		{[]string{"192.168.1.100", "10.0.0.0/8"}, []string{"2001:db8::1", "2001:db8:1::/48"}, false, "Matching families"},
+		{[]string{"2001:db8::1"}, nil, true, "IPv6 address in IPv4 section"},
+		{[]string{"2001:db8::/32"}, nil, true, "IPv6 CIDR in IPv4 section"},
+		{nil, []string{"192.168.1.100"}, true, "IPv4 address in IPv6 section"},
+		{nil, []string{"10.0.0.0/8"}, true, "IPv4 CIDR in IPv6 section"},
+		{nil, []string{"::ffff:192.168.1.100"}, false, "IPv4-mapped address in IPv6 section"},
+		{[]string{"not-an-ip"}, nil, true, "Invalid entry"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPv4 = test.ipv4
+		config.BlockedIPv6 = test.ipv6
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if test.expectError && err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+		}
+	}
+}
+
+func TestFamilySectionsBlock(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPv4 = []string{"192.168.1.100"}
+	config.BlockedIPv6 = []string{"2001:db8::/32"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"192.168.1.100:12345", 403, "IPv4 section entry"},
+		{"[2001:db8::5]:12345", 403, "IPv6 section entry"},
+		{"8.8.8.8:12345", 200, "Unlisted IP"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestFamilyStats(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100", "2001:db8::1"}
+	config.BlockedCIDRs = []string{"10.0.0.0/8"}
+	config.BlockedIPv6 = []string{"2001:db8:1::/48", "2001:db8:2::/48"}
+	config.WhitelistIPs = []string{"2001:db8::2"}
+	config.WhitelistCIDRs = []string{"172.16.0.0/12"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	stats := handler.(*BlockIP).Stats()
+	expected := map[string]int64{
+		"blocked_ipv4":   2,
+		"blocked_ipv6":   3,
+		"whitelist_ipv4": 1,
+		"whitelist_ipv6": 1,
+	}
+
+	for name, value := range expected {
+		if stats[name] != value {
+			t.Errorf("Expected %s to be %d, got %d", name, value, stats[name])
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package traefik_plugin_blockip
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Block response body formats
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// parseResponseFormat validates the block response format, defaulting to text
+func parseResponseFormat(format string) (string, error) {
+	switch format {
+	case "", formatText:
+		return formatText, nil
+	case formatJSON:
+		return formatJSON, nil
+	default:
+		return "", NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid response format: %q, must be %q or %q", format, formatText, formatJSON), nil)
+	}
+}
+
+// formatContentType returns the Content-Type of block responses in format
+func formatContentType(format string) string {
+	if format == formatJSON {
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// newBlockResponse pre-renders the block response for message and
+// statusCode in the configured format
+func (b *BlockIP) newBlockResponse(statusCode int, message string) blockResponse {
+	response := blockResponse{statusCode: statusCode, body: []byte(message), message: message}
+	if b.responseFormat == formatJSON {
+		// Marshaling a string and an int cannot fail
+		response.body, _ = json.Marshal(struct {
+			Error  string `json:"error"`
+			Status int    `json:"status"`
+		}{message, statusCode})
+	}
+	return response
+}
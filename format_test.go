@@ -0,0 +1,227 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		format      string
+		remoteAddr  string
+		expected    int
+		contentType string
+		body        string
+		testName    string
+	}{
+		{"", "192.168.1.100:12345", 403, "text/plain; charset=utf-8", "Access Denied", "Text by default"},
+		{"text", "192.168.1.100:12345", 403, "text/plain; charset=utf-8", "Access Denied", "Explicit text"},
+		{"json", "192.168.1.100:12345", 403, "application/json", `{"error":"Access Denied","status":403}`, "JSON"},
+		{"json", "198.51.100.7:12345", 451, "application/json", `{"error":"Unavailable \"here\"","status":451}`, "JSON group response"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.ResponseFormat = test.format
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.ListGroups = []ListGroup{{Name: "legal", BlockedIPs: []string{"198.51.100.7"}, StatusCode: 451, Message: `Unavailable "here"`}}
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Errorf("%s: expected Content-Type %q, got %q", test.testName, test.contentType, contentType)
+		}
+		if body := w.Body.String(); body != test.body {
+			t.Errorf("%s: expected body %q, got %q", test.testName, test.body, body)
+		}
+	}
+}
+
+func TestResponseFormatJSONRateLimit(t *testing.T) {
+	config := CreateConfig()
+	config.ResponseFormat = "json"
+	config.RateLimit = 1
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.1:12345"
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+	}
+
+	expected := `{"error":"Too Many Requests","status":429}`
+	if w.Code != http.StatusTooManyRequests || w.Body.String() != expected {
+		t.Errorf("Expected 429 with %s, got %d with %s", expected, w.Code, w.Body.String())
+	}
+}
+
+func TestInvalidResponseFormat(t *testing.T) {
+	config := CreateConfig()
+	config.ResponseFormat = "xml"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	var blockErr *BlockIPError
+	if !errors.As(err, &blockErr) || blockErr.Code != ErrCodeInvalidConfig {
+		t.Fatalf("Expected %s error for invalid response format, got %v", ErrCodeInvalidConfig, err)
+	}
+}
+
+func TestStripResponseHeaders(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.StripResponseHeaders = []string{"x-cache", "CF-Cache-Status", " Via ", ""}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		stripped   bool
+		testName   string
+	}{
+		{"192.168.1.100:12345", 403, true, "Stripped from block response"},
+		{"192.168.1.50:12345", 200, false, "Kept on allowed response"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+
+		// Headers injected by middlewares running before the plugin
+		w := httptest.NewRecorder()
+		w.Header().Set("X-Cache", "HIT")
+		w.Header().Set("CF-Cache-Status", "DYNAMIC")
+		w.Header().Set("Via", "1.1 edge")
+		w.Header().Set("X-Request-Id", "abc")
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+		for _, header := range []string{"X-Cache", "CF-Cache-Status", "Via"} {
+			if present := w.Header().Get(header) != ""; present == test.stripped {
+				t.Errorf("%s: expected %s present %v, got %v", test.testName, header, !test.stripped, present)
+			}
+		}
+		if w.Header().Get("X-Request-Id") == "" {
+			t.Errorf("%s: expected unlisted header to be kept", test.testName)
+		}
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.ResponseHeaders = map[string]string{
+		"X-Block-Reason":              "ip-blocklist",
+		"access-control-allow-origin": "*",
+		" X-Cache ":                   "MISS",
+	}
+	config.StripResponseHeaders = []string{"X-Cache"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		headers    bool
+		testName   string
+	}{
+		{"192.168.1.100:12345", 403, true, "Set on block response"},
+		{"192.168.1.50:12345", 200, false, "Not set on allowed response"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+
+		w := httptest.NewRecorder()
+		w.Header().Set("X-Cache", "HIT")
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+		if !test.headers {
+			if reason := w.Header().Get("X-Block-Reason"); reason != "" {
+				t.Errorf("%s: expected no X-Block-Reason, got %q", test.testName, reason)
+			}
+			continue
+		}
+
+		expected := map[string]string{
+			"X-Block-Reason":              "ip-blocklist",
+			"Access-Control-Allow-Origin": "*",
+			"X-Cache":                     "MISS",
+		}
+		for header, value := range expected {
+			if got := w.Header().Get(header); got != value {
+				t.Errorf("%s: expected %s %q, got %q", test.testName, header, value, got)
+			}
+		}
+	}
+}
+
+func TestInvalidResponseHeaders(t *testing.T) {
+	tests := []struct {
+		headers  map[string]string
+		testName string
+	}{
+		{map[string]string{"": "value"}, "Empty name"},
+		{map[string]string{"  ": "value"}, "Blank name"},
+		{map[string]string{"X-Bad Name": "value"}, "Name with a space"},
+		{map[string]string{"X-Reason": "a\r\nX-Injected: 1"}, "Value with a line break"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.ResponseHeaders = test.headers
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		var blockErr *BlockIPError
+		if !errors.As(err, &blockErr) || blockErr.Code != ErrCodeInvalidConfig {
+			t.Errorf("%s: expected %s error, got %v", test.testName, ErrCodeInvalidConfig, err)
+		}
+	}
+}
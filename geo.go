@@ -0,0 +1,196 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// continentCodes are the continent codes used by GeoIP databases
+var continentCodes = map[string]bool{
+	"AF": true, "AN": true, "AS": true, "EU": true, "NA": true, "OC": true, "SA": true,
+}
+
+// GeoRecord holds the geolocation attributes resolved for an IP
+type GeoRecord struct {
+	Country   string // ISO 3166-1 alpha-2 country code
+	Continent string // two-letter continent code
+	Region    string // ISO 3166-2 subdivision code without the country, e.g. "CA"
+	ASN       uint32 // autonomous system number, 0 when unknown
+}
+
+// geoContextKey is the request context key of the resolved GeoRecord
+type geoContextKey struct{}
+
+// GeoRecordFromContext returns the GeoRecord resolved for the request, if
+// geo-blocking looked it up
+func GeoRecordFromContext(ctx context.Context) (*GeoRecord, bool) {
+	record, ok := ctx.Value(geoContextKey{}).(*GeoRecord)
+	return record, ok
+}
+
+// withGeoRecord returns req carrying record in its context
+func withGeoRecord(req *http.Request, record *GeoRecord) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), geoContextKey{}, record))
+}
+
+// GeoResolver resolves IPs to geolocation records
+type GeoResolver interface {
+	Lookup(ip net.IP) (*GeoRecord, error)
+}
+
+// SetGeoResolver installs the resolver used for geo-blocking. It must be
+// called before the handler starts serving requests.
+func (b *BlockIP) SetGeoResolver(r GeoResolver) {
+	b.geoResolver = r
+}
+
+// parseContinents validates and normalizes continent codes
+func parseContinents(codes []string) (map[string]bool, error) {
+	continents := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !continentCodes[code] {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid continent code %q", code), nil)
+		}
+		continents[code] = true
+	}
+	return continents, nil
+}
+
+// parseCountries validates and normalizes ISO 3166-1 alpha-2 country codes
+func parseCountries(field string, codes []string) (map[string]bool, error) {
+	countries := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if len(code) != 2 || !isAlpha(code) {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid country code %q in %s", code, field), nil)
+		}
+		countries[code] = true
+	}
+	return countries, nil
+}
+
+// parseRegions validates and normalizes ISO 3166-2 region codes such as
+// "US-CA"
+func parseRegions(codes []string) (map[string]bool, error) {
+	regions := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		country, subdivision, ok := strings.Cut(code, "-")
+		if !ok || len(country) != 2 || !isAlpha(country) || len(subdivision) == 0 || len(subdivision) > 3 || !isAlphanumeric(subdivision) {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid region code %q, expected e.g. \"US-CA\"", code), nil)
+		}
+		regions[code] = true
+	}
+	return regions, nil
+}
+
+// isAlpha reports whether s only holds the letters A to Z
+func isAlpha(s string) bool {
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// isAlphanumeric reports whether s only holds the letters A to Z and digits
+func isAlphanumeric(s string) bool {
+	for _, c := range s {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseASNs validates autonomous system numbers
+func parseASNs(asns []int) (map[uint32]bool, error) {
+	parsed := make(map[uint32]bool, len(asns))
+	for _, asn := range asns {
+		if asn <= 0 || uint64(asn) > math.MaxUint32 {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid ASN %d in blockedASNs", asn), nil)
+		}
+		parsed[uint32(asn)] = true
+	}
+	return parsed, nil
+}
+
+// asnGeoResolver adds the ASN resolved from a separate ASN database to the
+// records of a country resolver
+type asnGeoResolver struct {
+	country GeoResolver
+	asn     GeoResolver
+}
+
+// Lookup resolves ip with both resolvers and merges the records
+func (r asnGeoResolver) Lookup(ip net.IP) (*GeoRecord, error) {
+	record, err := r.country.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+	asnRecord, err := r.asn.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+	if asnRecord == nil || asnRecord.ASN == 0 {
+		return record, nil
+	}
+	if record == nil {
+		return &GeoRecord{ASN: asnRecord.ASN}, nil
+	}
+	merged := *record
+	merged.ASN = asnRecord.ASN
+	return &merged, nil
+}
+
+// resolveGeo looks up clientIP when a geo-based rule is configured. It
+// returns nil when there is nothing to resolve or the lookup fails.
+func (b *BlockIP) resolveGeo(clientIP string) *GeoRecord {
+	if b.geoResolver == nil || (len(b.blockedContinents) == 0 && len(b.blockedCountries) == 0 &&
+		len(b.whitelistCountries) == 0 && len(b.blockedASNs) == 0 && len(b.blockedRegions) == 0 &&
+		!b.compositeRulesUseGeo()) {
+		return nil
+	}
+
+	record, err := b.geoResolver.Lookup(net.ParseIP(clientIP))
+	if err != nil {
+		if b.debug {
+			b.logger.Debug("[%s] GeoIP lookup failed for IP %s: %v", b.name, clientIP, err)
+		}
+		return nil
+	}
+	if record != nil && b.logGeoResolution {
+		b.logger.Info("[%s] IP %s resolved to country %s, continent %s, ASN %d", b.name, clientIP, record.Country, record.Continent, record.ASN)
+	}
+	return record
+}
+
+// matchGeo returns the geo rule record is blocked by, if any
+func (b *BlockIP) matchGeo(record *GeoRecord) (string, bool) {
+	if record == nil {
+		return "", false
+	}
+
+	if country := strings.ToUpper(record.Country); b.blockedCountries[country] {
+		return "country:" + country, true
+	}
+	if record.Region != "" {
+		if region := strings.ToUpper(record.Country + "-" + record.Region); b.blockedRegions[region] {
+			return "region:" + region, true
+		}
+	}
+	if continent := strings.ToUpper(record.Continent); b.blockedContinents[continent] {
+		return "continent:" + continent, true
+	}
+	if record.ASN != 0 && b.blockedASNs[record.ASN] {
+		return fmt.Sprintf("asn:%d", record.ASN), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,408 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockGeoResolver resolves IPs from a fixed table
+type mockGeoResolver map[string]*GeoRecord
+
+func (m mockGeoResolver) Lookup(ip net.IP) (*GeoRecord, error) {
+	record, ok := m[ip.String()]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return record, nil
+}
+
+func TestContinentBlocking(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedContinents = []string{"af", "AS"}
+	config.WhitelistIPs = []string{"203.0.113.9"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	handler.(*BlockIP).SetGeoResolver(mockGeoResolver{
+		"203.0.113.5":  {Country: "NG", Continent: "AF"},
+		"203.0.113.6":  {Country: "JP", Continent: "AS"},
+		"203.0.113.7":  {Country: "DE", Continent: "EU"},
+		"203.0.113.9":  {Country: "CN", Continent: "AS"},
+		"2001:db8::15": {Country: "KE", Continent: "AF"},
+	})
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.5:12345", 403, "Blocked continent AF"},
+		{"203.0.113.6:12345", 403, "Blocked continent AS"},
+		{"[2001:db8::15]:12345", 403, "Blocked continent over IPv6"},
+		{"203.0.113.7:12345", 200, "Allowed continent"},
+		{"203.0.113.9:12345", 200, "Whitelist beats continent"},
+		{"198.51.100.1:12345", 200, "Unresolved IP"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestInvalidContinentCode(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedContinents = []string{"XX"}
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid continent code")
+	}
+}
+
+func TestGeoResolutionLogging(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedContinents = []string{"AF"}
+	config.LogGeoResolution = true
+
+	var received *GeoRecord
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = GeoRecordFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	handler.(*BlockIP).SetGeoResolver(mockGeoResolver{
+		"203.0.113.5": {Country: "NG", Continent: "AF", ASN: 37148},
+		"203.0.113.7": {Country: "DE", Continent: "EU", ASN: 3320},
+	})
+
+	output := captureStdout(t, func() {
+		requestFrom(handler, "203.0.113.5:12345")
+		requestFrom(handler, "203.0.113.7:12345")
+	})
+
+	for _, want := range []string{
+		"IP 203.0.113.5 resolved to country NG, continent AF, ASN 37148",
+		"IP 203.0.113.7 resolved to country DE, continent EU, ASN 3320",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected log line %q, got output %q", want, output)
+		}
+	}
+
+	if received == nil || received.Country != "DE" || received.ASN != 3320 {
+		t.Errorf("Expected resolved record in the request context, got %+v", received)
+	}
+
+	// Cached decisions keep the record without resolving again
+	received = nil
+	output = captureStdout(t, func() {
+		requestFrom(handler, "203.0.113.7:12345")
+	})
+	if strings.Contains(output, "resolved to") {
+		t.Errorf("Expected cached decision not to resolve again, got output %q", output)
+	}
+	if received == nil || received.Country != "DE" {
+		t.Errorf("Expected cached record in the request context, got %+v", received)
+	}
+}
+
+func TestGeoResolutionNotLoggedByDefault(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedContinents = []string{"AF"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	handler.(*BlockIP).SetGeoResolver(mockGeoResolver{"203.0.113.5": {Country: "NG", Continent: "AF"}})
+
+	output := captureStdout(t, func() {
+		requestFrom(handler, "203.0.113.5:12345")
+	})
+	if strings.Contains(output, "resolved to") {
+		t.Errorf("Expected no resolution log without logGeoResolution, got output %q", output)
+	}
+}
+
+func TestCountryBlocking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	writeMMDB(t, path, time.Now(), map[string]GeoRecord{
+		"203.0.113.0/26":   {Country: "RU", Continent: "EU"},
+		"203.0.113.64/26":  {Country: "CN", Continent: "AS"},
+		"203.0.113.128/26": {Country: "DE", Continent: "EU"},
+	})
+
+	config := CreateConfig()
+	config.GeoIPDatabase = path
+	config.BlockedCountries = []string{"ru", "CN"}
+	config.WhitelistCountries = []string{"cn"}
+	config.BlockedIPs = []string{"203.0.113.130"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.5:12345", 403, "Blocked country"},
+		{"203.0.113.70:12345", 200, "Whitelisted country beats blocked country"},
+		{"203.0.113.129:12345", 200, "Allowed country"},
+		{"203.0.113.130:12345", 403, "Blocked IP in allowed country"},
+		{"198.51.100.1:12345", 200, "Unresolved IP"},
+	}
+
+	for _, test := range tests {
+		// twice, so the second decision comes from the cache
+		for i := 0; i < 2; i++ {
+			if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+				t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, code)
+			}
+		}
+	}
+}
+
+func TestCountryConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	writeMMDB(t, path, time.Now(), map[string]GeoRecord{"203.0.113.0/24": {Country: "RU"}})
+
+	tests := []struct {
+		configure func(*Config)
+		expectErr bool
+		testName  string
+	}{
+		{func(c *Config) { c.BlockedCountries = []string{"R1"} }, true, "Invalid blocked country"},
+		{func(c *Config) { c.WhitelistCountries = []string{"USA"} }, true, "Invalid whitelisted country"},
+		{func(c *Config) { c.GeoIPDatabase = filepath.Join(t.TempDir(), "missing.mmdb") }, true, "Missing database"},
+		{func(c *Config) { c.GeoIPDatabase = path; c.GeoDatabaseFile = path + ".old" }, true, "Conflicting database paths"},
+		{func(c *Config) { c.GeoIPDatabase = path; c.GeoDatabaseFile = path }, false, "Same database path twice"},
+		{func(c *Config) { c.BlockedCountries = []string{"RU"} }, false, "Countries without a database"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		test.configure(config)
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if test.expectErr && err == nil {
+			t.Errorf("%s: expected error, got nil", test.testName)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+		}
+	}
+}
+
+// countingGeoResolver counts the lookups passed to its resolver
+type countingGeoResolver struct {
+	resolver GeoResolver
+	lookups  int
+}
+
+func (c *countingGeoResolver) Lookup(ip net.IP) (*GeoRecord, error) {
+	c.lookups++
+	return c.resolver.Lookup(ip)
+}
+
+func TestASNBlocking(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedASNs = []int{64500, 64501}
+	config.WhitelistIPs = []string{"203.0.113.9"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	resolver := &countingGeoResolver{resolver: mockGeoResolver{
+		"203.0.113.5": {Country: "US", ASN: 64500},
+		"203.0.113.6": {Country: "DE", ASN: 64501},
+		"203.0.113.7": {Country: "DE", ASN: 64502},
+		"203.0.113.8": {Country: "DE"},
+		"203.0.113.9": {Country: "US", ASN: 64500},
+	}}
+	handler.(*BlockIP).SetGeoResolver(resolver)
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.5:12345", 403, "Blocked ASN"},
+		{"203.0.113.6:12345", 403, "Second blocked ASN"},
+		{"203.0.113.7:12345", 200, "Allowed ASN"},
+		{"203.0.113.8:12345", 200, "Unknown ASN"},
+		{"203.0.113.9:12345", 200, "Whitelist beats ASN"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, code)
+		}
+	}
+
+	lookups := resolver.lookups
+	for _, test := range tests {
+		requestFrom(handler, test.remoteAddr)
+	}
+	if resolver.lookups != lookups {
+		t.Errorf("Expected cached decisions to skip ASN lookups, got %d more", resolver.lookups-lookups)
+	}
+}
+
+func TestASNDatabase(t *testing.T) {
+	dir := t.TempDir()
+	countryPath := filepath.Join(dir, "GeoLite2-Country.mmdb")
+	asnPath := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	writeMMDB(t, countryPath, time.Now(), map[string]GeoRecord{
+		"203.0.113.0/24": {Country: "DE", Continent: "EU"},
+	})
+	writeMMDB(t, asnPath, time.Now(), map[string]GeoRecord{
+		"203.0.113.0/25":  {ASN: 64500},
+		"198.51.100.0/24": {ASN: 64500},
+	})
+
+	tests := []struct {
+		countryDatabase string
+		remoteAddr      string
+		expected        int
+		testName        string
+	}{
+		{countryPath, "203.0.113.5:12345", 403, "Blocked ASN with country database"},
+		{countryPath, "203.0.113.200:12345", 200, "Unblocked ASN with country database"},
+		{countryPath, "198.51.100.1:12345", 403, "Blocked ASN outside country database"},
+		{"", "203.0.113.5:12345", 403, "Blocked ASN without country database"},
+		{"", "192.0.2.1:12345", 200, "Unresolved IP"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.GeoIPDatabase = test.countryDatabase
+		config.GeoIPASNDatabase = asnPath
+		config.BlockedASNs = []int{64500}
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestASNConfig(t *testing.T) {
+	tests := []struct {
+		configure func(*Config)
+		testName  string
+	}{
+		{func(c *Config) { c.BlockedASNs = []int{0} }, "Zero ASN"},
+		{func(c *Config) { c.BlockedASNs = []int{-1} }, "Negative ASN"},
+		{func(c *Config) { c.GeoIPASNDatabase = filepath.Join(t.TempDir(), "missing.mmdb") }, "Missing ASN database"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		test.configure(config)
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", test.testName)
+		}
+	}
+}
+
+func TestRegionBlocking(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedRegions = []string{"us-ca", "DE-BY"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	handler.(*BlockIP).SetGeoResolver(mockGeoResolver{
+		"203.0.113.5": {Country: "US", Continent: "NA", Region: "CA"},
+		"203.0.113.6": {Country: "DE", Continent: "EU", Region: "BY"},
+		"203.0.113.7": {Country: "US", Continent: "NA", Region: "NY"},
+		"203.0.113.8": {Country: "CA", Continent: "NA", Region: "ON"},
+		"203.0.113.9": {Country: "US", Continent: "NA"},
+	})
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.5:12345", 403, "Blocked region"},
+		{"203.0.113.6:12345", 403, "Second blocked region"},
+		{"203.0.113.7:12345", 200, "Other region of the same country"},
+		{"203.0.113.8:12345", 200, "Region code of another country"},
+		{"203.0.113.9:12345", 200, "No region"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestInvalidRegionCode(t *testing.T) {
+	for _, code := range []string{"CA", "USA-CA", "US-", "US-CALI", "U1-CA"} {
+		config := CreateConfig()
+		config.BlockedRegions = []string{code}
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("Expected error for region code %q", code)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
+)
+
+// actionLog only records an event without changing the decision
+const actionLog = "log"
+
+// ruleHeaderConflict identifies blocks of requests with conflicting IP headers
+const ruleHeaderConflict = "header-conflict"
+
+// parseHeaderConflictAction validates the header conflict action
+func parseHeaderConflictAction(action string) (bool, error) {
+	switch action {
+	case "", actionLog:
+		return false, nil
+	case actionBlock:
+		return true, nil
+	default:
+		return false, NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid header conflict action: %q, must be %q or %q", action, actionLog, actionBlock), nil)
+	}
+}
+
+// sourceRemoteAddr names the connection's peer address in the client IP
+// source chain
+const sourceRemoteAddr = "RemoteAddr"
+
+// ClientIPSource is a step of the client IP source chain. Header names a
+// request header, or "RemoteAddr" for the connection's peer address. The
+// header is only honored from peers within TrustedProxies, which defaults to
+// the global trustedProxies; with neither set any peer is trusted.
+type ClientIPSource struct {
+	Header         string   `json:"header"`
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+}
+
+// ipSource is a parsed ClientIPSource
+type ipSource struct {
+	header         string
+	trustedProxies []*net.IPNet
+}
+
+// trusts reports whether the source may be honored from peer
+func (s ipSource) trusts(peer string) bool {
+	return len(s.trustedProxies) == 0 || containsIP(s.trustedProxies, peer)
+}
+
+// loadClientIPSources builds the client IP source chain. Without configured
+// sources the chain is headers followed by RemoteAddr, all trusting
+// trustedProxies.
+func loadClientIPSources(sources []ClientIPSource, headers []string, trustedProxies []*net.IPNet) ([]ipSource, error) {
+	if len(sources) == 0 {
+		chain := make([]ipSource, 0, len(headers)+1)
+		for _, header := range cleanHeaderNames(headers) {
+			chain = append(chain, ipSource{header: header, trustedProxies: trustedProxies})
+		}
+		return append(chain, ipSource{header: sourceRemoteAddr}), nil
+	}
+
+	chain := make([]ipSource, 0, len(sources))
+	for i, source := range sources {
+		header := strings.TrimSpace(source.Header)
+		if header == "" {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("clientIPSources[%d] has no header", i), nil)
+		}
+		if strings.EqualFold(header, sourceRemoteAddr) {
+			if len(source.TrustedProxies) > 0 {
+				return nil, NewBlockIPError(ErrCodeInvalidConfig, "the RemoteAddr client IP source cannot have trustedProxies", nil)
+			}
+			chain = append(chain, ipSource{header: sourceRemoteAddr})
+			continue
+		}
+
+		proxies, err := parseNetworks(fmt.Sprintf("clientIPSources[%d].trustedProxies", i), source.TrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		if len(proxies) == 0 {
+			proxies = trustedProxies
+		}
+		chain = append(chain, ipSource{header: header, trustedProxies: proxies})
+	}
+	return chain, nil
+}
+
+// cdnClientIPHeaders maps each CDN provider preset to the header carrying
+// the client IP it saw
+var cdnClientIPHeaders = map[string]string{
+	"cloudflare": "CF-Connecting-IP",
+	"akamai":     "True-Client-IP",
+	"fastly":     "Fastly-Client-IP",
+	"cloudfront": "CloudFront-Viewer-Address",
+}
+
+// cdnHeaders returns the client IP headers of a CDN provider preset. Only
+// the CDN's own header is honored, so X-Forwarded-For is ignored.
+func cdnHeaders(provider string) ([]string, error) {
+	header, ok := cdnClientIPHeaders[strings.ToLower(strings.TrimSpace(provider))]
+	if !ok {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid cdnProvider %q, must be one of cloudflare, akamai, fastly or cloudfront", provider), nil)
+	}
+	return []string{header}, nil
+}
+
+// defaultClientIPHeaders returns the headers checked for the client IP when
+// none are configured, in priority order
+func defaultClientIPHeaders() []string {
+	return []string{"X-Forwarded-For", "Forwarded", "X-Real-IP", "CF-Connecting-IP"}
+}
+
+// cleanHeaderNames trims header names and drops empty ones. Unknown names
+// are kept and looked up literally.
+func cleanHeaderNames(headers []string) []string {
+	names := make([]string, 0, len(headers))
+	for _, header := range headers {
+		if header = strings.TrimSpace(header); header != "" {
+			names = append(names, header)
+		}
+	}
+	return names
+}
+
+// parseResponseHeaders validates the headers added to block responses
+func parseResponseHeaders(headers map[string]string) (http.Header, error) {
+	parsed := make(http.Header, len(headers))
+	for name, value := range headers {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid responseHeaders name %q", name), nil)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid responseHeaders value for %s", name), nil)
+		}
+		parsed.Set(name, value)
+	}
+	return parsed, nil
+}
+
+// headerClientIP extracts the client IP from the value of a single header.
+// X-Forwarded-For and Forwarded hold proxy chains and honor the leftmost and
+// trusted proxy settings; any other header is a single IP, or the first
+// valid entry of a list.
+func (b *BlockIP) headerClientIP(header, value string, trustedProxies []*net.IPNet) string {
+	switch http.CanonicalHeaderKey(header) {
+	case "X-Forwarded-For":
+		switch {
+		case b.xffClientIsLeftmost:
+			return leftmostIP(value)
+		case len(trustedProxies) > 0:
+			return rightmostUntrusted(strings.Split(value, ","), trustedProxies)
+		}
+	case "Cloudfront-Viewer-Address":
+		// An IP and port such as "198.51.100.10:46532" or "[2001:db8::1]:4711"
+		return forwardedNode(value)
+	case "Forwarded":
+		nodes := forwardedFor(value)
+		if len(nodes) == 0 {
+			return ""
+		}
+		if len(trustedProxies) > 0 && !b.xffClientIsLeftmost {
+			return rightmostUntrusted(nodes, trustedProxies)
+		}
+		return nodes[0]
+	}
+	return (&IPUtils{}).ExtractIPFromString(value)
+}
+
+// leftmostIP returns the first X-Forwarded-For entry if it is a valid IP.
+// Later entries are never considered.
+func leftmostIP(xff string) string {
+	first, _, _ := strings.Cut(xff, ",")
+	if ip := ipsanitize.Clean(first); isValidIP(ip) {
+		return ip
+	}
+	return ""
+}
+
+// rightmostUntrusted walks a proxy chain such as X-Forwarded-For from the
+// right, skipping trusted proxies, and returns the first hop that is not
+// one. An invalid hop ends the walk since nothing left of it can be
+// trusted. When every hop is a trusted proxy the left-most one is returned.
+func rightmostUntrusted(hops []string, trustedProxies []*net.IPNet) string {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := ipsanitize.Clean(hops[i])
+		if !isValidIP(ip) {
+			return ""
+		}
+		if !containsIP(trustedProxies, ip) || i == 0 {
+			return ip
+		}
+	}
+	return ""
+}
+
+// forwardedFor returns the for= nodes of an RFC 7239 Forwarded header in
+// order. Elements are separated by commas and parameters by semicolons, and
+// parameter names are case-insensitive. Ports are dropped, and "unknown" or
+// obfuscated identifiers such as "_hidden" are skipped.
+func forwardedFor(header string) []string {
+	var nodes []string
+	for _, element := range strings.Split(header, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "for") {
+				continue
+			}
+			if ip := forwardedNode(value); ip != "" {
+				nodes = append(nodes, ip)
+			}
+		}
+	}
+	return nodes
+}
+
+// forwardedNode extracts the IP of a Forwarded node such as
+// "192.0.2.60:8080" or "[2001:db8::1]:4711", returning "" for anything else
+func forwardedNode(value string) string {
+	node := strings.Trim(strings.TrimSpace(value), `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.IndexByte(node, ']'); end > 0 {
+			node = node[1:end]
+		}
+	} else if host, _, ok := strings.Cut(node, ":"); ok && !strings.Contains(node[len(host)+1:], ":") {
+		node = host
+	}
+	if ip := ipsanitize.Clean(node); isValidIP(ip) {
+		return ip
+	}
+	return ""
+}
+
+// headerIPs returns the client IP claimed by each header of the client IP
+// source chain present on the request, keyed by header name. Headers from
+// peers a source does not trust are skipped.
+func (b *BlockIP) headerIPs(req *http.Request) map[string]string {
+	peer := remoteIP(req)
+	ips := make(map[string]string, len(b.clientIPSources))
+
+	for _, source := range b.clientIPSources {
+		if source.header == sourceRemoteAddr || !source.trusts(peer) {
+			continue
+		}
+		value := strings.Join(req.Header.Values(source.header), ",")
+		if value == "" {
+			continue
+		}
+		if ip := b.headerClientIP(source.header, value, source.trustedProxies); ip != "" {
+			ips[source.header] = canonicalIP(ip)
+		}
+	}
+	return ips
+}
+
+// hasHeaderConflict reports whether the forwarding headers disagree on the
+// client IP, counting every conflict and logging it in debug mode
+func (b *BlockIP) hasHeaderConflict(req *http.Request) bool {
+	ips := b.headerIPs(req)
+
+	first := ""
+	for _, ip := range ips {
+		if first == "" {
+			first = ip
+			continue
+		}
+		if ip != first {
+			b.stats.headerConflicts.Add(1)
+			if b.debug {
+				b.logger.Debug("[%s] Conflicting client IP headers: %v, Path: %s", b.name, ips, req.URL.Path)
+			}
+			return true
+		}
+	}
+	return false
+}
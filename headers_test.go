@@ -0,0 +1,542 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderConflict(t *testing.T) {
+	tests := []struct {
+		action   string
+		headers  map[string]string
+		expected int
+		conflict bool
+		testName string
+	}{
+		{"block", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"}, 403, true, "Block mode blocks conflict"},
+		{"log", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"}, 200, true, "Log mode allows conflict"},
+		{"block", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.1", "CF-Connecting-IP": "198.51.100.3"}, 403, true, "CF-Connecting-IP conflict"},
+		{"block", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.1", "CF-Connecting-IP": "198.51.100.1"}, 200, false, "Agreeing headers"},
+		{"block", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "garbage"}, 200, false, "Invalid header ignored"},
+		{"block", map[string]string{"X-Forwarded-For": "198.51.100.1"}, 200, false, "Single header"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.Debug = true
+		config.DetectHeaderConflict = true
+		config.HeaderConflictAction = test.action
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		output := captureStdout(t, func() {
+			handler.ServeHTTP(w, req)
+		})
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+
+		conflicts := handler.(*BlockIP).Stats()["header_conflicts"]
+		if test.conflict && (conflicts != 1 || !strings.Contains(output, "Conflicting client IP headers")) {
+			t.Errorf("%s: expected conflict to be counted and logged, got %d and output %q", test.testName, conflicts, output)
+		}
+		if !test.conflict && conflicts != 0 {
+			t.Errorf("%s: expected no conflict, got %d", test.testName, conflicts)
+		}
+	}
+}
+
+func TestHeaderConflictFollowsSources(t *testing.T) {
+	tests := []struct {
+		clientIPHeaders []string
+		trustedProxies  []string
+		remoteAddr      string
+		conflict        bool
+		testName        string
+	}{
+		{nil, nil, "10.0.0.1:12345", true, "Default sources conflict"},
+		{[]string{"X-Forwarded-For"}, nil, "10.0.0.1:12345", false, "Header outside the chain ignored"},
+		{[]string{"X-Forwarded-For", "X-Real-IP"}, []string{"10.0.0.0/8"}, "10.0.0.1:12345", true, "Trusted peer conflict"},
+		{[]string{"X-Forwarded-For", "X-Real-IP"}, []string{"10.0.0.0/8"}, "203.0.113.5:12345", false, "Untrusted peer ignored"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.DetectHeaderConflict = true
+		config.HeaderConflictAction = "block"
+		config.TrustedProxies = test.trustedProxies
+		if test.clientIPHeaders != nil {
+			config.ClientIPHeaders = test.clientIPHeaders
+		}
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		req.Header.Set("X-Real-IP", "198.51.100.2")
+
+		if got := handler.(*BlockIP).hasHeaderConflict(req); got != test.conflict {
+			t.Errorf("%s: expected conflict %v, got %v", test.testName, test.conflict, got)
+		}
+	}
+}
+
+func TestHeaderConflictDisabled(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.HeaderConflictAction = "block"
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("X-Real-IP", "198.51.100.2")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 200 {
+		t.Errorf("Expected conflicts to be ignored when detection is disabled, got %d", w.Code)
+	}
+}
+
+func TestInvalidHeaderConflictAction(t *testing.T) {
+	config := CreateConfig()
+	config.DetectHeaderConflict = true
+	config.HeaderConflictAction = "panic"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid header conflict action")
+	}
+}
+
+func TestXFFClientIsLeftmost(t *testing.T) {
+	tests := []struct {
+		leftmost bool
+		xff      string
+		realIP   string
+		expected string
+		testName string
+	}{
+		{true, "198.51.100.1, 203.0.113.7, 10.0.0.1", "", "198.51.100.1", "Leftmost entry selected"},
+		{true, " [2001:db8::1] , 203.0.113.7", "", "2001:db8::1", "Leftmost IPv6 entry cleaned"},
+		{true, "unknown, 203.0.113.7", "", "10.0.0.1", "Invalid leftmost rejected"},
+		{true, "unknown, 203.0.113.7", "198.51.100.9", "198.51.100.9", "Invalid leftmost falls through to X-Real-IP"},
+		{true, ", 203.0.113.7", "", "10.0.0.1", "Empty leftmost rejected"},
+		{false, "unknown, 203.0.113.7", "", "203.0.113.7", "Default mode skips invalid entries"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.XFFClientIsLeftmost = test.leftmost
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", test.xff)
+		if test.realIP != "" {
+			req.Header.Set("X-Real-IP", test.realIP)
+		}
+
+		if ip := handler.(*BlockIP).getClientIP(req); ip != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.testName, test.expected, ip)
+		}
+	}
+}
+
+func TestTrustedProxiesXFF(t *testing.T) {
+	config := CreateConfig()
+	config.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		realIP     string
+		expected   string
+		testName   string
+	}{
+		{"203.0.113.9:12345", "198.51.100.1", "", "203.0.113.9", "Spoofed header from untrusted peer ignored"},
+		{"203.0.113.9:12345", "", "198.51.100.1", "203.0.113.9", "X-Real-IP from untrusted peer ignored"},
+		{"10.0.0.1:12345", "198.51.100.1", "", "198.51.100.1", "Header from trusted proxy honored"},
+		{"10.0.0.1:12345", "6.6.6.6, 198.51.100.1, 192.0.2.1, 10.0.0.2", "", "198.51.100.1", "Right-most untrusted hop"},
+		{"10.0.0.1:12345", "6.6.6.6, unknown, 10.0.0.2", "", "10.0.0.1", "Invalid hop ends the walk"},
+		{"10.0.0.1:12345", "6.6.6.6, unknown, 10.0.0.2", "198.51.100.7", "198.51.100.7", "Invalid hop falls through to X-Real-IP"},
+		{"10.0.0.1:12345", "10.0.0.3, 10.0.0.2", "", "10.0.0.3", "All hops trusted"},
+		{"10.0.0.1:12345", "", "", "10.0.0.1", "No headers from trusted proxy"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.xff != "" {
+			req.Header.Set("X-Forwarded-For", test.xff)
+		}
+		if test.realIP != "" {
+			req.Header.Set("X-Real-IP", test.realIP)
+		}
+
+		if ip := handler.(*BlockIP).getClientIP(req); ip != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.testName, test.expected, ip)
+		}
+	}
+}
+
+func TestInvalidTrustedProxies(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "not-a-proxy", ""} {
+		config := CreateConfig()
+		config.TrustedProxies = []string{entry}
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("Expected error for trusted proxy entry %q", entry)
+		}
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected []string
+		testName string
+	}{
+		{"for=192.0.2.60", []string{"192.0.2.60"}, "Plain IPv4"},
+		{"For=192.0.2.60;proto=http;by=203.0.113.43", []string{"192.0.2.60"}, "Capitalized token with parameters"},
+		{"FOR=192.0.2.60:8080", []string{"192.0.2.60"}, "Uppercase token with port"},
+		{`for="[2001:db8::1]:4711"`, []string{"2001:db8::1"}, "Quoted IPv6 with port"},
+		{`for="[2001:db8::1]"`, []string{"2001:db8::1"}, "Quoted IPv6"},
+		{"for=192.0.2.43, for=198.51.100.17", []string{"192.0.2.43", "198.51.100.17"}, "Multiple elements"},
+		{"for=_hidden, for=198.51.100.17", []string{"198.51.100.17"}, "Obfuscated identifier skipped"},
+		{"for=unknown;proto=https, for=192.0.2.43", []string{"192.0.2.43"}, "Unknown node skipped"},
+		{"proto=https;by=203.0.113.43", nil, "No for parameter"},
+		{"", nil, "Empty header"},
+	}
+
+	for _, test := range tests {
+		nodes := forwardedFor(test.header)
+		if strings.Join(nodes, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", test.testName, test.expected, nodes)
+		}
+	}
+}
+
+func TestForwardedHeader(t *testing.T) {
+	plain, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), CreateConfig(), "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	config := CreateConfig()
+	config.TrustedProxies = []string{"10.0.0.0/8"}
+	trusted, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		handler   http.Handler
+		xff       string
+		forwarded []string
+		expected  string
+		testName  string
+	}{
+		{plain, "", []string{"for=198.51.100.1"}, "198.51.100.1", "Forwarded used"},
+		{plain, "", []string{`for=_gazonk, For="[2001:db8::17]:4711"`}, "2001:db8::17", "Obfuscated node skipped"},
+		{plain, "198.51.100.9", []string{"for=198.51.100.1"}, "198.51.100.9", "X-Forwarded-For takes precedence"},
+		{plain, "", []string{"for=198.51.100.1", "for=10.0.0.2"}, "198.51.100.1", "Multiple header lines"},
+		{trusted, "", []string{"for=6.6.6.6, FOR=198.51.100.1, for=10.0.0.2"}, "198.51.100.1", "Right-most untrusted node"},
+		{trusted, "", []string{"for=unknown"}, "10.0.0.1", "No usable node"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		if test.xff != "" {
+			req.Header.Set("X-Forwarded-For", test.xff)
+		}
+		for _, value := range test.forwarded {
+			req.Header.Add("Forwarded", value)
+		}
+
+		if ip := test.handler.(*BlockIP).getClientIP(req); ip != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.testName, test.expected, ip)
+		}
+	}
+}
+
+func TestClientIPHeaders(t *testing.T) {
+	tests := []struct {
+		headers  []string
+		expected string
+		source   string
+		testName string
+	}{
+		{defaultClientIPHeaders(), "198.51.100.1", "X-Forwarded-For", "Default order"},
+		{[]string{"CF-Connecting-IP", "X-Forwarded-For"}, "198.51.100.3", "CF-Connecting-IP", "Cloudflare first"},
+		{[]string{"X-Real-IP"}, "198.51.100.2", "X-Real-IP", "XFF trust disabled"},
+		{[]string{"X-Client-Addr", "X-Real-IP"}, "198.51.100.4", "X-Client-Addr", "Custom header"},
+		{[]string{"x-bogus header!", " ", "x-real-ip"}, "198.51.100.2", "x-real-ip", "Garbage names looked up literally"},
+		{[]string{}, "192.0.2.10", "RemoteAddr", "Empty list uses RemoteAddr only"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.ClientIPHeaders = test.headers
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.10:12345"
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		req.Header.Set("X-Real-IP", "198.51.100.2")
+		req.Header.Set("CF-Connecting-IP", "198.51.100.3")
+		req.Header.Set("X-Client-Addr", "198.51.100.4")
+
+		ip, source := handler.(*BlockIP).clientIPSource(req)
+		if ip != test.expected || source != test.source {
+			t.Errorf("%s: expected %s from %s, got %s from %s", test.testName, test.expected, test.source, ip, source)
+		}
+	}
+}
+
+func TestClientIPSourceChain(t *testing.T) {
+	tests := []struct {
+		sources    []ClientIPSource
+		remoteAddr string
+		expected   string
+		source     string
+		testName   string
+	}{
+		{
+			[]ClientIPSource{{Header: "CF-Connecting-IP", TrustedProxies: []string{"173.245.48.0/20"}}, {Header: "X-Real-IP"}, {Header: "RemoteAddr"}},
+			"173.245.48.1:12345", "198.51.100.3", "CF-Connecting-IP", "Trusted first source",
+		},
+		{
+			[]ClientIPSource{{Header: "CF-Connecting-IP", TrustedProxies: []string{"173.245.48.0/20"}}, {Header: "X-Real-IP"}, {Header: "RemoteAddr"}},
+			"192.0.2.10:12345", "198.51.100.2", "X-Real-IP", "Untrusted first source skipped",
+		},
+		{
+			[]ClientIPSource{{Header: "CF-Connecting-IP", TrustedProxies: []string{"173.245.48.0/20"}}, {Header: "X-Real-IP", TrustedProxies: []string{"10.0.0.0/8"}}, {Header: "RemoteAddr"}},
+			"192.0.2.10:12345", "192.0.2.10", "RemoteAddr", "Every header untrusted",
+		},
+		{
+			[]ClientIPSource{{Header: "X-Client-Addr"}, {Header: "X-Real-IP"}},
+			"192.0.2.10:12345", "198.51.100.2", "X-Real-IP", "Invalid first source skipped",
+		},
+		{
+			[]ClientIPSource{{Header: "X-Missing"}, {Header: "remoteaddr"}, {Header: "X-Real-IP"}},
+			"192.0.2.10:12345", "192.0.2.10", "RemoteAddr", "RemoteAddr before headers",
+		},
+		{
+			[]ClientIPSource{{Header: "CF-Connecting-IP", TrustedProxies: []string{"173.245.48.0/20"}}},
+			"192.0.2.10:12345", "", "", "No source without RemoteAddr",
+		},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.ClientIPSources = test.sources
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set("X-Real-IP", "198.51.100.2")
+		req.Header.Set("CF-Connecting-IP", "198.51.100.3")
+		req.Header.Set("X-Client-Addr", "not-an-ip")
+
+		ip, source := handler.(*BlockIP).clientIPSource(req)
+		if ip != test.expected || source != test.source {
+			t.Errorf("%s: expected %q from %q, got %q from %q", test.testName, test.expected, test.source, ip, source)
+		}
+	}
+}
+
+func TestClientIPSourceTrustedProxies(t *testing.T) {
+	config := CreateConfig()
+	config.TrustedProxies = []string{"10.0.0.0/8"}
+	config.ClientIPSources = []ClientIPSource{
+		{Header: "X-Forwarded-For", TrustedProxies: []string{"192.0.2.0/24"}},
+		{Header: "X-Real-IP"},
+		{Header: "RemoteAddr"},
+	}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		expected   string
+		testName   string
+	}{
+		{"192.0.2.10:12345", "198.51.100.1, 192.0.2.20", "198.51.100.1", "Per-source proxies walk the chain"},
+		{"10.0.0.1:12345", "198.51.100.1", "198.51.100.2", "Global proxies apply to sources without their own"},
+		{"203.0.113.1:12345", "198.51.100.1", "203.0.113.1", "Untrusted peer falls back to RemoteAddr"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set("X-Forwarded-For", test.xff)
+		req.Header.Set("X-Real-IP", "198.51.100.2")
+
+		if ip := handler.(*BlockIP).getClientIP(req); ip != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.testName, test.expected, ip)
+		}
+	}
+}
+
+func TestInvalidClientIPSources(t *testing.T) {
+	tests := []struct {
+		sources  []ClientIPSource
+		testName string
+	}{
+		{[]ClientIPSource{{Header: " "}}, "Empty header"},
+		{[]ClientIPSource{{Header: "X-Real-IP", TrustedProxies: []string{"not-a-cidr"}}}, "Invalid trusted proxy"},
+		{[]ClientIPSource{{Header: "RemoteAddr", TrustedProxies: []string{"10.0.0.0/8"}}}, "Trusted proxies on RemoteAddr"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.ClientIPSources = test.sources
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", test.testName)
+		}
+	}
+}
+
+func TestCDNProvider(t *testing.T) {
+	tests := []struct {
+		provider string
+		header   string
+		value    string
+		expected string
+	}{
+		{"cloudflare", "CF-Connecting-IP", "198.51.100.1", "198.51.100.1"},
+		{"Akamai", "True-Client-IP", "198.51.100.2", "198.51.100.2"},
+		{"fastly", "Fastly-Client-IP", "198.51.100.3", "198.51.100.3"},
+		{"cloudfront", "CloudFront-Viewer-Address", "198.51.100.4:46532", "198.51.100.4"},
+		{"cloudfront", "CloudFront-Viewer-Address", "[2001:db8::4]:46532", "2001:db8::4"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.CDNProvider = test.provider
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.provider, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.10:12345"
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		req.Header.Set("X-Real-IP", "203.0.113.2")
+		req.Header.Set(test.header, test.value)
+
+		ip, source := handler.(*BlockIP).clientIPSource(req)
+		if ip != test.expected || source != test.header {
+			t.Errorf("%s: expected %s from %s, got %s from %s", test.provider, test.expected, test.header, ip, source)
+		}
+
+		// Without the CDN header X-Forwarded-For is still ignored
+		req.Header.Del(test.header)
+		if ip, source := handler.(*BlockIP).clientIPSource(req); ip != "192.0.2.10" || source != "RemoteAddr" {
+			t.Errorf("%s: expected RemoteAddr without the CDN header, got %s from %s", test.provider, ip, source)
+		}
+	}
+}
+
+func TestInvalidCDNProvider(t *testing.T) {
+	tests := []struct {
+		provider string
+		sources  []ClientIPSource
+		testName string
+	}{
+		{"unknown-cdn", nil, "Unknown provider"},
+		{"cloudflare", []ClientIPSource{{Header: "X-Real-IP"}}, "Combined with clientIPSources"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.CDNProvider = test.provider
+		config.ClientIPSources = test.sources
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", test.testName)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestHandler creates a plugin with config in front of a backend that
+// answers 200, stopping its background work when the test ends
+func newTestHandler(t *testing.T, config *Config) *BlockIP {
+	t.Helper()
+	return newTestHandlerWithNext(t, config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+// newTestHandlerWithNext is newTestHandler with a custom backend
+func newTestHandlerWithNext(t *testing.T, config *Config, next http.Handler) *BlockIP {
+	t.Helper()
+	handler, err := New(context.Background(), next, config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	b := handler.(*BlockIP)
+	t.Cleanup(b.Stop)
+	return b
+}
+
+func requestFrom(handler http.Handler, remoteAddr string) int {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
@@ -0,0 +1,255 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
+)
+
+// HostRule holds additional lists applied to requests for matching hosts.
+// Hosts are exact names or wildcards such as "*.example.com". When SNIs is
+// set the rule only applies to TLS requests whose SNI matches one of them.
+type HostRule struct {
+	Hosts          []string `json:"hosts,omitempty"`
+	SNIs           []string `json:"snis,omitempty"`
+	BlockedIPs     []string `json:"blockedIPs,omitempty"`
+	BlockedCIDRs   []string `json:"blockedCIDRs,omitempty"`
+	WhitelistIPs   []string `json:"whitelistIPs,omitempty"`
+	WhitelistCIDRs []string `json:"whitelistCIDRs,omitempty"`
+}
+
+// hostRuleset is a loaded host rule
+type hostRuleset struct {
+	hosts  []string
+	snis   []string
+	lookup *ipLookupService
+}
+
+// loadHostRules builds the host rulesets in configuration order. Catch-all
+// blocked CIDRs are refused when rejectCatchAll is set.
+func loadHostRules(rules []HostRule, rejectCatchAll bool) ([]*hostRuleset, error) {
+	rulesets := make([]*hostRuleset, 0, len(rules))
+	for i, rule := range rules {
+		if len(rule.Hosts) == 0 && len(rule.SNIs) == 0 {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("host rule %d has no hosts or SNIs", i), nil)
+		}
+
+		lookup, err := newRulesetLookup("host rule", rule.BlockedIPs, rule.BlockedCIDRs, rule.WhitelistIPs, rule.WhitelistCIDRs, rejectCatchAll)
+		if err != nil {
+			return nil, err
+		}
+
+		rs := &hostRuleset{lookup: lookup}
+		for _, host := range rule.Hosts {
+			rs.hosts = append(rs.hosts, strings.ToLower(strings.TrimSpace(host)))
+		}
+		for _, sni := range rule.SNIs {
+			rs.snis = append(rs.snis, strings.ToLower(strings.TrimSpace(sni)))
+		}
+		rulesets = append(rulesets, rs)
+	}
+	return rulesets, nil
+}
+
+// newRulesetLookup builds the lookup service of a host or path rule from
+// its lists. Catch-all blocked CIDRs are refused when rejectCatchAll is set.
+func newRulesetLookup(kind string, blockedIPs, blockedCIDRs, whitelistIPs, whitelistCIDRs []string, rejectCatchAll bool) (*ipLookupService, error) {
+	lookup := newIPLookupService(0, 0, 0, 1)
+
+	for _, ip := range blockedIPs {
+		if err := addRulesetIP(kind, lookup.blockedIPsSet, ip); err != nil {
+			return nil, err
+		}
+	}
+	for _, ip := range whitelistIPs {
+		if err := addRulesetIP(kind, lookup.whitelistIPsSet, ip); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if lookup.blockedNets, err = parseNetworks(kind+" blockedCIDRs", blockedCIDRs); err != nil {
+		return nil, err
+	}
+	for _, ipnet := range lookup.blockedNets {
+		if rejectCatchAll && isCatchAll(ipnet) {
+			return nil, catchAllError(ipnet)
+		}
+	}
+	if lookup.whitelistNets, err = parseNetworks(kind+" whitelistCIDRs", whitelistCIDRs); err != nil {
+		return nil, err
+	}
+
+	lookup.buildIndex()
+	return lookup, nil
+}
+
+// addRulesetIP validates ip and adds it to set
+func addRulesetIP(kind string, set map[string]bool, ip string) error {
+	ip = ipsanitize.Clean(ip)
+	if !isValidIP(ip) {
+		return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid %s IP: %q", kind, ip), nil)
+	}
+	set[canonicalIP(ip)] = true
+	return nil
+}
+
+// parseNetworks parses IP and CIDR entries into networks, treating plain
+// IPs as single-address networks
+func parseNetworks(field string, entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = ipsanitize.Clean(entry)
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid %s entry: %q", field, entry), nil)
+			}
+			bits := net.IPv6len * 8
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, net.IPv4len*8
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		ipnet, err := parseCanonicalCIDR(entry)
+		if err != nil {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid %s entry: %q", field, entry), err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// matches reports whether a request for host with the TLS server name sni
+// ("" without TLS) is covered by the ruleset. Empty host or SNI lists do
+// not constrain the match.
+func (rs *hostRuleset) matches(host, sni string) bool {
+	if len(rs.hosts) > 0 && !matchHostPattern(rs.hosts, host) {
+		return false
+	}
+	if len(rs.snis) > 0 && (sni == "" || !matchHostPattern(rs.snis, sni)) {
+		return false
+	}
+	return true
+}
+
+// matchHostPattern reports whether host matches one of the exact or
+// wildcard patterns
+func matchHostPattern(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostRulesetFor returns the first ruleset matching the request host
+func (b *BlockIP) hostRulesetFor(req *http.Request) *hostRuleset {
+	if len(b.hostRules) == 0 {
+		return nil
+	}
+
+	host := b.requestHost(req)
+	sni := ""
+	if req.TLS != nil {
+		sni = strings.ToLower(req.TLS.ServerName)
+	}
+	for _, rs := range b.hostRules {
+		if rs.matches(host, sni) {
+			return rs
+		}
+	}
+	return nil
+}
+
+// requestHost returns the lowercased request host without its port. The
+// X-Forwarded-Host header is used when enabled and sent by a trusted proxy.
+func (b *BlockIP) requestHost(req *http.Request) string {
+	host := req.Host
+	if b.useXForwardedHost && b.isTrustedProxy(remoteIP(req)) {
+		if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" {
+			host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// applyHostRules checks the host ruleset's lists for an IP allowed by the
+// global lists. In default-deny mode the host whitelist also admits IPs
+// denied by default.
+func (b *BlockIP) applyHostRules(req *http.Request, clientIP string, d decision) decision {
+	if d.status != statusAllowed && d.rule != ruleDefaultDeny {
+		return d
+	}
+
+	rs := b.hostRulesetFor(req)
+	if rs == nil {
+		return d
+	}
+	return b.applyRulesetLookup("host rule", rs.lookup, clientIP, d)
+}
+
+// applyRulesetLookup checks the lists of a host or path rule for an IP
+// allowed by the global lists, or denied by default
+func (b *BlockIP) applyRulesetLookup(kind string, lookup *ipLookupService, clientIP string, d decision) decision {
+	if lookup.isWhitelisted(clientIP) {
+		return decision{status: statusWhitelisted}
+	}
+	if d.rule == ruleDefaultDeny {
+		return d
+	}
+	if rule, ok := lookup.matchBlocked(clientIP); ok {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is blocked by %s %s", b.name, clientIP, kind, rule)
+		}
+		return decision{status: statusBlocked, rule: rule}
+	}
+	return d
+}
+
+// isTrustedProxy checks if ip belongs to a configured trusted proxy
+func (b *BlockIP) isTrustedProxy(ip string) bool {
+	return containsIP(b.trustedProxies, ip)
+}
+
+// containsIP checks if ip belongs to one of nets
+func containsIP(nets []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipnet := range nets {
+		if ipnet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP part of the request's RemoteAddr. An address
+// without a port is taken as a bare IP; anything else unparsable yields "".
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	host = ipsanitize.Clean(host)
+	if !isValidIP(host) {
+		return ""
+	}
+	return canonicalIP(host)
+}
@@ -0,0 +1,167 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newHostRulesHandler(t *testing.T, useXForwardedHost bool) http.Handler {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.HostRules = []HostRule{
+		{Hosts: []string{"api.example.com"}, BlockedCIDRs: []string{"203.0.113.0/24"}},
+		{Hosts: []string{"*.internal.example.com"}, BlockedIPs: []string{"198.51.100.7"}},
+	}
+	config.UseXForwardedHost = useXForwardedHost
+	config.TrustedProxies = []string{"10.0.0.1", "172.16.0.0/12"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	return handler
+}
+
+func TestHostRules(t *testing.T) {
+	handler := newHostRulesHandler(t, false)
+
+	tests := []struct {
+		host       string
+		remoteAddr string
+		xff        string
+		expected   int
+		testName   string
+	}{
+		{"api.example.com", "10.0.0.1:12345", "203.0.113.5", 403, "Host rule blocks CIDR"},
+		{"api.example.com:8443", "10.0.0.1:12345", "203.0.113.5", 403, "Host with port"},
+		{"www.example.com", "10.0.0.1:12345", "203.0.113.5", 200, "Other host unaffected"},
+		{"a.internal.example.com", "10.0.0.1:12345", "198.51.100.7", 403, "Wildcard host rule"},
+		{"www.example.com", "10.0.0.1:12345", "192.168.1.100", 403, "Global list still applies"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = test.host
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set("X-Forwarded-For", test.xff)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestHostRulesXForwardedHost(t *testing.T) {
+	tests := []struct {
+		useXForwardedHost bool
+		remoteAddr        string
+		expected          int
+		testName          string
+	}{
+		{true, "10.0.0.1:12345", 403, "Trusted proxy selects forwarded host ruleset"},
+		{true, "172.16.5.5:12345", 403, "Trusted proxy CIDR"},
+		{true, "8.8.8.8:12345", 200, "Untrusted sender uses Host"},
+		{false, "10.0.0.1:12345", 200, "Option disabled uses Host"},
+	}
+
+	for _, test := range tests {
+		handler := newHostRulesHandler(t, test.useXForwardedHost)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = "www.example.com"
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set("X-Forwarded-Host", "api.example.com")
+		req.Header.Set("X-Forwarded-For", "203.0.113.5")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestHostRulesSNI(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.HostRules = []HostRule{
+		{Hosts: []string{"shop.example.com"}, SNIs: []string{"tenant-a.example.com"}, BlockedCIDRs: []string{"203.0.113.0/24"}},
+		{SNIs: []string{"*.tenant-b.example.com"}, BlockedIPs: []string{"198.51.100.7"}},
+	}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		host       string
+		sni        string
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"shop.example.com", "tenant-a.example.com", "203.0.113.5:12345", 403, "Host and SNI match"},
+		{"shop.example.com", "TENANT-A.example.com", "203.0.113.5:12345", 403, "SNI is case-insensitive"},
+		{"shop.example.com", "tenant-c.example.com", "203.0.113.5:12345", 200, "Other SNI"},
+		{"shop.example.com", "", "203.0.113.5:12345", 200, "Plaintext request"},
+		{"other.example.com", "tenant-a.example.com", "203.0.113.5:12345", 200, "SNI matches but host does not"},
+		{"any.example.com", "eu.tenant-b.example.com", "198.51.100.7:12345", 403, "SNI-only rule"},
+		{"any.example.com", "tenant-b.example.com", "198.51.100.7:12345", 200, "Wildcard SNI needs a subdomain"},
+		{"any.example.com", "tenant-a.example.com", "192.168.1.100:12345", 403, "Global rules still apply"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = test.host
+		req.RemoteAddr = test.remoteAddr
+		if test.sni != "" {
+			req.TLS = &tls.ConnectionState{ServerName: test.sni}
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestInvalidHostRules(t *testing.T) {
+	tests := []struct {
+		rules          []HostRule
+		trustedProxies []string
+		testName       string
+	}{
+		{[]HostRule{{BlockedIPs: []string{"203.0.113.5"}}}, nil, "Rule without hosts or SNIs"},
+		{[]HostRule{{Hosts: []string{"api.example.com"}, BlockedIPs: []string{"bad"}}}, nil, "Invalid rule IP"},
+		{[]HostRule{{Hosts: []string{"api.example.com"}, BlockedCIDRs: []string{"10.0.0.0/99"}}}, nil, "Invalid rule CIDR"},
+		{nil, []string{"not-a-proxy"}, "Invalid trusted proxy"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.HostRules = test.rules
+		config.TrustedProxies = test.trustedProxies
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
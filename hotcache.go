@@ -0,0 +1,105 @@
+package traefik_plugin_blockip
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hotSetTrackingFactor bounds the IPs whose hits are counted to this many
+// times the hot set capacity
+const hotSetTrackingFactor = 8
+
+// hotEntry is a cache entry promoted to the hot set
+type hotEntry struct {
+	entry CacheEntry
+	ttl   time.Duration
+}
+
+// hotSet holds the most frequently hit cache entries. Reads take no lock,
+// so repeat offenders do not contend on the main cache mutex.
+type hotSet struct {
+	capacity     int
+	promoteAfter int32
+
+	entries atomic.Value // *sync.Map of ip -> hotEntry
+	size    atomic.Int32
+
+	hits    atomic.Value // *sync.Map of ip -> *atomic.Int32
+	tracked atomic.Int32
+}
+
+// newHotSet creates a hot set holding up to capacity entries, promoting
+// cache entries after promoteAfter hits
+func newHotSet(capacity int, promoteAfter int) *hotSet {
+	h := &hotSet{capacity: capacity, promoteAfter: int32(promoteAfter)}
+	h.clear()
+	return h
+}
+
+// entryMap returns the current map of hot entries
+func (h *hotSet) entryMap() *sync.Map {
+	return h.entries.Load().(*sync.Map)
+}
+
+// hitMap returns the current map of hit counters
+func (h *hotSet) hitMap() *sync.Map {
+	return h.hits.Load().(*sync.Map)
+}
+
+// get returns the hot entry for ip if present and not expired
+func (h *hotSet) get(ip string) (CacheEntry, bool) {
+	value, ok := h.entryMap().Load(ip)
+	if !ok {
+		return CacheEntry{}, false
+	}
+
+	hot := value.(hotEntry)
+	if hot.entry.expired(time.Now().UnixNano(), hot.ttl) {
+		if h.entryMap().CompareAndDelete(ip, value) {
+			h.size.Add(-1)
+		}
+		return CacheEntry{}, false
+	}
+	return hot.entry, true
+}
+
+// recordHit counts a main cache hit for ip and promotes entry once it has
+// been hit often enough and the hot set has room
+func (h *hotSet) recordHit(ip string, entry CacheEntry, ttl time.Duration) {
+	hits := h.hitMap()
+	counter, loaded := hits.Load(ip)
+	if !loaded {
+		if int(h.tracked.Load()) >= h.capacity*hotSetTrackingFactor {
+			// Start counting afresh so memory stays bounded
+			h.hits.Store(&sync.Map{})
+			h.tracked.Store(0)
+			hits = h.hitMap()
+		}
+		if counter, loaded = hits.LoadOrStore(ip, new(atomic.Int32)); !loaded {
+			h.tracked.Add(1)
+		}
+	}
+
+	if counter.(*atomic.Int32).Add(1) < h.promoteAfter || int(h.size.Load()) >= h.capacity {
+		return
+	}
+	if _, exists := h.entryMap().LoadOrStore(ip, hotEntry{entry: entry, ttl: ttl}); !exists {
+		h.size.Add(1)
+	}
+}
+
+// delete drops the hot entry for ip
+func (h *hotSet) delete(ip string) {
+	if _, loaded := h.entryMap().LoadAndDelete(ip); loaded {
+		h.size.Add(-1)
+	}
+}
+
+// clear drops every hot entry and hit count
+func (h *hotSet) clear() {
+	h.entries.Store(&sync.Map{})
+	h.size.Store(0)
+	h.hits.Store(&sync.Map{})
+	h.tracked.Store(0)
+}
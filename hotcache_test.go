@@ -0,0 +1,164 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHotSetPromotion(t *testing.T) {
+	lookup := newIPLookupService(time.Hour, time.Minute, 0, 0)
+	lookup.hot = newHotSet(2, 3)
+
+	d := decision{status: statusBlocked, rule: "203.0.113.5"}
+	lookup.cacheFor(d.status).put("203.0.113.5", d)
+
+	for i := 1; i <= 3; i++ {
+		if _, ok := lookup.hot.get("203.0.113.5"); ok {
+			t.Fatalf("Expected no promotion before hit %d", i)
+		}
+		if entry, ok := lookup.checkCache("203.0.113.5"); !ok || entry.Status != statusBlocked {
+			t.Fatalf("Expected cache hit %d, got %+v, %v", i, entry, ok)
+		}
+	}
+
+	entry, ok := lookup.hot.get("203.0.113.5")
+	if !ok {
+		t.Fatal("Expected entry to be promoted after 3 hits")
+	}
+	if entry.Status != statusBlocked || entry.Rule != "203.0.113.5" {
+		t.Errorf("Expected promoted entry to keep its decision, got %+v", entry)
+	}
+
+	// The hot set never grows past its capacity
+	for i := 1; i <= 5; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		lookup.cacheFor(statusAllowed).put(ip, decision{status: statusAllowed})
+		for j := 0; j < 3; j++ {
+			lookup.checkCache(ip)
+		}
+	}
+	if size := lookup.hot.size.Load(); size != 2 {
+		t.Errorf("Expected hot set capped at 2 entries, got %d", size)
+	}
+
+	lookup.clearCache()
+	if _, ok := lookup.checkCache("203.0.113.5"); ok {
+		t.Error("Expected clearCache to drop hot entries")
+	}
+}
+
+func TestHotSetExpiry(t *testing.T) {
+	lookup := newIPLookupService(time.Hour, time.Minute, 0, 0)
+	lookup.hot = newHotSet(10, 1)
+
+	lookup.cacheFor(statusAllowed).put("203.0.113.5", decision{status: statusAllowed})
+	lookup.checkCache("203.0.113.5")
+
+	// Age the promoted entry past the allowed cache TTL
+	entries := lookup.hot.entryMap()
+	value, _ := entries.Load("203.0.113.5")
+	hot := value.(hotEntry)
+	hot.entry.Timestamp -= int64(2 * time.Minute)
+	entries.Store("203.0.113.5", hot)
+
+	if _, ok := lookup.hot.get("203.0.113.5"); ok {
+		t.Error("Expected hot entry to honor the TTL of its cache")
+	}
+	if size := lookup.hot.size.Load(); size != 0 {
+		t.Errorf("Expected expired entry to be removed, got size %d", size)
+	}
+}
+
+func TestHotCacheDecisions(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.HotCacheSize = 10
+	config.HotCachePromoteHits = 2
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := requestFrom(handler, "192.168.1.100:12345"); code != 403 {
+			t.Errorf("Request %d: expected blocked IP to stay blocked, got %d", i, code)
+		}
+		if code := requestFrom(handler, "8.8.8.8:12345"); code != 200 {
+			t.Errorf("Request %d: expected allowed IP to stay allowed, got %d", i, code)
+		}
+	}
+
+	if _, ok := handler.(*BlockIP).lookup.hot.get("192.168.1.100"); !ok {
+		t.Error("Expected repeat offender to be promoted to the hot set")
+	}
+}
+
+func TestInvalidHotCacheConfig(t *testing.T) {
+	tests := []struct {
+		size        int
+		promoteHits int
+		testName    string
+	}{
+		{-1, 3, "Negative size"},
+		{10, 0, "Zero promote hits"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.HotCacheSize = test.size
+		config.HotCachePromoteHits = test.promoteHits
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
+
+// benchmarkContendedCacheReads reads one hot IP from many goroutines while
+// a writer keeps storing other decisions
+func benchmarkContendedCacheReads(b *testing.B, lookup *ipLookupService) {
+	lookup.cacheFor(statusBlocked).put("203.0.113.5", decision{status: statusBlocked})
+	for i := 0; i < 10; i++ {
+		lookup.checkCache("203.0.113.5")
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				lookup.cacheFor(statusBlocked).put(fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255), decision{status: statusBlocked})
+			}
+		}
+	}()
+	defer close(stop)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lookup.checkCache("203.0.113.5")
+		}
+	})
+}
+
+func BenchmarkCacheReadsContended(b *testing.B) {
+	benchmarkContendedCacheReads(b, newIPLookupService(time.Hour, time.Minute, 0, 0))
+}
+
+func BenchmarkCacheReadsHotSet(b *testing.B) {
+	lookup := newIPLookupService(time.Hour, time.Minute, 0, 0)
+	lookup.hot = newHotSet(100, 3)
+	benchmarkContendedCacheReads(b, lookup)
+}
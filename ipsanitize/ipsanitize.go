@@ -0,0 +1,45 @@
+// Package ipsanitize cleans IP address strings taken from configuration,
+// list files and request headers before they are parsed.
+package ipsanitize
+
+import "strings"
+
+// Clean strips surrounding whitespace, quotes and brackets, trailing dots
+// and IPv6 zones from an IP or CIDR string, so that inputs such as
+// `"[203.0.113.5]"`, `'10.0.0.1'`, `203.0.113.5.` or `fe80::1%eth0` parse
+// consistently. It does not validate the result.
+func Clean(s string) string {
+	for {
+		prev := s
+		s = strings.TrimSpace(s)
+		s = trimPair(s, '"', '"')
+		s = trimPair(s, '\'', '\'')
+		s = trimPair(s, '[', ']')
+		s = strings.TrimRight(s, ".")
+		s = stripZone(s)
+		if s == prev {
+			return s
+		}
+	}
+}
+
+// trimPair removes open and close from the ends of s when both are present
+func trimPair(s string, open, close byte) string {
+	if len(s) >= 2 && s[0] == open && s[len(s)-1] == close {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// stripZone removes the zone of a scoped IPv6 address such as "fe80::1%eth0",
+// keeping any CIDR suffix
+func stripZone(s string) string {
+	i := strings.IndexByte(s, '%')
+	if i < 0 || !strings.Contains(s[:i], ":") {
+		return s
+	}
+	if j := strings.IndexByte(s[i:], '/'); j >= 0 {
+		return s[:i] + s[i+j:]
+	}
+	return s[:i]
+}
@@ -0,0 +1,34 @@
+package ipsanitize
+
+import "testing"
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		testName string
+	}{
+		{"203.0.113.5", "203.0.113.5", "Plain IPv4"},
+		{" 203.0.113.5 ", "203.0.113.5", "Whitespace"},
+		{"[203.0.113.5]", "203.0.113.5", "Bracketed IPv4"},
+		{"[2001:db8::1]", "2001:db8::1", "Bracketed IPv6"},
+		{`"203.0.113.5"`, "203.0.113.5", "Double quoted"},
+		{"'203.0.113.5'", "203.0.113.5", "Single quoted"},
+		{`"[2001:db8::1]"`, "2001:db8::1", "Quoted and bracketed"},
+		{"203.0.113.5.", "203.0.113.5", "Trailing dot"},
+		{`" [203.0.113.5]. "`, "203.0.113.5", "Nested noise"},
+		{"10.0.0.0/8", "10.0.0.0/8", "CIDR untouched"},
+		{"[203.0.113.5", "[203.0.113.5", "Unbalanced bracket kept"},
+		{"fe80::1%eth0", "fe80::1", "IPv6 zone"},
+		{"[fe80::1%25en0]", "fe80::1", "Bracketed IPv6 with encoded zone"},
+		{"fe80::%eth0/10", "fe80::/10", "Zoned CIDR"},
+		{"203.0.113.5%eth0", "203.0.113.5%eth0", "Zone on IPv4 kept"},
+		{"", "", "Empty"},
+	}
+
+	for _, test := range tests {
+		if result := Clean(test.input); result != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.testName, test.expected, result)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net"
+	"os"
+	"time"
+)
+
+// listFiles are the blockedIPsFile and whitelistIPsFile merged into the
+// lookup service, with the modification times they were last loaded at
+type listFiles struct {
+	blocked   string
+	whitelist string
+	modTimes  map[string]time.Time
+}
+
+// listSet is a copy of the IP and CIDR lists of a lookup service
+type listSet struct {
+	blockedIPs    map[string]bool
+	blockedNets   []*net.IPNet
+	whitelistIPs  map[string]bool
+	whitelistNets []*net.IPNet
+}
+
+// changed reports whether a list file was modified, created or removed
+// since it was loaded
+func (f *listFiles) changed() bool {
+	for _, path := range []string{f.blocked, f.whitelist} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(f.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadListFiles parses both list files and merges them into the lookup
+// service. The current lists are kept when a file cannot be read.
+func (b *BlockIP) loadListFiles() error {
+	modTimes := make(map[string]time.Time, 2)
+	blocked := newNetset()
+	whitelist := newNetset()
+
+	for _, file := range []struct {
+		path           string
+		set            *netset
+		rejectCatchAll bool
+	}{
+		{b.listFiles.blocked, blocked, b.rejectCatchAllCIDR},
+		{b.listFiles.whitelist, whitelist, false},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if info, err := os.Stat(file.path); err == nil {
+			modTimes[file.path] = info.ModTime()
+		}
+
+		loaded, err := b.loadListFile(file.path, b.netsetAdder(file.set, file.rejectCatchAll, file.path))
+		if err != nil {
+			return err
+		}
+		if b.debug {
+			b.logger.Debug("[%s] Loaded %d entries from %s", b.name, loaded, file.path)
+		}
+	}
+
+	b.lookup.mergeListFiles(blocked, whitelist)
+	b.lookup.clearCache()
+	b.listFiles.modTimes = modTimes
+	return nil
+}
+
+// mergeListFiles replaces the entries from list files with blocked and
+// whitelist, keeping the entries from the configuration
+func (s *ipLookupService) mergeListFiles(blocked, whitelist *netset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listsBase == nil {
+		s.listsBase = &listSet{
+			blockedIPs:    s.blockedIPsSet,
+			blockedNets:   s.blockedNets,
+			whitelistIPs:  s.whitelistIPsSet,
+			whitelistNets: s.whitelistNets,
+		}
+	}
+
+	s.blockedIPsSet = mergeIPs(s.listsBase.blockedIPs, blocked.ips)
+	s.blockedNets = mergeNets(s.listsBase.blockedNets, blocked.nets)
+	s.whitelistIPsSet = mergeIPs(s.listsBase.whitelistIPs, whitelist.ips)
+	s.whitelistNets = mergeNets(s.listsBase.whitelistNets, whitelist.nets)
+
+	// Entries also in the configuration are attributed to it
+	s.ruleSources = make(map[string]string, len(blocked.sources))
+	for rule, source := range blocked.sources {
+		if _, configured := s.ruleGroups[rule]; !configured {
+			s.ruleSources[rule] = source
+		}
+	}
+
+	// Indexes built at startup are rebuilt on reload
+	if s.blockedTrie != nil {
+		s.indexLocked()
+	}
+	if s.blockedBloom != nil {
+		s.blockedBloom = newCIDRBloom(s.blockedNets)
+	}
+}
+
+// mergeIPs returns a new set holding the IPs of both sets
+func mergeIPs(base, extra map[string]bool) map[string]bool {
+	merged := make(map[string]bool, len(base)+len(extra))
+	for ip := range base {
+		merged[ip] = true
+	}
+	for ip := range extra {
+		merged[ip] = true
+	}
+	return merged
+}
+
+// mergeNets returns base followed by the CIDRs of extra not in base
+func mergeNets(base, extra []*net.IPNet) []*net.IPNet {
+	seen := make(map[string]bool, len(base))
+	for _, ipnet := range base {
+		seen[ipnet.String()] = true
+	}
+
+	merged := append(make([]*net.IPNet, 0, len(base)+len(extra)), base...)
+	for _, ipnet := range extra {
+		if !seen[ipnet.String()] {
+			merged = append(merged, ipnet)
+		}
+	}
+	return merged
+}
+
+// containsNet reports whether nets holds a CIDR equal to ipnet
+func containsNet(nets []*net.IPNet, ipnet *net.IPNet) bool {
+	for _, n := range nets {
+		if n.String() == ipnet.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// isConfigured reports whether a block rule comes from the configuration
+func (s *ipLookupService) isConfigured(rule string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, configured := s.ruleGroups[rule]
+	return configured
+}
+
+// sourceOf returns the list file a block rule was loaded from
+func (s *ipLookupService) sourceOf(rule string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ruleSources[rule]
+}
+
+// ruleSource returns the list file, netset file or URL a block rule was
+// loaded from, or "" for rules from the configuration. Rules found in
+// several sources are attributed to the first of the configuration, the
+// list files and the netset files.
+func (b *BlockIP) ruleSource(rule string) string {
+	if rule == "" {
+		return ""
+	}
+	if source := b.lookup.sourceOf(rule); source != "" {
+		return source
+	}
+	if b.netsets != nil && !b.lookup.isConfigured(rule) {
+		return b.netsets.sourceOf(rule)
+	}
+	return ""
+}
+
+// watchListFiles reloads the list files when they change, checking every
+// interval until ctx is done
+func (b *BlockIP) watchListFiles(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !b.listFiles.changed() {
+				continue
+			}
+			if err := b.loadListFiles(); err != nil {
+				b.logger.Error("[%s] Error reloading list files, keeping the previous lists: %v", b.name, err)
+				continue
+			}
+			b.logger.Info("[%s] Reloaded list files", b.name)
+		}
+	}
+}
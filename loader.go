@@ -0,0 +1,110 @@
+package traefik_plugin_blockip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
+)
+
+// maxListLineLength bounds a single line of a list file
+const maxListLineLength = 64 * 1024
+
+// loadListFile streams a newline-delimited list file, passing every entry to
+// add. Blank lines and "#" comments are skipped, and entries add rejects are
+// logged and skipped. The file is never held in memory as a whole.
+func (b *BlockIP) loadListFile(path string, add func(entry string) error) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("cannot open list file %s", path), err)
+	}
+	defer file.Close()
+
+	return b.scanList(file, path, add)
+}
+
+// scanList streams list entries from r; source names r in log messages
+func (b *BlockIP) scanList(r io.Reader, source string, add func(entry string) error) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxListLineLength)
+
+	loaded := 0
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		entry := listEntry(scanner.Text())
+		if entry == "" {
+			continue
+		}
+
+		if err := add(entry); err != nil {
+			if isCatchAllError(err) {
+				return loaded, err
+			}
+			if b.debug {
+				b.logger.Debug("[%s] Skipping %s:%d: %v", b.name, source, lineNumber, err)
+			}
+			continue
+		}
+		loaded++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return loaded, NewBlockIPError(ErrCodeParseError, fmt.Sprintf("cannot read list %s", source), err)
+	}
+
+	return loaded, nil
+}
+
+// listEntry strips comments and noise from a list file line
+func listEntry(line string) string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	return ipsanitize.Clean(line)
+}
+
+// addBlockedEntry adds an IP or CIDR list entry to the block list
+func (b *BlockIP) addBlockedEntry(entry string) error {
+	if strings.Contains(entry, "/") {
+		return b.parseCIDR(entry, false, "")
+	}
+
+	if !isValidIP(entry) {
+		return fmt.Errorf("invalid IP format: %s", entry)
+	}
+	b.addBlockedIP(entry, "")
+	return nil
+}
+
+// ruleCachePreload identifies blocks served from preloaded cache entries
+const ruleCachePreload = "cache-preload"
+
+// preloadCache reads known-bad IPs from path and caches them as blocked so
+// their first request is a cache hit. Whitelisted IPs are skipped.
+func (b *BlockIP) preloadCache(path string) error {
+	d := decision{status: statusBlocked, rule: ruleCachePreload}
+	loaded, err := b.loadListFile(path, func(entry string) error {
+		if !isValidIP(entry) {
+			return fmt.Errorf("invalid IP format: %s", entry)
+		}
+		entry = canonicalIP(entry)
+		if b.lookup.isWhitelisted(entry) {
+			return fmt.Errorf("IP %s is whitelisted", entry)
+		}
+		b.lookup.cacheFor(d.status).put(entry, d)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if b.debug {
+		b.logger.Debug("[%s] Preloaded %d cache entries from %s", b.name, loaded, path)
+	}
+	return nil
+}
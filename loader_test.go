@@ -0,0 +1,456 @@
+package traefik_plugin_blockip
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeListFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write list file: %v", err)
+	}
+	return path
+}
+
+func TestBlockedIPsFile(t *testing.T) {
+	path := writeListFile(t, `# Blocked sources
+203.0.113.5
+198.51.100.0/24   # inline comment
+
+not-an-ip
+10.0.0.0/33
+[2001:db8::1]
+`)
+
+	config := CreateConfig()
+	config.BlockedIPsFile = path
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.5:12345", 403, "File IP"},
+		{"198.51.100.20:12345", 403, "File CIDR with inline comment"},
+		{"[2001:db8::1]:12345", 403, "Bracketed IPv6 entry"},
+		{"10.0.0.1:12345", 200, "Malformed entry skipped"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestBlockedIPsFileMissing(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPsFile = filepath.Join(t.TempDir(), "missing.txt")
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	var blockErr *BlockIPError
+	if !errors.As(err, &blockErr) || blockErr.Code != ErrCodeInvalidConfig {
+		t.Fatalf("Expected %s error for missing file, got %v", ErrCodeInvalidConfig, err)
+	}
+}
+
+func TestLoadListFileStreamsLargeFile(t *testing.T) {
+	const entries = 1000000
+
+	path := filepath.Join(t.TempDir(), "large.txt")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create list file: %v", err)
+	}
+	w := bufio.NewWriter(file)
+	for i := 0; i < entries; i++ {
+		fmt.Fprintf(w, "10.%d.%d.%d\n", i>>16&0xff, i>>8&0xff, i&0xff)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to write list file: %v", err)
+	}
+	file.Close()
+
+	info, _ := os.Stat(path)
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	b := &BlockIP{name: "blockip-test"}
+	var peak uint64
+	count := 0
+	loaded, err := b.loadListFile(path, func(entry string) error {
+		count++
+		if count%50000 == 0 {
+			// Collect first so only memory the loader retains is counted,
+			// not garbage whose collection depends on the rest of the heap
+			var stats runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to load list file: %v", err)
+	}
+
+	if loaded != entries {
+		t.Errorf("Expected %d entries, got %d", entries, loaded)
+	}
+
+	if peak > before.HeapAlloc && peak-before.HeapAlloc > uint64(info.Size())/2 {
+		t.Errorf("Expected bounded memory while streaming %d bytes, heap grew by %d bytes", info.Size(), peak-before.HeapAlloc)
+	}
+}
+
+func TestCachePreloadFile(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WhitelistIPs = []string{"10.0.0.1"}
+	config.CachePreloadFile = writeListFile(t, "# known bad\n203.0.113.5\n10.0.0.1\nnot-an-ip\n")
+	config.Debug = true
+
+	var handler http.Handler
+	var err error
+	captureStdout(t, func() {
+		handler, err = New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	if _, ok := b.lookup.checkCache("10.0.0.1"); ok {
+		t.Error("Expected whitelisted IP not to be preloaded")
+	}
+
+	var code int
+	output := captureStdout(t, func() {
+		code = requestFrom(handler, "203.0.113.5:12345")
+	})
+	if code != 403 {
+		t.Errorf("Expected preloaded IP to be blocked, got %d", code)
+	}
+	if !strings.Contains(output, "Cache hit for IP 203.0.113.5: blocked") {
+		t.Errorf("Expected first request to be a cache hit, got output %q", output)
+	}
+}
+
+func TestCachePreloadRespectsTTL(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.CachePreloadFile = writeListFile(t, "203.0.113.5\n")
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	cache := handler.(*BlockIP).lookup.cache
+
+	// Age the preloaded entry past the cache TTL
+	ageCache(cache, cache.ttl)
+
+	if code := requestFrom(handler, "203.0.113.5:12345"); code != 200 {
+		t.Errorf("Expected expired preload entry to fall back to the lists, got %d", code)
+	}
+}
+
+func TestCachePreloadFileMissing(t *testing.T) {
+	config := CreateConfig()
+	config.CachePreloadFile = "/nonexistent/preload.txt"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for missing preload file")
+	}
+}
+
+func TestWhitelistIPsFile(t *testing.T) {
+	path := writeListFile(t, `# Office and monitoring
+203.0.113.5
+198.51.100.0/24   # inline comment
+
+not-an-ip
+`)
+
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"203.0.113.0/24", "198.51.100.0/23"}
+	config.WhitelistIPs = []string{"203.0.113.6"}
+	config.WhitelistIPsFile = path
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.5:12345", 200, "File IP"},
+		{"198.51.100.20:12345", 200, "File CIDR with inline comment"},
+		{"203.0.113.6:12345", 200, "Inline whitelist merged"},
+		{"203.0.113.7:12345", 403, "Blocked outside whitelist"},
+		{"198.51.101.1:12345", 403, "Blocked outside file CIDR"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestWhitelistIPsFileMissing(t *testing.T) {
+	config := CreateConfig()
+	config.WhitelistIPsFile = filepath.Join(t.TempDir(), "missing.txt")
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	var blockErr *BlockIPError
+	if !errors.As(err, &blockErr) || blockErr.Code != ErrCodeInvalidConfig {
+		t.Fatalf("Expected %s error for missing file, got %v", ErrCodeInvalidConfig, err)
+	}
+}
+
+// rewriteListFile replaces the content of path and moves its modification
+// time forward so the change is seen even on coarse-grained filesystems
+func rewriteListFile(t *testing.T, path, content string, age time.Duration) {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite list file: %v", err)
+	}
+	modTime := time.Now().Add(age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to touch list file: %v", err)
+	}
+}
+
+// waitForStatus polls handler until remoteAddr gets expected or a second
+// has passed, returning the last status
+func waitForStatus(handler http.Handler, remoteAddr string, expected int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		code := requestFrom(handler, remoteAddr)
+		if code == expected || time.Now().After(deadline) {
+			return code
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListFilesReload(t *testing.T) {
+	blockedPath := writeListFile(t, "203.0.113.5\n")
+	whitelistPath := writeListFile(t, "")
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.0.2.1"}
+	config.BlockedIPsFile = blockedPath
+	config.WhitelistIPsFile = whitelistPath
+	config.ReloadIntervalDuration = "10ms"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	defer handler.(*BlockIP).Stop()
+
+	if code := requestFrom(handler, "203.0.113.5:12345"); code != 403 {
+		t.Fatalf("Expected file IP to be blocked, got %d", code)
+	}
+
+	// The cached block must not outlive the reload
+	rewriteListFile(t, blockedPath, "198.51.100.0/24\n", time.Second)
+	if code := waitForStatus(handler, "198.51.100.7:12345", 403); code != 403 {
+		t.Errorf("Expected new file CIDR to be blocked after reload, got %d", code)
+	}
+	if code := requestFrom(handler, "203.0.113.5:12345"); code != 200 {
+		t.Errorf("Expected removed file IP to be allowed after reload, got %d", code)
+	}
+	if code := requestFrom(handler, "192.0.2.1:12345"); code != 403 {
+		t.Errorf("Expected inline IP to survive the reload, got %d", code)
+	}
+
+	rewriteListFile(t, whitelistPath, "198.51.100.7\n", time.Second)
+	if code := waitForStatus(handler, "198.51.100.7:12345", 200); code != 200 {
+		t.Errorf("Expected whitelist file to be reloaded, got %d", code)
+	}
+}
+
+func TestListFilesReloadKeepsListsOnError(t *testing.T) {
+	path := writeListFile(t, "203.0.113.5\n")
+
+	config := CreateConfig()
+	config.BlockedIPsFile = path
+	config.RejectCatchAllCIDR = true
+	config.ReloadIntervalDuration = "10ms"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+	defer b.Stop()
+
+	rewriteListFile(t, path, "198.51.100.1\n0.0.0.0/0\n", time.Second)
+	time.Sleep(100 * time.Millisecond)
+	b.Stop()
+
+	if logs := strings.Join(b.logger.GetLogs(0), "\n"); !strings.Contains(logs, "Error reloading list files") {
+		t.Errorf("Expected reload error to be logged, got %q", logs)
+	}
+	if code := requestFrom(handler, "203.0.113.5:12345"); code != 403 {
+		t.Errorf("Expected previous list to be kept, got %d", code)
+	}
+	if code := requestFrom(handler, "198.51.100.1:12345"); code != 200 {
+		t.Errorf("Expected entries of the rejected file to be ignored, got %d", code)
+	}
+}
+
+func TestRuleSources(t *testing.T) {
+	blockedFile := writeListFile(t, "203.0.113.0/24\n198.51.100.7\n")
+	netsetFile := writeListFile(t, "192.0.2.0/24\n")
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.BlockedIPsFile = blockedFile
+	config.NetsetFiles = []string{netsetFile}
+	config.Debug = true
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+	defer b.Stop()
+
+	output := captureStdout(t, func() {
+		for _, addr := range []string{"203.0.113.5:1", "198.51.100.7:1", "192.0.2.9:1", "192.168.1.100:1"} {
+			if code := requestFrom(handler, addr); code != 403 {
+				t.Errorf("Expected %s to be blocked, got %d", addr, code)
+			}
+		}
+	})
+
+	expected := map[string]string{
+		"203.0.113.0/24": blockedFile,
+		"198.51.100.7":   blockedFile,
+		"192.0.2.0/24":   netsetFile,
+	}
+	sources := b.RuleSources()
+	if len(sources) != len(expected) {
+		t.Errorf("Expected sources %v, got %v", expected, sources)
+	}
+	for rule, source := range expected {
+		if sources[rule] != source {
+			t.Errorf("Expected rule %s to come from %s, got %q", rule, source, sources[rule])
+		}
+	}
+
+	if !strings.Contains(output, "Rule 203.0.113.0/24 blocking IP 203.0.113.5 was loaded from "+blockedFile) {
+		t.Errorf("Expected the source in the debug log, got %q", output)
+	}
+	if !strings.Contains(output, `"source":"`+netsetFile+`"`) && !strings.Contains(output, "source="+netsetFile) {
+		t.Errorf("Expected the source in the decision entry, got %q", output)
+	}
+}
+
+func TestOverlappingSources(t *testing.T) {
+	blockedFile := writeListFile(t, "10.0.0.0/8\n192.168.1.100\n198.51.100.7\n172.16.0.0/12\n172.16.0.0/12\n")
+	whitelistFile := writeListFile(t, "10.1.0.0/16\n10.1.0.0/16\n")
+	netsetFile := writeListFile(t, "172.16.0.0/12\n10.0.0.0/8\n192.0.2.0/24\n192.0.2.0/24\n")
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100", "192.168.1.100"}
+	config.BlockedCIDRs = []string{"10.0.0.0/8", "10.0.0.0/8"}
+	config.WhitelistCIDRs = []string{"10.1.0.0/16"}
+	config.BlockedIPsFile = blockedFile
+	config.WhitelistIPsFile = whitelistFile
+	config.NetsetFiles = []string{netsetFile}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+	defer b.Stop()
+
+	// 192.168.1.100, 198.51.100.7, 10.0.0.0/8 and 172.16.0.0/12
+	stats := b.Stats()
+	if stats["blocked_ipv4"] != 4 || stats["whitelist_ipv4"] != 1 {
+		t.Errorf("Expected 4 blocked and 1 whitelisted entries, got %d and %d", stats["blocked_ipv4"], stats["whitelist_ipv4"])
+	}
+	if size := b.netsets.size(); size != 3 {
+		t.Errorf("Expected 3 netset entries, got %d", size)
+	}
+
+	for _, addr := range []string{"10.2.0.1:1", "192.168.1.100:1", "198.51.100.7:1", "172.16.0.1:1", "192.0.2.9:1"} {
+		if code := requestFrom(handler, addr); code != 403 {
+			t.Errorf("Expected %s to be blocked, got %d", addr, code)
+		}
+	}
+
+	expected := map[string]string{
+		"198.51.100.7":  blockedFile,
+		"172.16.0.0/12": blockedFile,
+		"192.0.2.0/24":  netsetFile,
+		"10.0.0.0/8":    "",
+		"192.168.1.100": "",
+	}
+	sources := b.RuleSources()
+	for rule, source := range expected {
+		if sources[rule] != source {
+			t.Errorf("Expected rule %s to come from %q, got %q", rule, source, sources[rule])
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package traefik_plugin_blockip
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,15 +22,30 @@ const (
 // Logger handles logging for the plugin
 type Logger struct {
 	debug       bool
+	format      string // formatText or formatJSON
 	mu          sync.Mutex
 	logBuffer   []string
 	maxBuffSize int
 }
 
+// parseLogFormat validates the log format, defaulting to text
+func parseLogFormat(format string) (string, error) {
+	switch format {
+	case "", formatText:
+		return formatText, nil
+	case formatJSON:
+		return formatJSON, nil
+	default:
+		return "", NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid log format: %q, must be %q or %q", format, formatText, formatJSON), nil)
+	}
+}
+
 // NewLogger creates a new logger instance
 func NewLogger(debug bool) *Logger {
 	return &Logger{
 		debug:       debug,
+		format:      formatText,
 		logBuffer:   make([]string, 0),
 		maxBuffSize: 1000,
 	}
@@ -55,22 +73,74 @@ func (l *Logger) Error(format string, args ...interface{}) {
 	l.log("ERROR", format, args...)
 }
 
+// LogFields logs a structured entry at level ("debug", "info", "warn" or
+// "error"). The "message" field becomes the entry message; other fields such
+// as client_ip and path are rendered as key=value pairs in text mode and as
+// object members in JSON mode.
+func (l *Logger) LogFields(level string, fields map[string]interface{}) {
+	level = strings.ToUpper(level)
+	if level == "DEBUG" && !l.debug {
+		return
+	}
+
+	message, _ := fields["message"].(string)
+	extra := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if key != "message" {
+			extra[key] = value
+		}
+	}
+	l.write(level, message, extra)
+}
+
 // log is the internal logging method
 func (l *Logger) log(level string, format string, args ...interface{}) {
+	l.write(level, fmt.Sprintf(format, args...), nil)
+}
+
+// write renders an entry in the configured format, prints it and stores
+// the rendered line in the buffer
+func (l *Logger) write(level string, message string, fields map[string]interface{}) {
+	now := time.Now()
+	var line string
+	if l.format == formatJSON {
+		entry := make(map[string]interface{}, len(fields)+3)
+		for key, value := range fields {
+			entry[key] = value
+		}
+		entry["timestamp"] = now.UTC().Format(time.RFC3339Nano)
+		entry["level"] = strings.ToLower(level)
+		entry["message"] = message
+		data, err := json.Marshal(entry)
+		if err != nil {
+			// Fields that cannot be marshaled are dropped from the entry
+			data, _ = json.Marshal(map[string]string{"timestamp": entry["timestamp"].(string), "level": entry["level"].(string), "message": message})
+		}
+		line = string(data)
+	} else {
+		line = fmt.Sprintf("[%s] %s - %s", now.Format("2006-01-02 15:04:05"), level, message)
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			line += fmt.Sprintf(" %s=%v", key, fields[key])
+		}
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	message := fmt.Sprintf("[%s] %s - %s", time.Now().Format("2006-01-02 15:04:05"), level, fmt.Sprintf(format, args...))
-
 	// Print to stdout/stderr
-	fmt.Println(message)
+	fmt.Println(line)
 
 	// Store in buffer
 	if len(l.logBuffer) < l.maxBuffSize {
-		l.logBuffer = append(l.logBuffer, message)
+		l.logBuffer = append(l.logBuffer, line)
 	} else {
 		// Rotate buffer
-		l.logBuffer = append(l.logBuffer[1:], message)
+		l.logBuffer = append(l.logBuffer[1:], line)
 	}
 }
 
@@ -80,10 +150,11 @@ func (l *Logger) GetLogs(count int) []string {
 	defer l.mu.Unlock()
 
 	if count <= 0 || count > len(l.logBuffer) {
-		return l.logBuffer
+		count = len(l.logBuffer)
 	}
 
-	return l.logBuffer[len(l.logBuffer)-count:]
+	// Copied so callers can read it while new entries are logged
+	return append([]string(nil), l.logBuffer[len(l.logBuffer)-count:]...)
 }
 
 // ClearLogs clears the log buffer
@@ -0,0 +1,128 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoggerJSONFormat(t *testing.T) {
+	logger := NewLogger(true)
+	logger.format = formatJSON
+
+	captureStdout(t, func() {
+		logger.Info("loaded %d entries", 3)
+		logger.LogFields("warn", map[string]interface{}{"message": "slow lookup", "client_ip": "203.0.113.5", "path": "/login"})
+	})
+
+	logs := logger.GetLogs(0)
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 buffered entries, got %d", len(logs))
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(logs[0]), &entry); err != nil {
+		t.Fatalf("Expected a JSON entry, got %q: %v", logs[0], err)
+	}
+	if entry["level"] != "info" || entry["message"] != "loaded 3 entries" || entry["timestamp"] == nil {
+		t.Errorf("Unexpected entry %v", entry)
+	}
+	if _, ok := entry["client_ip"]; ok {
+		t.Errorf("Expected no client_ip on a plain entry, got %v", entry)
+	}
+
+	entry = nil
+	if err := json.Unmarshal([]byte(logs[1]), &entry); err != nil {
+		t.Fatalf("Expected a JSON entry, got %q: %v", logs[1], err)
+	}
+	if entry["level"] != "warn" || entry["message"] != "slow lookup" || entry["client_ip"] != "203.0.113.5" || entry["path"] != "/login" {
+		t.Errorf("Unexpected structured entry %v", entry)
+	}
+}
+
+func TestLoggerTextFields(t *testing.T) {
+	logger := NewLogger(false)
+
+	output := captureStdout(t, func() {
+		logger.LogFields("debug", map[string]interface{}{"message": "hidden"})
+		logger.LogFields("error", map[string]interface{}{"message": "lookup failed", "path": "/", "client_ip": "203.0.113.5"})
+	})
+
+	logs := logger.GetLogs(0)
+	if len(logs) != 1 {
+		t.Fatalf("Expected debug entries to be dropped without debug, got %v", logs)
+	}
+	if !strings.HasSuffix(logs[0], "ERROR - lookup failed client_ip=203.0.113.5 path=/") {
+		t.Errorf("Unexpected text entry %q", logs[0])
+	}
+	if !strings.Contains(output, logs[0]) {
+		t.Errorf("Expected the entry to be printed, got %q", output)
+	}
+}
+
+func TestLogFormatDecisions(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.Debug = true
+	config.LogFormat = "json"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	captureStdout(t, func() {
+		requestPath(handler, "192.168.1.100:12345", "/admin")
+	})
+
+	logs := handler.(*BlockIP).logger.GetLogs(1)
+	if len(logs) != 1 {
+		t.Fatalf("Expected a decision entry, got %v", logs)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(logs[0]), &entry); err != nil {
+		t.Fatalf("Expected a JSON entry, got %q: %v", logs[0], err)
+	}
+	if entry["client_ip"] != "192.168.1.100" || entry["path"] != "/admin" || entry["decision"] != "blocked" || entry["rule"] != "192.168.1.100" {
+		t.Errorf("Unexpected decision entry %v", entry)
+	}
+
+	config.LogFormat = "xml"
+	if _, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), config, "blockip-test"); err == nil {
+		t.Error("Expected error for an invalid log format")
+	}
+}
+
+func TestBlockIPLogsToLogger(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.Debug = true
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	logger := handler.(*BlockIP).logger
+
+	captureStdout(t, func() {
+		requestFrom(handler, "192.168.1.100:12345")
+	})
+
+	expected := []string{
+		"DEBUG - [blockip-test] Added blocked IP: 192.168.1.100",
+		"DEBUG - [blockip-test] Extracted IP from RemoteAddr: 192.168.1.100",
+		"DEBUG - [blockip-test] IP 192.168.1.100 is blocked",
+	}
+	logs := strings.Join(logger.GetLogs(0), "\n")
+	for _, line := range expected {
+		if !strings.Contains(logs, line) {
+			t.Errorf("Expected buffered logs to contain %q, got %q", line, logs)
+		}
+	}
+}
@@ -1,24 +1,280 @@
 package traefik_plugin_blockip
 
 import (
+	"container/list"
 	"context"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
+)
+
+// Decision statuses stored in the cache and returned by lookups
+const (
+	statusAllowed     = "allowed"
+	statusBlocked     = "blocked"
+	statusWhitelisted = "whitelisted"
 )
 
+// defaultWWWAuthenticate is the challenge sent with 401 responses
+const defaultWWWAuthenticate = `Basic realm="Restricted"`
+
+// rulePlaintextHTTP identifies blocks of requests made without TLS
+const rulePlaintextHTTP = "plaintext-http"
+
+// ruleUnparsableClientIP identifies blocks of requests without a usable client IP
+const ruleUnparsableClientIP = "unparsable-client-ip"
+
+// ruleNoClientIPChallenge identifies challenges sent to requests without a
+// usable client IP
+const ruleNoClientIPChallenge = "no-client-ip-challenge"
+
+// actionChallenge answers with a 401 and the WWW-Authenticate challenge
+const actionChallenge = "challenge"
+
+// passthroughHeader marks blocked requests passed on in passthrough mode
+const passthroughHeader = "X-Blocked-IP"
+
+// actionDeny makes default-deny the action for IPs matching no list
+const actionDeny = "deny"
+
+// ruleDefaultDeny identifies blocks of non-whitelisted IPs in default-deny mode
+const ruleDefaultDeny = "default-deny"
+
+// maxCacheEntries is the size of per-IP tracking maps that triggers a
+// cleanup of stale entries
+const maxCacheEntries = 10000
+
+// cacheDisabledCleanupInterval limits cleanups while caching is disabled
+const cacheDisabledCleanupInterval = time.Second
+
+// maxCacheShards caps the auto-tuned number of cache shards
+const maxCacheShards = 256
+
 // Config holds the plugin configuration
 type Config struct {
-	BlockedIPs     []string `json:"blockedIPs,omitempty"`
-	BlockedCIDRs   []string `json:"blockedCIDRs,omitempty"`
-	WhitelistIPs   []string `json:"whitelistIPs,omitempty"`
-	WhitelistCIDRs []string `json:"whitelistCIDRs,omitempty"`
-	StatusCode     int      `json:"statusCode,omitempty"`
-	Message        string   `json:"message,omitempty"`
-	Debug          bool     `json:"debug,omitempty"`
-	CacheTTL       int      `json:"cacheTTL,omitempty"`
+	BlockedIPs       []string    `json:"blockedIPs,omitempty"`
+	BlockedCIDRs     []string    `json:"blockedCIDRs,omitempty"`
+	WhitelistIPs     []string    `json:"whitelistIPs,omitempty"`
+	WhitelistCIDRs   []string    `json:"whitelistCIDRs,omitempty"`
+	ListGroups       []ListGroup `json:"listGroups,omitempty"`
+	BlockedIPsFile   string      `json:"blockedIPsFile,omitempty"`
+	WhitelistIPsFile string      `json:"whitelistIPsFile,omitempty"`
+	BlockedIPv4      []string    `json:"blockedIPv4,omitempty"`
+	BlockedIPv6      []string    `json:"blockedIPv6,omitempty"`
+	StatusCode       int         `json:"statusCode,omitempty"`
+	Message          string      `json:"message,omitempty"`
+	WWWAuthenticate  string      `json:"wwwAuthenticate,omitempty"`
+	Debug            bool        `json:"debug,omitempty"`
+	CacheTTL         int         `json:"cacheTTL,omitempty"`
+	CacheMaxEntries  int         `json:"cacheMaxEntries,omitempty"`
+	AllowedCacheTTL  int         `json:"allowedCacheTTL,omitempty"`
+
+	CacheCleanupInterval int `json:"cacheCleanupInterval,omitempty"`
+
+	DisableCacheEviction bool `json:"disableCacheEviction,omitempty"`
+
+	CacheShards int `json:"cacheShards,omitempty"`
+
+	CachePreloadFile string `json:"cachePreloadFile,omitempty"`
+
+	CachePersistPath     string `json:"cachePersistPath,omitempty"`
+	CachePersistInterval int    `json:"cachePersistInterval,omitempty"`
+
+	HotCacheSize        int `json:"hotCacheSize,omitempty"`
+	HotCachePromoteHits int `json:"hotCachePromoteHits,omitempty"`
+
+	StrictBodyEncoding   bool `json:"strictBodyEncoding,omitempty"`
+	NormalizeLineEndings bool `json:"normalizeLineEndings,omitempty"`
+
+	BlockPlaintextHTTP bool     `json:"blockPlaintextHTTP,omitempty"`
+	BlockedSchemes     []string `json:"blockedSchemes,omitempty"`
+
+	BlockedCipherSuites []string `json:"blockedCipherSuites,omitempty"`
+
+	BlockedSourcePorts []string `json:"blockedSourcePorts,omitempty"`
+	AllowedSourcePorts []string `json:"allowedSourcePorts,omitempty"`
+
+	CompressBlockResponse bool `json:"compressBlockResponse,omitempty"`
+
+	ResponseFormat      string `json:"responseFormat,omitempty"`
+	ResponseTemplate    string `json:"responseTemplate,omitempty"`
+	ResponseContentType string `json:"responseContentType,omitempty"`
+
+	ResponseTemplateFile string `json:"responseTemplateFile,omitempty"`
+
+	StripResponseHeaders []string          `json:"stripResponseHeaders,omitempty"`
+	ResponseHeaders      map[string]string `json:"responseHeaders,omitempty"`
+
+	LogFormat string `json:"logFormat,omitempty"`
+
+	RedirectURL string `json:"redirectURL,omitempty"`
+
+	BlockPageDir string `json:"blockPageDir,omitempty"`
+
+	BodySignatures []string `json:"bodySignatures,omitempty"`
+	BodyPeekSize   int      `json:"bodyPeekSize,omitempty"`
+
+	DetectHeaderConflict bool   `json:"detectHeaderConflict,omitempty"`
+	HeaderConflictAction string `json:"headerConflictAction,omitempty"`
+
+	AllowVerifiedCrawlers  bool     `json:"allowVerifiedCrawlers,omitempty"`
+	VerifiedCrawlerDomains []string `json:"verifiedCrawlerDomains,omitempty"`
+
+	RateLimit        int  `json:"rateLimit,omitempty"`
+	RatePeriod       int  `json:"ratePeriod,omitempty"`
+	PerPathRateLimit bool `json:"perPathRateLimit,omitempty"`
+
+	CIDRRateLimits map[string]RateRule `json:"cidrRateLimits,omitempty"`
+
+	MaxDistinctPaths    int `json:"maxDistinctPaths,omitempty"`
+	DistinctPathsPeriod int `json:"distinctPathsPeriod,omitempty"`
+
+	WarnOnEmptyLists  bool `json:"warnOnEmptyLists,omitempty"`
+	ErrorOnEmptyLists bool `json:"errorOnEmptyLists,omitempty"`
+
+	DefaultAction              string `json:"defaultAction,omitempty"`
+	RequireWhitelistInDenyMode bool   `json:"requireWhitelistInDenyMode,omitempty"`
+
+	HostRules         []HostRule `json:"hostRules,omitempty"`
+	PathRules         []PathRule `json:"pathRules,omitempty"`
+	UseXForwardedHost bool       `json:"useXForwardedHost,omitempty"`
+	TrustedProxies    []string   `json:"trustedProxies,omitempty"`
+
+	XFFClientIsLeftmost bool     `json:"xffClientIsLeftmost,omitempty"`
+	ClientIPHeaders     []string `json:"clientIPHeaders,omitempty"`
+
+	ClientIPSources []ClientIPSource `json:"clientIPSources,omitempty"`
+	CDNProvider     string           `json:"cdnProvider,omitempty"`
+
+	NoIPAction string `json:"noIPAction,omitempty"`
+
+	// Deprecated: use NoIPAction, which takes precedence
+	UnparsableClientIPAction string `json:"unparsableClientIPAction,omitempty"`
+
+	SkipTraefikInternalPaths bool     `json:"skipTraefikInternalPaths,omitempty"`
+	TraefikInternalPaths     []string `json:"traefikInternalPaths,omitempty"`
+
+	AllowInternalOrchestrationNets bool     `json:"allowInternalOrchestrationNets,omitempty"`
+	OrchestrationNets              []string `json:"orchestrationNets,omitempty"`
+
+	CIDRBloomFilter bool `json:"cidrBloomFilter,omitempty"`
+
+	RejectCatchAllCIDR bool `json:"rejectCatchAllCIDR,omitempty"`
+
+	DryRun     bool   `json:"dryRun,omitempty"`
+	FlagHeader string `json:"flagHeader,omitempty"`
+
+	PassthroughMode bool `json:"passthroughMode,omitempty"`
+
+	AdminPath  string `json:"adminPath,omitempty"`
+	AdminToken string `json:"adminToken,omitempty"`
+
+	MetricsPath string `json:"metricsPath,omitempty"`
+
+	ReevaluateReentrantRequests bool `json:"reevaluateReentrantRequests,omitempty"`
+
+	LogWhitelistOverrides bool `json:"logWhitelistOverrides,omitempty"`
+
+	BlockedContinents []string `json:"blockedContinents,omitempty"`
+	LogGeoResolution  bool     `json:"logGeoResolution,omitempty"`
+
+	GeoDatabaseFile           string `json:"geoDatabaseFile,omitempty"`
+	GeoDatabaseReloadInterval int    `json:"geoDatabaseReloadInterval,omitempty"`
+
+	GeoIPDatabase      string   `json:"geoIPDatabase,omitempty"`
+	BlockedCountries   []string `json:"blockedCountries,omitempty"`
+	WhitelistCountries []string `json:"whitelistCountries,omitempty"`
+
+	GeoIPASNDatabase string `json:"geoIPASNDatabase,omitempty"`
+	BlockedASNs      []int  `json:"blockedASNs,omitempty"`
+
+	BlockedRegions []string `json:"blockedRegions,omitempty"`
+
+	CompositeRules []CompositeRule `json:"compositeRules,omitempty"`
+
+	BlockTorExits          bool   `json:"blockTorExits,omitempty"`
+	TorExitListFile        string `json:"torExitListFile,omitempty"`
+	TorExitListURL         string `json:"torExitListURL,omitempty"`
+	TorExitRefreshInterval int    `json:"torExitRefreshInterval,omitempty"`
+
+	TemporaryBlockSweepInterval int `json:"temporaryBlockSweepInterval,omitempty"`
+
+	TemporaryBlocks []string `json:"temporaryBlocks,omitempty"`
+
+	CacheTemporaryBlocks bool `json:"cacheTemporaryBlocks,omitempty"`
+
+	EventBufferSize int `json:"eventBufferSize,omitempty"`
+
+	AutoBanThreshold int `json:"autoBanThreshold,omitempty"`
+	AutoBanWindow    int `json:"autoBanWindow,omitempty"`
+	AutoBanDuration  int `json:"autoBanDuration,omitempty"`
+
+	Max4xxPerWindow   int `json:"max4xxPerWindow,omitempty"`
+	Max4xxWindow      int `json:"max4xxWindow,omitempty"`
+	Max4xxBanDuration int `json:"max4xxBanDuration,omitempty"`
+
+	ReloadInterval int `json:"reloadInterval,omitempty"`
+
+	NetsetFiles           []string `json:"netsetFiles,omitempty"`
+	NetsetRefreshInterval int      `json:"netsetRefreshInterval,omitempty"`
+
+	StatsDAddress  string `json:"statsDAddress,omitempty"`
+	StatsDPrefix   string `json:"statsDPrefix,omitempty"`
+	StatsDInterval int    `json:"statsDInterval,omitempty"`
+
+	WebhookURL    string `json:"webhookURL,omitempty"`
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+
+	WebhookBatchSize     int `json:"webhookBatchSize,omitempty"`
+	WebhookFlushInterval int `json:"webhookFlushInterval,omitempty"`
+
+	CandidateLists          *CandidateLists `json:"candidateLists,omitempty"`
+	CandidateListSampleRate float64         `json:"candidateListSampleRate,omitempty"`
+
+	Profiles      map[string]Profile `json:"profiles,omitempty"`
+	ActiveProfile string             `json:"activeProfile,omitempty"`
+
+	// Duration string variants take precedence over the integer fields
+	CacheTTLDuration               string `json:"cacheTTLDuration,omitempty"`
+	AllowedCacheTTLDuration        string `json:"allowedCacheTTLDuration,omitempty"`
+	CacheCleanupIntervalDuration   string `json:"cacheCleanupIntervalDuration,omitempty"`
+	LookupWaitTimeoutDuration      string `json:"lookupWaitTimeoutDuration,omitempty"`
+	TorExitRefreshIntervalDuration string `json:"torExitRefreshIntervalDuration,omitempty"`
+
+	TemporaryBlockSweepIntervalDuration string `json:"temporaryBlockSweepIntervalDuration,omitempty"`
+	NetsetRefreshIntervalDuration       string `json:"netsetRefreshIntervalDuration,omitempty"`
+	ReloadIntervalDuration              string `json:"reloadIntervalDuration,omitempty"`
+	GeoDatabaseReloadIntervalDuration   string `json:"geoDatabaseReloadIntervalDuration,omitempty"`
+	StatsDIntervalDuration              string `json:"statsDIntervalDuration,omitempty"`
+	WebhookFlushIntervalDuration        string `json:"webhookFlushIntervalDuration,omitempty"`
+	AutoBanWindowDuration               string `json:"autoBanWindowDuration,omitempty"`
+	Max4xxWindowDuration                string `json:"max4xxWindowDuration,omitempty"`
+	CachePersistIntervalDuration        string `json:"cachePersistIntervalDuration,omitempty"`
+
+	SlowDecisionThresholdMs int `json:"slowDecisionThresholdMs,omitempty"`
+
+	MaxConcurrentLookups int    `json:"maxConcurrentLookups,omitempty"`
+	LookupWaitTimeout    int    `json:"lookupWaitTimeout,omitempty"`
+	LookupOverflowAction string `json:"lookupOverflowAction,omitempty"`
+}
+
+// ListGroup is a named set of block rules that carries its own response.
+// StatusCode and Message fall back to the global values when unset.
+type ListGroup struct {
+	Name         string   `json:"name,omitempty"`
+	BlockedIPs   []string `json:"blockedIPs,omitempty"`
+	BlockedCIDRs []string `json:"blockedCIDRs,omitempty"`
+	StatusCode   int      `json:"statusCode,omitempty"`
+	Message      string   `json:"message,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration
@@ -28,160 +284,2062 @@ func CreateConfig() *Config {
 		BlockedCIDRs:   []string{},
 		WhitelistIPs:   []string{},
 		WhitelistCIDRs: []string{},
+		ListGroups:     []ListGroup{},
 		StatusCode:     403,
 		Message:        "Access Denied",
 		Debug:          false,
 		CacheTTL:       300,
+
+		CacheMaxEntries: 100000,
+		AllowedCacheTTL: 60,
+
+		CachePersistInterval: 60,
+
+		HotCachePromoteHits: 3,
+
+		RatePeriod:       60,
+		WarnOnEmptyLists: true,
+
+		DistinctPathsPeriod: 60,
+
+		LookupOverflowAction: actionAllow,
+		TraefikInternalPaths: defaultTraefikInternalPaths(),
+		ClientIPHeaders:      defaultClientIPHeaders(),
+		OrchestrationNets:    defaultOrchestrationNets(),
+
+		VerifiedCrawlerDomains: defaultCrawlerDomains(),
+		BodyPeekSize:           defaultBodyPeekSize,
+
+		TorExitRefreshInterval: 3600,
+
+		TemporaryBlockSweepInterval: 60,
+		NetsetRefreshInterval:       3600,
+
+		AutoBanWindow:   60,
+		AutoBanDuration: 3600,
+
+		Max4xxWindow:      60,
+		Max4xxBanDuration: 3600,
+
+		StatsDPrefix:   "blockip",
+		StatsDInterval: 10,
+
+		WebhookFlushInterval: 5,
 	}
 }
 
-// IPCache provides fast caching for IP lookup results
+// IPCache provides fast caching for IP lookup results. Entries are spread
+// over shards, each with its own lock, to reduce contention.
 type IPCache struct {
+	shards []*cacheShard
+	size   atomic.Int64
+	ttl    time.Duration
+
+	// maxEntries caps the cache size; once it is reached each new entry
+	// evicts the least recently used entry across all shards
+	maxEntries int
+	evictions  atomic.Int64
+	clock      atomic.Int64 // orders uses across shards
+
+	// noEviction turns maxEntries into a hard limit: caching is disabled
+	// once it is reached and re-enabled when expired entries bring usage
+	// down to half of it
+	noEviction  bool
+	disabled    atomic.Bool
+	lastCleanup atomic.Int64
+	limitMu     sync.Mutex // serializes re-enabling
+}
+
+// cacheShard holds the entries of one IPCache shard, most recently used
+// first
+type cacheShard struct {
 	mu    sync.RWMutex
-	cache map[string]CacheEntry
+	cache map[string]*list.Element // ip -> *cacheItem in lru
+	lru   *list.List
+}
+
+// cacheItem is an entry of a cacheShard's LRU list
+type cacheItem struct {
+	ip    string
+	entry CacheEntry
+	used  int64 // IPCache.clock value at the last use
 }
 
 // CacheEntry represents a cached lookup result
 type CacheEntry struct {
 	Status    string // "allowed", "blocked", "whitelisted"
-	Timestamp int64
+	Rule      string // matched block rule, empty when no rule matched
+	Timestamp int64  // UnixNano time the entry was stored
+	Expires   int64  // UnixNano time the block ends, 0 to expire with the TTL
+	Geo       *GeoRecord
+}
+
+// expired reports whether the entry has outlived ttl or its block at now
+func (e CacheEntry) expired(now int64, ttl time.Duration) bool {
+	return now-e.Timestamp >= int64(ttl) || (e.Expires != 0 && now >= e.Expires)
+}
+
+// decision is the outcome of evaluating a client IP against the rules. For
+// whitelisted decisions rule holds the block rule the whitelist overrode.
+type decision struct {
+	status    string
+	rule      string
+	transient bool       // transient decisions are not cached
+	evaluated bool       // decided from the rules rather than the cache
+	geo       *GeoRecord // resolved geolocation, nil when not looked up
+
+	retryAfter time.Duration // sent as Retry-After when positive
+}
+
+// blockResponse is a pre-rendered response sent to blocked clients
+type blockResponse struct {
+	statusCode int
+	body       []byte
+	message    string // the message before formatting
+}
+
+// ipLookupService holds the parsed lists and the lookup cache
+type ipLookupService struct {
+	mu              sync.RWMutex
+	blockedIPsSet   map[string]bool
+	blockedNets     []*net.IPNet
+	whitelistIPsSet map[string]bool
+	whitelistNets   []*net.IPNet
+	ruleGroups      map[string]string
+	blockedBloom    *cidrBloom
+	blockedTrie     *cidrTrie // nil until buildIndex, then used over blockedNets
+	whitelistTrie   *cidrTrie
+	listsBase       *listSet // lists before list files were merged in
+	ruleSources     map[string]string
+	negatedNets     []*net.IPNet
+	unblocks        map[string]int64
+	tempBlocks      map[string]int64
+	cache           *IPCache
+	allowedCache    *IPCache
+	hot             *hotSet // nil when the hot set is disabled
 }
 
 // BlockIP is the main plugin handler
 type BlockIP struct {
-	next   http.Handler
-	name   string
-	config *Config
-	cache  *IPCache
+	next            http.Handler
+	name            string
+	lookup          *ipLookupService
+	statusCode      int
+	redirectURL     string
+	blockPage       *blockPage
+	message         string
+	debug           bool
+	logger          *Logger
+	responseFormat  string
+	contentType     string
+	response        blockResponse
+	groupResponses  map[string]blockResponse
+	gzipBodies      map[string][]byte
+	wwwAuthenticate string
+	template        *responseTemplate
+
+	rateLimitResponse blockResponse
+	challengeResponse blockResponse
+
+	stripResponseHeaders []string
+	responseHeaders      http.Header
+
+	decider        Decider
+	lookupSlots    chan struct{}
+	lookupWait     time.Duration
+	overflowStatus string
+
+	slowDecisionThreshold time.Duration
+
+	skipPaths []string
+
+	cacheTemporaryBlocks bool
+
+	dryRun      bool
+	flagHeader  string
+	passthrough bool
+
+	adminPath  string
+	adminToken string
+
+	metricsPath string
+	metrics     requestMetrics
+
+	reevaluateReentrant bool
+
+	logWhitelistOverrides bool
+	rejectCatchAllCIDR    bool
+	stats                 pluginStats
+
+	geoResolver        GeoResolver
+	geoDatabase        *geoDatabase
+	blockedContinents  map[string]bool
+	blockedCountries   map[string]bool
+	whitelistCountries map[string]bool
+	asnDatabase        *geoDatabase
+	blockedASNs        map[uint32]bool
+	blockedRegions     map[string]bool
+	logGeoResolution   bool
+	compositeRules     []*compositeRule
+
+	torExits  *torExitList
+	netsets   *netsetList
+	listFiles *listFiles
+
+	rateLimiter *rateLimiter
+	cidrLimits  []*cidrRateLimit
+	pathTracker *pathTracker
+
+	blockPlaintextHTTP bool
+	blockedSchemes     map[string]bool
+
+	blockedCipherSuites map[uint16]string
+
+	blockedSourcePorts []portRange
+	allowedSourcePorts []portRange
+
+	detectHeaderConflict bool
+	blockHeaderConflict  bool
+
+	bodySignatures [][]byte
+	bodyPeekSize   int
+
+	allowVerifiedCrawlers bool
+	crawlerDomains        []string
+	dnsResolver           DNSResolver
+
+	hostRules         []*hostRuleset
+	pathRules         []*pathRuleset
+	useXForwardedHost bool
+	trustedProxies    []*net.IPNet
+
+	xffClientIsLeftmost bool
+	clientIPSources     []ipSource
+
+	noIPAction string
+
+	defaultDeny bool
+
+	statsd  *statsdClient
+	webhook *webhookClient
+	autoBan *autoBanner
+	events  chan DecisionEvent
+
+	scanDetector *autoBanner
+
+	candidate *candidateEvaluator
+
+	cancel context.CancelFunc
 }
 
 // New creates a new BlockIP plugin instance
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
-	return &BlockIP{
-		next:   next,
-		name:   name,
-		config: config,
-		cache: &IPCache{
-			cache: make(map[string]CacheEntry),
-		},
-	}, nil
-}
+	if config == nil {
+		return nil, ErrConfigNil
+	}
 
-// ServeHTTP implements the http.Handler interface
-func (b *BlockIP) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	clientIP := b.getClientIP(req)
-	
-	if b.config.Debug {
-		fmt.Printf("[BlockIP] Processing request from IP: %s\n", clientIP)
+	if next == nil {
+		return nil, ErrNextHandlerNil
+	}
+
+	config, err := applyProfile(config)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Check whitelist first (highest priority)
-	if b.isWhitelisted(clientIP) {
-		if b.config.Debug {
-			fmt.Printf("[BlockIP] IP %s is whitelisted, allowing\n", clientIP)
+
+	statusCode := config.StatusCode
+	redirectURL := ""
+	if config.RedirectURL != "" {
+		if redirectURL, err = parseRedirectURL(config.RedirectURL); err != nil {
+			return nil, err
 		}
-		b.next.ServeHTTP(rw, req)
-		return
+		if statusCode, err = redirectStatusCode(statusCode); err != nil {
+			return nil, err
+		}
+	} else if !isErrorStatusCode(statusCode) {
+		return nil, NewBlockIPError(ErrCodeInvalidStatusCode,
+			fmt.Sprintf("invalid status code: %d, must be 4xx or 5xx", statusCode), nil)
+	}
+
+	overflowStatus, err := parseOverflowAction(config.LookupOverflowAction)
+	if err != nil {
+		return nil, err
+	}
+
+	noIPAction, err := parseNoIPAction(config.NoIPAction, config.UnparsableClientIPAction)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTTL, err := resolveDuration("cacheTTLDuration", config.CacheTTLDuration, config.CacheTTL, time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedCacheTTL, err := resolveDuration("allowedCacheTTLDuration", config.AllowedCacheTTLDuration, config.AllowedCacheTTL, time.Second)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Check blocked list
-	if b.isBlocked(clientIP) {
-		if b.config.Debug {
-			fmt.Printf("[BlockIP] IP %s is blocked, rejecting\n", clientIP)
+	if allowedCacheTTL > cacheTTL {
+		allowedCacheTTL = cacheTTL
+	}
+
+	lookupWait, err := resolveDuration("lookupWaitTimeoutDuration", config.LookupWaitTimeoutDuration, config.LookupWaitTimeout, time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := normalizeBody("message", config.Message, config.StrictBodyEncoding, config.NormalizeLineEndings)
+	if err != nil {
+		return nil, err
+	}
+
+	responseFormat, err := parseResponseFormat(config.ResponseFormat)
+	if err != nil {
+		return nil, err
+	}
+	logFormat, err := parseLogFormat(config.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.CacheMaxEntries < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "cacheMaxEntries must not be negative", nil)
+	}
+	if config.CacheShards < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "cacheShards must not be negative", nil)
+	}
+	if config.HotCacheSize < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "hotCacheSize must not be negative", nil)
+	}
+	if config.HotCacheSize > 0 && config.HotCachePromoteHits < 1 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "hotCachePromoteHits must be at least 1", nil)
+	}
+
+	b := &BlockIP{
+		next:            next,
+		name:            name,
+		lookup:          newIPLookupService(cacheTTL, allowedCacheTTL, config.CacheMaxEntries, config.CacheShards),
+		statusCode:      statusCode,
+		redirectURL:     redirectURL,
+		message:         message,
+		debug:           config.Debug,
+		logger:          NewLogger(config.Debug),
+		responseFormat:  responseFormat,
+		contentType:     formatContentType(responseFormat),
+		groupResponses:  make(map[string]blockResponse),
+		wwwAuthenticate: config.WWWAuthenticate,
+		lookupWait:      lookupWait,
+		overflowStatus:  overflowStatus,
+		dryRun:          config.DryRun,
+		flagHeader:      http.CanonicalHeaderKey(strings.TrimSpace(config.FlagHeader)),
+		passthrough:     config.PassthroughMode,
+		adminPath:       strings.TrimSuffix(config.AdminPath, "/"),
+		metricsPath:     config.MetricsPath,
+		adminToken:      config.AdminToken,
+
+		logWhitelistOverrides: config.LogWhitelistOverrides,
+		rejectCatchAllCIDR:    config.RejectCatchAllCIDR,
+	}
+
+	b.logger.format = logFormat
+	b.reevaluateReentrant = config.ReevaluateReentrantRequests
+	b.response = b.newBlockResponse(b.statusCode, message)
+	b.stripResponseHeaders = cleanHeaderNames(config.StripResponseHeaders)
+	if b.responseHeaders, err = parseResponseHeaders(config.ResponseHeaders); err != nil {
+		return nil, err
+	}
+	b.rateLimitResponse = b.newBlockResponse(http.StatusTooManyRequests, rateLimitBody)
+	b.challengeResponse = b.newBlockResponse(http.StatusUnauthorized, message)
+
+	if config.DisableCacheEviction {
+		b.lookup.disableEviction()
+	}
+	if config.HotCacheSize > 0 {
+		b.lookup.hot = newHotSet(config.HotCacheSize, config.HotCachePromoteHits)
+	}
+
+	if b.blockedContinents, err = parseContinents(config.BlockedContinents); err != nil {
+		return nil, err
+	}
+	if b.blockedCountries, err = parseCountries("blockedCountries", config.BlockedCountries); err != nil {
+		return nil, err
+	}
+	if b.whitelistCountries, err = parseCountries("whitelistCountries", config.WhitelistCountries); err != nil {
+		return nil, err
+	}
+	if b.blockedRegions, err = parseRegions(config.BlockedRegions); err != nil {
+		return nil, err
+	}
+	b.logGeoResolution = config.LogGeoResolution
+	geoDatabaseFile := config.GeoDatabaseFile
+	if config.GeoIPDatabase != "" {
+		if geoDatabaseFile != "" && geoDatabaseFile != config.GeoIPDatabase {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, "geoIPDatabase and geoDatabaseFile cannot point to different files", nil)
 		}
-		rw.WriteHeader(b.config.StatusCode)
-		rw.Write([]byte(b.config.Message))
-		return
+		geoDatabaseFile = config.GeoIPDatabase
+	}
+	if geoDatabaseFile != "" {
+		b.geoDatabase = &geoDatabase{path: geoDatabaseFile}
+		if err := b.geoDatabase.load(); err != nil {
+			return nil, err
+		}
+		b.geoResolver = b.geoDatabase
+	}
+	if b.blockedASNs, err = parseASNs(config.BlockedASNs); err != nil {
+		return nil, err
+	}
+	if config.GeoIPASNDatabase != "" {
+		b.asnDatabase = &geoDatabase{path: config.GeoIPASNDatabase}
+		if err := b.asnDatabase.load(); err != nil {
+			return nil, err
+		}
+		if b.geoResolver != nil {
+			b.geoResolver = asnGeoResolver{country: b.geoResolver, asn: b.asnDatabase}
+		} else {
+			b.geoResolver = b.asnDatabase
+		}
+	}
+	if b.compositeRules, err = loadCompositeRules(config.CompositeRules); err != nil {
+		return nil, err
 	}
-	
-	// Not blocked, allow
-	b.next.ServeHTTP(rw, req)
-}
 
-// getClientIP extracts the client IP from the request
-func (b *BlockIP) getClientIP(req *http.Request) string {
-	// Check X-Forwarded-For first
-	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
+	if b.adminPath != "" && b.adminToken == "" {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "adminToken is required when adminPath is set", nil)
+	}
+	if b.metricsPath != "" && b.adminToken == "" {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "adminToken is required when metricsPath is set", nil)
+	}
+
+	if b.hostRules, err = loadHostRules(config.HostRules, config.RejectCatchAllCIDR); err != nil {
+		return nil, err
+	}
+	if b.pathRules, err = loadPathRules(config.PathRules, config.RejectCatchAllCIDR); err != nil {
+		return nil, err
+	}
+	if b.trustedProxies, err = parseNetworks("trustedProxies", config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	b.useXForwardedHost = config.UseXForwardedHost
+	b.xffClientIsLeftmost = config.XFFClientIsLeftmost
+	clientIPHeaders := config.ClientIPHeaders
+	if config.CDNProvider != "" {
+		if len(config.ClientIPSources) > 0 {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, "cdnProvider cannot be combined with clientIPSources", nil)
 		}
+		if clientIPHeaders, err = cdnHeaders(config.CDNProvider); err != nil {
+			return nil, err
+		}
+	}
+	if b.clientIPSources, err = loadClientIPSources(config.ClientIPSources, clientIPHeaders, b.trustedProxies); err != nil {
+		return nil, err
 	}
-	
-	// Check X-Real-IP
-	if xri := req.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
+	b.noIPAction = noIPAction
+
+	switch config.DefaultAction {
+	case "", actionAllow:
+	case actionDeny:
+		b.defaultDeny = true
+	default:
+		return nil, NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid default action: %q, must be %q or %q", config.DefaultAction, actionAllow, actionDeny), nil)
 	}
-	
-	// Check CF-Connecting-IP (Cloudflare)
-	if cfIP := req.Header.Get("CF-Connecting-IP"); cfIP != "" {
-		return strings.TrimSpace(cfIP)
+	if b.candidate, err = newCandidateEvaluator(config.CandidateLists, config.CandidateListSampleRate); err != nil {
+		return nil, err
 	}
-	
-	// Fall back to RemoteAddr
-	if ra := req.RemoteAddr; ra != "" {
-		host, _, err := net.SplitHostPort(ra)
-		if err == nil {
-			return host
+	b.blockPlaintextHTTP = config.BlockPlaintextHTTP
+	if b.blockedSchemes, err = parseSchemes(config.BlockedSchemes); err != nil {
+		return nil, err
+	}
+	if b.blockedCipherSuites, err = parseCipherSuites(config.BlockedCipherSuites); err != nil {
+		return nil, err
+	}
+	if b.blockedSourcePorts, err = parsePortRanges("blockedSourcePorts", config.BlockedSourcePorts); err != nil {
+		return nil, err
+	}
+	if b.allowedSourcePorts, err = parsePortRanges("allowedSourcePorts", config.AllowedSourcePorts); err != nil {
+		return nil, err
+	}
+
+	b.detectHeaderConflict = config.DetectHeaderConflict
+	if b.blockHeaderConflict, err = parseHeaderConflictAction(config.HeaderConflictAction); err != nil {
+		return nil, err
+	}
+
+	b.allowVerifiedCrawlers = config.AllowVerifiedCrawlers
+	b.dnsResolver = net.DefaultResolver
+	for _, domain := range config.VerifiedCrawlerDomains {
+		b.crawlerDomains = append(b.crawlerDomains, strings.ToLower(strings.Trim(strings.TrimSpace(domain), ".")))
+	}
+
+	if b.bodyPeekSize, err = parseBodyPeekSize(config.BodyPeekSize); err != nil {
+		return nil, err
+	}
+	for _, signature := range config.BodySignatures {
+		if signature == "" {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, "body signature is empty", nil)
 		}
-		return ra
+		b.bodySignatures = append(b.bodySignatures, []byte(signature))
 	}
-	
-	return ""
-}
 
-// isWhitelisted checks if IP is in whitelist
-func (b *BlockIP) isWhitelisted(ip string) bool {
-	// Check direct IP whitelist
-	for _, whiteIP := range b.config.WhitelistIPs {
-		if ip == whiteIP {
-			return true
+	if config.SkipTraefikInternalPaths {
+		b.skipPaths = config.TraefikInternalPaths
+	}
+
+	if config.RateLimit < 0 || config.RatePeriod < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "rateLimit and ratePeriod must not be negative", nil)
+	}
+	if config.RateLimit > 0 {
+		period := time.Duration(config.RatePeriod) * time.Second
+		if period == 0 {
+			period = time.Minute
 		}
+		b.rateLimiter = newRateLimiter(config.RateLimit, period, config.PerPathRateLimit)
 	}
-	
-	// Check whitelist CIDR ranges
-	for _, cidr := range b.config.WhitelistCIDRs {
-		if b.matchCIDR(ip, cidr) {
-			return true
+	ratePeriod := time.Duration(config.RatePeriod) * time.Second
+	if ratePeriod == 0 {
+		ratePeriod = time.Minute
+	}
+	if b.cidrLimits, err = loadCIDRRateLimits(config.CIDRRateLimits, ratePeriod); err != nil {
+		return nil, err
+	}
+
+	if config.MaxDistinctPaths < 0 || config.DistinctPathsPeriod < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "maxDistinctPaths and distinctPathsPeriod must not be negative", nil)
+	}
+	if config.MaxDistinctPaths > 0 {
+		period := time.Duration(config.DistinctPathsPeriod) * time.Second
+		if period == 0 {
+			period = time.Minute
 		}
+		b.pathTracker = newPathTracker(config.MaxDistinctPaths, period)
 	}
-	
-	return false
-}
 
-// isBlocked checks if IP is blocked
-func (b *BlockIP) isBlocked(ip string) bool {
-	// Check direct IP block list
-	for _, blockedIP := range b.config.BlockedIPs {
-		if ip == blockedIP {
-			return true
+	if config.SlowDecisionThresholdMs < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid slowDecisionThresholdMs: %d, must not be negative", config.SlowDecisionThresholdMs), nil)
+	}
+	b.slowDecisionThreshold = time.Duration(config.SlowDecisionThresholdMs) * time.Millisecond
+
+	if config.MaxConcurrentLookups > 0 {
+		b.lookupSlots = make(chan struct{}, config.MaxConcurrentLookups)
+	}
+
+	if err := b.loadConfiguration(config); err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if config.AllowInternalOrchestrationNets {
+		nets, err := parseNetworks("orchestrationNets", config.OrchestrationNets)
+		if err != nil {
+			return nil, err
 		}
+		b.lookup.whitelistNets = append(b.lookup.whitelistNets, nets...)
 	}
-	
-	// Check blocked CIDR ranges
-	for _, cidr := range b.config.BlockedCIDRs {
-		if b.matchCIDR(ip, cidr) {
-			return true
+
+	if config.BlockedIPsFile != "" || config.WhitelistIPsFile != "" {
+		b.listFiles = &listFiles{blocked: config.BlockedIPsFile, whitelist: config.WhitelistIPsFile}
+		if err := b.loadListFiles(); err != nil {
+			return nil, err
 		}
 	}
-	
-	return false
-}
 
-// matchCIDR checks if IP matches CIDR range
-func (b *BlockIP) matchCIDR(ip string, cidr string) bool {
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
-		return false
+	if len(config.NetsetFiles) > 0 {
+		b.netsets = &netsetList{files: config.NetsetFiles}
+		if err := b.loadNetsets(); err != nil {
+			return nil, err
+		}
 	}
-	
-	_, ipnet, err := net.ParseCIDR(cidr)
-	if err != nil {
-		if b.config.Debug {
-			fmt.Printf("[BlockIP] Invalid CIDR %s: %v\n", cidr, err)
+
+	if config.CachePreloadFile != "" {
+		if err := b.preloadCache(config.CachePreloadFile); err != nil {
+			return nil, err
 		}
-		return false
 	}
-	
-	return ipnet.Contains(parsedIP)
+
+	var persistInterval time.Duration
+	if config.CachePersistPath != "" {
+		if persistInterval, err = resolveDuration("cachePersistIntervalDuration",
+			config.CachePersistIntervalDuration, config.CachePersistInterval, time.Second); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.defaultDeny && config.RequireWhitelistInDenyMode &&
+		len(b.lookup.whitelistIPsSet) == 0 && len(b.lookup.whitelistNets) == 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "default action is deny but no whitelist entries were loaded", nil)
+	}
+
+	if !b.defaultDeny && len(b.lookup.blockedIPsSet) == 0 && len(b.lookup.blockedNets) == 0 && len(b.lookup.negatedNets) == 0 && (b.netsets == nil || b.netsets.size() == 0) {
+		if config.ErrorOnEmptyLists {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, "no blocked IPs or CIDRs were loaded", nil)
+		}
+		if config.WarnOnEmptyLists {
+			b.logger.Warn("[%s] No blocked IPs or CIDRs were loaded", b.name)
+		}
+	}
+
+	if config.ResponseTemplate != "" && config.ResponseTemplateFile != "" {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "responseTemplate and responseTemplateFile cannot both be set", nil)
+	}
+	if config.ResponseTemplate != "" {
+		if b.template, err = parseResponseTemplate(config.ResponseTemplate, config.ResponseContentType); err != nil {
+			return nil, err
+		}
+	}
+	if config.ResponseTemplateFile != "" {
+		if b.template, err = loadResponseTemplateFile(config.ResponseTemplateFile); err != nil {
+			return nil, err
+		}
+	}
+	if config.BlockPageDir != "" {
+		if b.template != nil {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, "blockPageDir cannot be combined with a response template", nil)
+		}
+		if b.blockPage, err = loadBlockPage(config.BlockPageDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.CompressBlockResponse {
+		b.prepareCompressedBodies()
+	}
+
+	b.lookup.buildIndex()
+	if collapsed := b.lookup.collapsedCIDRs(); collapsed > 0 && b.debug {
+		b.logger.Debug("[%s] Collapsed %d overlapping or adjacent CIDRs", b.name, collapsed)
+	}
+
+	if config.CIDRBloomFilter {
+		b.lookup.blockedBloom = newCIDRBloom(b.lookup.blockedNets)
+	}
+
+	// Restored entries are checked against the index, so load them after it
+	// is built. A bad cache file only costs a cold start.
+	if config.CachePersistPath != "" {
+		if err := b.loadPersistedCache(config.CachePersistPath); err != nil {
+			b.logger.Warn("[%s] Ignoring persisted cache: %v", b.name, err)
+		}
+	}
+
+	b.cacheTemporaryBlocks = config.CacheTemporaryBlocks
+	if err := b.loadTemporaryBlocks(config.TemporaryBlocks); err != nil {
+		return nil, err
+	}
+	if config.EventBufferSize < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("eventBufferSize must not be negative, got %d", config.EventBufferSize), nil)
+	}
+	if config.EventBufferSize > 0 {
+		b.events = make(chan DecisionEvent, config.EventBufferSize)
+	}
+	if config.AutoBanThreshold != 0 {
+		window, err := resolveDuration("autoBanWindowDuration", config.AutoBanWindowDuration, config.AutoBanWindow, time.Second)
+		if err != nil {
+			return nil, err
+		}
+		b.autoBan, err = newAutoBanner(config.AutoBanThreshold, window, time.Duration(config.AutoBanDuration)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Max4xxPerWindow != 0 {
+		window, err := resolveDuration("max4xxWindowDuration", config.Max4xxWindowDuration, config.Max4xxWindow, time.Second)
+		if err != nil {
+			return nil, err
+		}
+		b.scanDetector, err = newScannerDetector(config.Max4xxPerWindow, window, time.Duration(config.Max4xxBanDuration)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sweepInterval, err := resolveDuration("temporaryBlockSweepIntervalDuration",
+		config.TemporaryBlockSweepIntervalDuration, config.TemporaryBlockSweepInterval, time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cache cleanup interval defaults to the cache TTL
+	cleanupInterval, err := resolveDuration("cacheCleanupIntervalDuration",
+		config.CacheCleanupIntervalDuration, config.CacheCleanupInterval, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if cleanupInterval == 0 {
+		cleanupInterval = cacheTTL
+	}
+
+	ctx, b.cancel = context.WithCancel(ctx)
+
+	if sweepInterval > 0 {
+		go b.sweepTemporaryBlocks(ctx, sweepInterval)
+	}
+	if b.autoBan != nil {
+		go sweepAttempts(ctx, b.autoBan)
+	}
+	if b.scanDetector != nil {
+		go sweepAttempts(ctx, b.scanDetector)
+	}
+	if b.rateLimiter != nil || len(b.cidrLimits) > 0 {
+		go b.sweepRateLimits(ctx, ratePeriod)
+	}
+	if config.CachePersistPath != "" {
+		go b.persistCache(ctx, config.CachePersistPath, persistInterval)
+	}
+
+	if cleanupInterval > 0 && cacheTTL > 0 {
+		go b.sweepCache(ctx, cleanupInterval)
+	}
+
+	if len(b.geoDatabases()) > 0 {
+		geoInterval, err := resolveDuration("geoDatabaseReloadIntervalDuration",
+			config.GeoDatabaseReloadIntervalDuration, config.GeoDatabaseReloadInterval, time.Second)
+		if err != nil {
+			b.cancel()
+			return nil, err
+		}
+		if geoInterval > 0 {
+			go b.watchGeoDatabase(ctx, geoInterval)
+		}
+	}
+
+	if b.listFiles != nil {
+		reloadInterval, err := resolveDuration("reloadIntervalDuration",
+			config.ReloadIntervalDuration, config.ReloadInterval, time.Second)
+		if err != nil {
+			b.cancel()
+			return nil, err
+		}
+		if reloadInterval > 0 {
+			go b.watchListFiles(ctx, reloadInterval)
+		}
+	}
+
+	if b.netsets != nil {
+		netsetInterval, err := resolveDuration("netsetRefreshIntervalDuration",
+			config.NetsetRefreshIntervalDuration, config.NetsetRefreshInterval, time.Second)
+		if err != nil {
+			b.cancel()
+			return nil, err
+		}
+		if netsetInterval > 0 {
+			go b.refreshNetsets(ctx, netsetInterval)
+		}
+	}
+
+	if config.BlockTorExits {
+		if err := b.startTorExits(ctx, config); err != nil {
+			b.cancel()
+			return nil, err
+		}
+	}
+
+	if config.StatsDAddress != "" {
+		if err := b.startStatsD(ctx, config); err != nil {
+			b.cancel()
+			return nil, err
+		}
+	}
+
+	if config.WebhookURL != "" {
+		flushInterval, err := resolveDuration("webhookFlushIntervalDuration",
+			config.WebhookFlushIntervalDuration, config.WebhookFlushInterval, time.Second)
+		if err != nil {
+			b.cancel()
+			return nil, err
+		}
+		if b.webhook, err = newWebhookClient(config.WebhookURL, config.WebhookSecret, config.WebhookBatchSize); err != nil {
+			b.cancel()
+			return nil, err
+		}
+		go b.runWebhook(ctx, flushInterval)
+	}
+
+	if b.debug {
+		b.logger.Debug("[%s] Plugin initialized with status code %d", b.name, b.statusCode)
+	}
+
+	return b, nil
+}
+
+// startTorExits loads the Tor exit list and starts its refresh loop
+func (b *BlockIP) startTorExits(ctx context.Context, config *Config) error {
+	if config.TorExitListFile == "" && config.TorExitListURL == "" {
+		return NewBlockIPError(ErrCodeInvalidConfig, "blockTorExits requires torExitListFile or torExitListURL", nil)
+	}
+
+	interval, err := resolveDuration("torExitRefreshIntervalDuration", config.TorExitRefreshIntervalDuration, config.TorExitRefreshInterval, time.Second)
+	if err != nil {
+		return err
+	}
+
+	b.torExits = &torExitList{file: config.TorExitListFile, url: config.TorExitListURL}
+	if err := b.loadTorExits(ctx); err != nil {
+		return err
+	}
+
+	if interval > 0 {
+		go b.refreshTorExits(ctx, interval)
+	}
+	return nil
+}
+
+// Stop stops the plugin's background workers
+func (b *BlockIP) Stop() {
+	b.cancel()
+}
+
+// newIPLookupService creates an empty lookup service
+func newIPLookupService(cacheTTL, allowedCacheTTL time.Duration, cacheMaxEntries int, cacheShards int) *ipLookupService {
+	return &ipLookupService{
+		blockedIPsSet:   make(map[string]bool),
+		blockedNets:     make([]*net.IPNet, 0),
+		whitelistIPsSet: make(map[string]bool),
+		whitelistNets:   make([]*net.IPNet, 0),
+		ruleGroups:      make(map[string]string),
+		unblocks:        make(map[string]int64),
+		tempBlocks:      make(map[string]int64),
+		cache:           newIPCache(cacheTTL, cacheMaxEntries, cacheShards),
+		allowedCache:    newIPCache(allowedCacheTTL, cacheMaxEntries, cacheShards),
+	}
+}
+
+// buildIndex builds the prefix tries over the CIDR lists. It must run again
+// after the lists change.
+func (s *ipLookupService) buildIndex() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.indexLocked()
+}
+
+// indexLocked builds the prefix tries. Callers must hold s.mu.
+func (s *ipLookupService) indexLocked() {
+	s.blockedTrie = newCIDRTrie(s.blockedNets)
+	s.whitelistTrie = newCIDRTrie(s.whitelistNets)
+}
+
+// loadConfiguration parses the configured lists into the lookup service
+func (b *BlockIP) loadConfiguration(config *Config) error {
+	for _, ip := range config.BlockedIPs {
+		b.addBlockedIP(ip, "")
+	}
+
+	for _, cidr := range config.BlockedCIDRs {
+		if err := b.parseCIDR(cidr, false, ""); err != nil {
+			if isCatchAllError(err) {
+				return err
+			}
+			b.logger.Error("[%s] Error parsing blocked CIDR %s: %v", b.name, cidr, err)
+		}
+	}
+
+	if err := b.addFamilyEntries("blockedIPv4", config.BlockedIPv4, false); err != nil {
+		return err
+	}
+	if err := b.addFamilyEntries("blockedIPv6", config.BlockedIPv6, true); err != nil {
+		return err
+	}
+
+	for _, ip := range config.WhitelistIPs {
+		ip = ipsanitize.Clean(ip)
+		if !isValidIP(ip) {
+			b.logger.Error("[%s] Invalid whitelist IP format: %s", b.name, ip)
+			continue
+		}
+		ip = canonicalIP(ip)
+		b.lookup.whitelistIPsSet[ip] = true
+		if b.debug {
+			b.logger.Debug("[%s] Added whitelist IP: %s", b.name, ip)
+		}
+	}
+
+	for _, cidr := range config.WhitelistCIDRs {
+		if err := b.parseCIDR(cidr, true, ""); err != nil {
+			b.logger.Error("[%s] Error parsing whitelist CIDR %s: %v", b.name, cidr, err)
+		}
+	}
+
+	seen := make(map[string]bool, len(config.ListGroups))
+	for _, group := range config.ListGroups {
+		if group.Name == "" {
+			return NewBlockIPError(ErrCodeInvalidConfig, "list group name is empty", nil)
+		}
+		if seen[group.Name] {
+			return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("duplicate list group %q", group.Name), nil)
+		}
+		seen[group.Name] = true
+
+		statusCode, message := b.statusCode, b.message
+		if group.StatusCode != 0 {
+			if !isErrorStatusCode(group.StatusCode) {
+				return NewBlockIPError(ErrCodeInvalidStatusCode,
+					fmt.Sprintf("invalid status code for list group %q: %d, must be 4xx or 5xx", group.Name, group.StatusCode), nil)
+			}
+			statusCode = group.StatusCode
+		}
+		if group.Message != "" {
+			var err error
+			message, err = normalizeBody(fmt.Sprintf("message of list group %q", group.Name),
+				group.Message, config.StrictBodyEncoding, config.NormalizeLineEndings)
+			if err != nil {
+				return err
+			}
+		}
+		b.groupResponses[group.Name] = b.newBlockResponse(statusCode, message)
+
+		for _, ip := range group.BlockedIPs {
+			b.addBlockedIP(ip, group.Name)
+		}
+		for _, cidr := range group.BlockedCIDRs {
+			if err := b.parseCIDR(cidr, false, group.Name); err != nil {
+				if isCatchAllError(err) {
+					return err
+				}
+				b.logger.Error("[%s] Error parsing blocked CIDR %s: %v", b.name, cidr, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// addBlockedIP adds a single IP to the block list, attributed to group
+func (b *BlockIP) addBlockedIP(ip string, group string) {
+	ip = ipsanitize.Clean(ip)
+	if !isValidIP(ip) {
+		b.logger.Error("[%s] Invalid IP format: %s", b.name, ip)
+		return
+	}
+
+	ip = canonicalIP(ip)
+	b.lookup.blockedIPsSet[ip] = true
+	if _, exists := b.lookup.ruleGroups[ip]; !exists {
+		b.lookup.ruleGroups[ip] = group
+	}
+	if b.debug {
+		b.logger.Debug("[%s] Added blocked IP: %s", b.name, ip)
+	}
+}
+
+// parseCIDR parses a CIDR and adds it to the whitelist or block list
+func (b *BlockIP) parseCIDR(cidr string, isWhitelist bool, group string) error {
+	if rest, negated := strings.CutPrefix(strings.TrimSpace(cidr), negationPrefix); negated {
+		if isWhitelist {
+			return fmt.Errorf("negated CIDR %s is only supported in block lists", cidr)
+		}
+		return b.addNegatedCIDR(rest, group)
+	}
+
+	ipnet, err := parseCanonicalCIDR(ipsanitize.Clean(cidr))
+	if err != nil {
+		return fmt.Errorf("invalid CIDR format: %w", err)
+	}
+
+	if !isWhitelist && b.rejectCatchAllCIDR && isCatchAll(ipnet) {
+		return catchAllError(ipnet)
+	}
+
+	if isWhitelist {
+		if containsNet(b.lookup.whitelistNets, ipnet) {
+			return nil
+		}
+		b.lookup.whitelistNets = append(b.lookup.whitelistNets, ipnet)
+		if b.debug {
+			b.logger.Debug("[%s] Added whitelist CIDR: %s", b.name, ipnet)
+		}
+		return nil
+	}
+
+	// Duplicates keep the list group of their first occurrence
+	if _, exists := b.lookup.ruleGroups[ipnet.String()]; exists {
+		return nil
+	}
+	b.lookup.blockedNets = append(b.lookup.blockedNets, ipnet)
+	b.lookup.ruleGroups[ipnet.String()] = group
+	if b.debug {
+		b.logger.Debug("[%s] Added blocked CIDR: %s", b.name, ipnet)
+	}
+	return nil
+}
+
+// ServeHTTP implements the http.Handler interface
+func (b *BlockIP) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if b.isSkippedPath(req.URL.Path) {
+		b.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if b.isAdminRequest(req) {
+		b.serveAdmin(rw, req)
+		return
+	}
+
+	if b.isMetricsRequest(req) {
+		b.serveMetrics(rw, req)
+		return
+	}
+
+	if !b.reevaluateReentrant && b.isDecided(req) {
+		b.next.ServeHTTP(rw, req)
+		return
+	}
+
+	clientIP := b.getClientIP(req)
+
+	if b.debug {
+		b.logger.Debug("[%s] Request from IP: %s, Path: %s", b.name, clientIP, req.URL.Path)
+	}
+
+	var d decision
+	if clientIP == "" {
+		d = b.noIPDecision()
+	} else {
+		d = b.decideClient(req, clientIP)
+	}
+
+	b.metrics.countDecision(d.status)
+	if b.events != nil {
+		b.emitEvent(req, clientIP, d)
+	}
+	if b.debug {
+		b.logger.LogFields("debug", map[string]interface{}{
+			"message":   "decision",
+			"client_ip": clientIP,
+			"path":      req.URL.Path,
+			"decision":  d.status,
+			"rule":      d.rule,
+			"source":    b.ruleSource(d.rule),
+		})
+	}
+	if b.statsd != nil {
+		b.statsd.count("decisions." + d.status)
+	}
+
+	if d.status == statusBlocked {
+		if d.rule != "" {
+			b.stats.countRuleHit(d.rule)
+			if source := b.ruleSource(d.rule); source != "" && b.debug {
+				b.logger.Debug("[%s] Rule %s blocking IP %s was loaded from %s", b.name, d.rule, clientIP, source)
+			}
+		}
+		if b.webhook != nil {
+			b.notifyWebhook(req, clientIP, d)
+		}
+		if b.autoBan != nil {
+			b.countBlockedAttempt(clientIP, d)
+		}
+
+		if !b.dryRun && !b.passthrough {
+			b.sendBlockResponse(rw, req, clientIP, d)
+			return
+		}
+
+		b.metrics.wouldBlock.Add(1)
+		if b.dryRun {
+			b.logger.Info("[%s] WOULD BLOCK ip=%s path=%s rule=%s", b.name, clientIP, req.URL.Path, flagValue(d))
+		} else if b.debug {
+			b.logger.Debug("[%s] Passing blocked IP %s through, rule=%s", b.name, clientIP, flagValue(d))
+		}
+		if b.flagHeader != "" {
+			req.Header.Set(b.flagHeader, flagValue(d))
+		}
+		if b.passthrough {
+			req.Header.Set(passthroughHeader, "true")
+		}
+	} else {
+		// Never trust the headers when sent by the client itself
+		if b.flagHeader != "" {
+			req.Header.Del(b.flagHeader)
+		}
+		if b.passthrough {
+			req.Header.Del(passthroughHeader)
+		}
+	}
+
+	if d.geo != nil {
+		req = withGeoRecord(req, d.geo)
+	}
+	if !b.reevaluateReentrant {
+		req = b.markDecided(req)
+	}
+
+	if b.scanDetector != nil && clientIP != "" && d.status != statusWhitelisted {
+		b.serveDetectingScanners(rw, req, clientIP)
+		return
+	}
+	b.next.ServeHTTP(rw, req)
+}
+
+// decideClient returns the decision for a request with a known client IP,
+// including the per-client rate and distinct path limits
+func (b *BlockIP) decideClient(req *http.Request, clientIP string) decision {
+	d := b.decideRequest(req, clientIP)
+	if b.candidate != nil {
+		b.evaluateCandidate(clientIP)
+	}
+	// Overrides are counted when the rules are evaluated, not for every
+	// request served from the cached decision
+	if d.evaluated && d.status == statusWhitelisted && d.rule != "" {
+		b.stats.whitelistOverrides.Add(1)
+		b.logger.Info("[%s] Whitelist override: IP %s matched block rule %s, Path: %s", b.name, clientIP, d.rule, req.URL.Path)
+	}
+
+	if d.status == statusAllowed && b.rateLimiter != nil {
+		if ok, retryAfter := b.rateLimiter.allow(clientIP, req.URL.Path); !ok {
+			if b.debug {
+				b.logger.Debug("[%s] Rate limit exceeded for IP %s, Path: %s", b.name, clientIP, req.URL.Path)
+			}
+			return decision{status: statusBlocked, rule: ruleRateLimit, retryAfter: retryAfter}
+		}
+	}
+
+	if d.status == statusAllowed && len(b.cidrLimits) > 0 {
+		if rule, retryAfter, ok := allowCIDRs(b.cidrLimits, clientIP); !ok {
+			if b.debug {
+				b.logger.Debug("[%s] Rate limit of %s exceeded by IP %s, Path: %s", b.name, strings.TrimPrefix(rule, ruleCIDRRateLimitPrefix), clientIP, req.URL.Path)
+			}
+			return decision{status: statusBlocked, rule: rule, retryAfter: retryAfter}
+		}
+	}
+
+	if d.status == statusAllowed && b.pathTracker != nil && !b.pathTracker.allow(clientIP, req.URL.Path) {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s exceeded the distinct path limit, Path: %s", b.name, clientIP, req.URL.Path)
+		}
+		return decision{status: statusBlocked, rule: ruleDistinctPaths}
+	}
+
+	return d
+}
+
+// noIPDecision returns the decision for requests without a usable client IP
+func (b *BlockIP) noIPDecision() decision {
+	if b.debug {
+		b.logger.Debug("[%s] Could not extract client IP, applying action: %s", b.name, b.noIPAction)
+	}
+
+	switch b.noIPAction {
+	case actionBlock:
+		return decision{status: statusBlocked, rule: ruleUnparsableClientIP}
+	case actionChallenge:
+		return decision{status: statusBlocked, rule: ruleNoClientIPChallenge}
+	default:
+		return decision{status: statusAllowed}
+	}
+}
+
+// Evaluate runs the decision logic for req without writing a response or
+// calling the next handler. It returns "allowed", "blocked" or "whitelisted"
+// along with the matched rule, if any.
+func (b *BlockIP) Evaluate(req *http.Request) (string, string) {
+	if b.isSkippedPath(req.URL.Path) {
+		return statusAllowed, ""
+	}
+
+	clientIP := b.getClientIP(req)
+	if clientIP == "" {
+		d := b.noIPDecision()
+		return d.status, d.rule
+	}
+
+	d := b.decideRequest(req, clientIP)
+	return d.status, d.rule
+}
+
+// decideRequest combines the IP decision with the request-level rules
+func (b *BlockIP) decideRequest(req *http.Request, clientIP string) decision {
+	if b.slowDecisionThreshold > 0 {
+		defer b.warnSlowDecision(clientIP, time.Now())
+	}
+
+	d := b.applyHostRules(req, clientIP, b.decide(req.Context(), clientIP))
+	d = b.applyPathRules(req, clientIP, d)
+
+	if b.detectHeaderConflict && b.hasHeaderConflict(req) && b.blockHeaderConflict && d.status == statusAllowed {
+		return decision{status: statusBlocked, rule: ruleHeaderConflict}
+	}
+
+	if d.status == statusAllowed && len(b.bodySignatures) > 0 {
+		if signature, ok := b.matchBodySignature(req); ok {
+			if b.debug {
+				b.logger.Debug("[%s] Request body from IP %s matched signature %q", b.name, clientIP, signature)
+			}
+			return decision{status: statusBlocked, rule: ruleBodySignature}
+		}
+	}
+
+	if d.status == statusAllowed && b.blockPlaintextHTTP && req.TLS == nil {
+		if b.debug {
+			b.logger.Debug("[%s] Plaintext HTTP request from IP %s is blocked", b.name, clientIP)
+		}
+		return decision{status: statusBlocked, rule: rulePlaintextHTTP}
+	}
+
+	if d.status == statusAllowed && len(b.blockedSchemes) > 0 {
+		if rule, ok := b.matchScheme(req, clientIP); ok {
+			return decision{status: statusBlocked, rule: rule}
+		}
+	}
+
+	if d.status == statusAllowed && len(b.blockedCipherSuites) > 0 {
+		if rule, ok := b.matchCipherSuite(req, clientIP); ok {
+			return decision{status: statusBlocked, rule: rule}
+		}
+	}
+
+	if d.status == statusAllowed && (len(b.blockedSourcePorts) > 0 || len(b.allowedSourcePorts) > 0) {
+		if rule, ok := b.matchSourcePort(req); ok {
+			if b.debug {
+				b.logger.Debug("[%s] Request from IP %s blocked by %s", b.name, clientIP, rule)
+			}
+			return decision{status: statusBlocked, rule: rule}
+		}
+	}
+
+	return d
+}
+
+// warnSlowDecision logs a warning when the decision for clientIP started at
+// start took longer than the configured threshold
+func (b *BlockIP) warnSlowDecision(clientIP string, start time.Time) {
+	if elapsed := time.Since(start); elapsed > b.slowDecisionThreshold {
+		b.logger.Warn("[%s] Slow decision for IP %s took %s, over the %s threshold", b.name, clientIP, elapsed, b.slowDecisionThreshold)
+	}
+}
+
+// decide returns the decision for clientIP, consulting the cache first
+func (b *BlockIP) decide(ctx context.Context, clientIP string) decision {
+	if b.lookup.isUnblocked(clientIP) {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is temporarily unblocked", b.name, clientIP)
+		}
+		return decision{status: statusAllowed, rule: ruleTemporaryUnblock, transient: true}
+	}
+
+	// Cached temporary blocks are found before the temporary block list
+	if b.cacheTemporaryBlocks {
+		if d, ok := b.cachedDecision(clientIP); ok {
+			return d
+		}
+	}
+
+	if remaining, ok := b.lookup.temporaryBlockRemaining(clientIP); ok && !b.lookup.isWhitelisted(clientIP) {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is temporarily blocked for %s", b.name, clientIP, remaining)
+		}
+		d := decision{status: statusBlocked, rule: ruleTemporaryBlock, transient: !b.cacheTemporaryBlocks, retryAfter: remaining}
+		b.cacheDecision(clientIP, d)
+		return d
+	}
+
+	if !b.cacheTemporaryBlocks {
+		if d, ok := b.cachedDecision(clientIP); ok {
+			return d
+		}
+	}
+
+	b.metrics.cacheMisses.Add(1)
+	d := b.evaluate(ctx, clientIP)
+	b.cacheDecision(clientIP, d)
+	d.evaluated = true
+	return d
+}
+
+// cachedDecision returns the cached decision for clientIP. Blocks cached
+// with an expiry carry the time remaining until it as their Retry-After.
+func (b *BlockIP) cachedDecision(clientIP string) (decision, bool) {
+	entry, ok := b.lookup.checkCache(clientIP)
+	if !ok {
+		return decision{}, false
+	}
+
+	b.metrics.cacheHits.Add(1)
+	if b.debug {
+		b.logger.Debug("[%s] Cache hit for IP %s: %s", b.name, clientIP, entry.Status)
+	}
+	d := decision{status: entry.Status, rule: entry.Rule, geo: entry.Geo}
+	if entry.Expires != 0 {
+		d.retryAfter = time.Duration(entry.Expires - time.Now().UnixNano())
+	}
+	return d, true
+}
+
+// cacheDecision stores d for clientIP unless it is transient
+func (b *BlockIP) cacheDecision(clientIP string, d decision) {
+	if d.transient {
+		return
+	}
+	if cache := b.lookup.cacheFor(d.status); cache.put(clientIP, d) {
+		if cache.isDisabled() {
+			b.logger.Warn("[%s] Cache reached %d entries, caching disabled until usage drops", b.name, cache.maxEntries)
+		} else {
+			b.logger.Info("[%s] Cache usage dropped, caching re-enabled", b.name)
+		}
+	}
+}
+
+// evaluate decides clientIP from the rules, letting verified crawlers through
+func (b *BlockIP) evaluate(ctx context.Context, clientIP string) decision {
+	d := b.evaluateRules(ctx, clientIP)
+	if d.status == statusBlocked && b.allowVerifiedCrawlers {
+		return b.allowVerifiedCrawler(ctx, clientIP, d)
+	}
+	return d
+}
+
+// evaluateRules checks clientIP against the whitelist and then the block rules
+func (b *BlockIP) evaluateRules(ctx context.Context, clientIP string) decision {
+	if b.lookup.isWhitelisted(clientIP) {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is whitelisted", b.name, clientIP)
+		}
+		d := decision{status: statusWhitelisted}
+		if b.logWhitelistOverrides {
+			d.rule, _ = b.lookup.matchBlocked(clientIP)
+		}
+		return d
+	}
+
+	if rule, ok := b.lookup.matchBlocked(clientIP); ok {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is blocked", b.name, clientIP)
+		}
+		return decision{status: statusBlocked, rule: rule}
+	}
+
+	if b.netsets != nil {
+		if rule, ok := b.netsets.match(clientIP); ok {
+			if b.debug {
+				b.logger.Debug("[%s] IP %s is blocked by netset entry %s", b.name, clientIP, rule)
+			}
+			return decision{status: statusBlocked, rule: rule}
+		}
+	}
+
+	if b.torExits != nil && b.torExits.contains(clientIP) {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is a Tor exit node", b.name, clientIP)
+		}
+		return decision{status: statusBlocked, rule: ruleTorExit}
+	}
+
+	record := b.resolveGeo(clientIP)
+	if record != nil && b.whitelistCountries[strings.ToUpper(record.Country)] {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is whitelisted by country %s", b.name, clientIP, record.Country)
+		}
+		return decision{status: statusWhitelisted, geo: record}
+	}
+	if rule, ok := b.matchGeo(record); ok {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is blocked by %s", b.name, clientIP, rule)
+		}
+		return decision{status: statusBlocked, rule: rule, geo: record}
+	}
+
+	if rule, ok := b.matchCompositeRules(clientIP, record); ok {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is blocked by %s", b.name, clientIP, rule)
+		}
+		return decision{status: statusBlocked, rule: rule, geo: record}
+	}
+
+	if b.decider != nil {
+		d := b.consultDecider(ctx, clientIP)
+		d.geo = record
+		return d
+	}
+
+	if b.defaultDeny {
+		if b.debug {
+			b.logger.Debug("[%s] IP %s is not whitelisted, denied by default", b.name, clientIP)
+		}
+		return decision{status: statusBlocked, rule: ruleDefaultDeny, geo: record}
+	}
+
+	if b.debug {
+		b.logger.Debug("[%s] IP %s is allowed (not blocked)", b.name, clientIP)
+	}
+	return decision{status: statusAllowed, geo: record}
+}
+
+// sendBlockResponse writes the block response for the matched rule's group
+func (b *BlockIP) sendBlockResponse(rw http.ResponseWriter, req *http.Request, clientIP string, d decision) {
+	response := b.response
+	group := ""
+	if isRateLimitRule(d.rule) {
+		response = b.rateLimitResponse
+	} else if d.rule == ruleNoClientIPChallenge {
+		response = b.challengeResponse
+	} else if group = b.lookup.groupOf(d.rule); group != "" {
+		if groupResponse, ok := b.groupResponses[group]; ok {
+			response = groupResponse
+		}
+	}
+
+	// Headers set by earlier middlewares, such as CDN cache or debug headers
+	for _, header := range b.stripResponseHeaders {
+		rw.Header().Del(header)
+	}
+	for name, values := range b.responseHeaders {
+		rw.Header()[name] = append([]string(nil), values...)
+	}
+
+	if d.retryAfter > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.retryAfter.Seconds()))))
+	}
+
+	if b.redirectURL != "" && isRedirectStatusCode(response.statusCode) {
+		b.stats.countResponse(response.statusCode)
+		rw.Header().Set("Location", b.redirectURL)
+		rw.WriteHeader(response.statusCode)
+		return
+	}
+
+	contentType := b.contentType
+	if b.template != nil {
+		rendered, err := b.template.render(ResponseData{
+			ClientIP:   clientIP,
+			Rule:       d.rule,
+			Group:      group,
+			StatusCode: response.statusCode,
+			Message:    response.message,
+			Method:     req.Method,
+			Host:       req.Host,
+			Path:       req.URL.Path,
+			Time:       time.Now(),
+		})
+		if err != nil {
+			b.logger.Error("[%s] Error rendering response template: %v", b.name, err)
+		} else {
+			response.body = rendered
+			contentType = b.template.contentType
+		}
+	}
+
+	if response.statusCode == http.StatusUnauthorized {
+		challenge := b.wwwAuthenticate
+		if challenge == "" {
+			challenge = defaultWWWAuthenticate
+		}
+		rw.Header().Set("WWW-Authenticate", challenge)
+	}
+
+	if b.blockPage != nil {
+		b.serveBlockPage(rw, req, response.statusCode)
+		return
+	}
+
+	body := response.body
+	if b.gzipBodies != nil {
+		rw.Header().Add("Vary", "Accept-Encoding")
+		if compressed, ok := b.gzipBodies[string(body)]; ok && acceptsGzip(req) {
+			rw.Header().Set("Content-Encoding", "gzip")
+			body = compressed
+		}
+	}
+
+	b.stats.countResponse(response.statusCode)
+
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(response.statusCode)
+	if _, err := rw.Write(body); err != nil {
+		b.logger.Error("[%s] Error writing response: %v", b.name, err)
+	}
+}
+
+// flagValue describes a would-be block for the flag header
+func flagValue(d decision) string {
+	if d.rule == "" {
+		return statusBlocked
+	}
+	return d.rule
+}
+
+// isSkippedPath checks if path is excluded from blocking. Entries ending
+// in "/" match as prefixes, others must match exactly.
+func (b *BlockIP) isSkippedPath(path string) bool {
+	for _, skip := range b.skipPaths {
+		if path == skip || (strings.HasSuffix(skip, "/") && strings.HasPrefix(path, skip)) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultTraefikInternalPaths returns the paths served by Traefik itself
+func defaultTraefikInternalPaths() []string {
+	return []string{"/ping", "/dashboard/", "/api/", "/metrics"}
+}
+
+// defaultOrchestrationNets returns the default Docker bridge and common
+// Kubernetes pod and service ranges
+func defaultOrchestrationNets() []string {
+	return []string{
+		"172.17.0.0/16", // Docker default bridge
+		"10.244.0.0/16", // Kubernetes pods (flannel, kubeadm)
+		"10.96.0.0/12",  // Kubernetes services (kubeadm)
+		"10.42.0.0/16",  // k3s pods
+		"10.43.0.0/16",  // k3s services
+	}
+}
+
+// getClientIP extracts the client IP from the request
+func (b *BlockIP) getClientIP(req *http.Request) string {
+	ip, _ := b.clientIPSource(req)
+	return ip
+}
+
+// clientIPSource extracts the client IP along with the name of the source
+// it was taken from
+func (b *BlockIP) clientIPSource(req *http.Request) (string, string) {
+	peer := remoteIP(req)
+
+	// The first source yielding a valid IP from a trusted peer wins
+	for _, source := range b.clientIPSources {
+		if source.header == sourceRemoteAddr {
+			if ip, name := b.remoteAddrSource(req); ip != "" {
+				return ip, name
+			}
+			continue
+		}
+
+		value := strings.Join(req.Header.Values(source.header), ",")
+		if value == "" {
+			continue
+		}
+		if !source.trusts(peer) {
+			if b.debug {
+				b.logger.Debug("[%s] Ignoring %s from untrusted peer %s", b.name, source.header, peer)
+			}
+			continue
+		}
+		if ip := b.headerClientIP(source.header, value, source.trustedProxies); ip != "" {
+			ip = canonicalIP(ip)
+			if b.debug {
+				b.logger.Debug("[%s] Extracted IP from %s: %s", b.name, source.header, ip)
+			}
+			return ip, source.header
+		}
+		if b.debug {
+			b.logger.Debug("[%s] Invalid IP extracted: %s", b.name, value)
+		}
+	}
+
+	return "", ""
+}
+
+// remoteAddrSource returns the client IP taken from RemoteAddr
+func (b *BlockIP) remoteAddrSource(req *http.Request) (string, string) {
+	if ra := req.RemoteAddr; ra != "" {
+		host := remoteIP(req)
+		if host == "" {
+			if b.debug {
+				b.logger.Debug("[%s] Error parsing RemoteAddr %s", b.name, ra)
+			}
+			return "", ""
+		}
+		if b.debug {
+			b.logger.Debug("[%s] Extracted IP from RemoteAddr: %s", b.name, host)
+		}
+		return host, "RemoteAddr"
+	}
+
+	return "", ""
+}
+
+// parseNoIPAction validates the action for requests without a usable client
+// IP, falling back to the deprecated unparsableClientIPAction
+func parseNoIPAction(action, legacy string) (string, error) {
+	if action == "" {
+		action = legacy
+	}
+
+	switch action {
+	case "", actionAllow:
+		return actionAllow, nil
+	case actionBlock, actionChallenge:
+		return action, nil
+	default:
+		return "", NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("invalid no IP action: %q, must be %q, %q or %q", action, actionAllow, actionBlock, actionChallenge), nil)
+	}
+}
+
+// isWhitelisted checks if IP is in whitelist
+func (s *ipLookupService) isWhitelisted(ip string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.whitelistIPsSet[ip] {
+		return true
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+	// Callers outside the request path may pass other spellings of an IP
+	if canonical := parsedIP.String(); canonical != ip && s.whitelistIPsSet[canonical] {
+		return true
+	}
+
+	if s.whitelistTrie != nil {
+		_, ok := s.whitelistTrie.match(parsedIP)
+		return ok
+	}
+
+	for _, ipnet := range s.whitelistNets {
+		if ipnet.Contains(parsedIP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isBlocked checks if IP is blocked
+func (s *ipLookupService) isBlocked(ip string) bool {
+	_, ok := s.matchBlocked(ip)
+	return ok
+}
+
+// matchBlocked returns the block rule matching IP, if any
+func (s *ipLookupService) matchBlocked(ip string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.blockedIPsSet[ip] {
+		return ip, true
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return "", false
+	}
+	// Callers outside the request path may pass other spellings of an IP
+	if canonical := parsedIP.String(); canonical != ip && s.blockedIPsSet[canonical] {
+		return canonical, true
+	}
+
+	if rule, ok := s.matchNegated(parsedIP); ok {
+		return rule, true
+	}
+
+	if s.blockedBloom != nil && !s.blockedBloom.mayContain(parsedIP) {
+		return "", false
+	}
+
+	if s.blockedTrie != nil {
+		if ipnet, ok := s.blockedTrie.match(parsedIP); ok {
+			return ipnet.String(), true
+		}
+		return "", false
+	}
+
+	for _, ipnet := range s.blockedNets {
+		if ipnet.Contains(parsedIP) {
+			return ipnet.String(), true
+		}
+	}
+
+	return "", false
+}
+
+// groupOf returns the list group a block rule belongs to
+func (s *ipLookupService) groupOf(rule string) string {
+	if rule == "" {
+		return ""
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ruleGroups[rule]
+}
+
+// checkCache returns the cached entry for IP if present and not expired
+func (s *ipLookupService) checkCache(ip string) (CacheEntry, bool) {
+	if s.hot != nil {
+		if entry, ok := s.hot.get(ip); ok {
+			return entry, true
+		}
+	}
+
+	for _, c := range []*IPCache{s.cache, s.allowedCache} {
+		if entry, ok := c.get(ip); ok {
+			if s.hot != nil {
+				s.hot.recordHit(ip, entry, c.ttl)
+			}
+			return entry, true
+		}
+	}
+	return CacheEntry{}, false
+}
+
+// forgetCached drops the cached decisions for ip
+func (s *ipLookupService) forgetCached(ip string) {
+	s.cache.delete(ip)
+	s.allowedCache.delete(ip)
+	if s.hot != nil {
+		s.hot.delete(ip)
+	}
+}
+
+// cacheFor returns the cache holding decisions with the given status.
+// Allowed decisions churn more and are kept apart with a shorter TTL.
+func (s *ipLookupService) cacheFor(status string) *IPCache {
+	if status == statusAllowed {
+		return s.allowedCache
+	}
+	return s.cache
+}
+
+// cleanupCache removes expired entries from both decision caches and
+// returns how many were removed
+func (s *ipLookupService) cleanupCache() int {
+	return s.cache.cleanup() + s.allowedCache.cleanup()
+}
+
+// sweepCache periodically removes expired cache entries until ctx is done
+func (b *BlockIP) sweepCache(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if purged := b.lookup.cleanupCache(); purged > 0 && b.debug {
+				b.logger.Debug("[%s] Removed %d expired cache entries", b.name, purged)
+			}
+		}
+	}
+}
+
+// disableEviction makes cacheMaxEntries a hard limit on both decision
+// caches instead of evicting least recently used entries
+func (s *ipLookupService) disableEviction() {
+	s.cache.noEviction = true
+	s.allowedCache.noEviction = true
+}
+
+// clearCache drops every cached decision
+func (s *ipLookupService) clearCache() {
+	s.cache.clear()
+	s.allowedCache.clear()
+	if s.hot != nil {
+		s.hot.clear()
+	}
+}
+
+// newIPCache creates an empty cache split into shards, or into
+// defaultCacheShards() when shards is 0
+func newIPCache(ttl time.Duration, maxEntries int, shards int) *IPCache {
+	if shards <= 0 {
+		shards = defaultCacheShards()
+	}
+	c := &IPCache{
+		shards:     make([]*cacheShard, shards),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{cache: make(map[string]*list.Element), lru: list.New()}
+	}
+	return c
+}
+
+// defaultCacheShards picks a shard count from GOMAXPROCS: four shards per
+// processor rounded up to a power of two, capped at maxCacheShards
+func defaultCacheShards() int {
+	shards := 1
+	for shards < 4*runtime.GOMAXPROCS(0) && shards < maxCacheShards {
+		shards *= 2
+	}
+	return shards
+}
+
+// shardFor returns the shard holding ip, hashing it with FNV-1a
+func (c *IPCache) shardFor(ip string) *cacheShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(ip); i++ {
+		h ^= uint32(ip[i])
+		h *= 16777619
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
+
+// len returns the number of entries across all shards
+func (c *IPCache) len() int {
+	return int(c.size.Load())
+}
+
+// get returns the entry for IP if present and not expired, marking it as
+// the most recently used
+func (c *IPCache) get(ip string) (CacheEntry, bool) {
+	if c.ttl <= 0 {
+		return CacheEntry{}, false
+	}
+
+	shard := c.shardFor(ip)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	elem, ok := shard.cache[ip]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	item := elem.Value.(*cacheItem)
+	if item.entry.expired(time.Now().UnixNano(), c.ttl) {
+		return CacheEntry{}, false
+	}
+
+	item.used = c.clock.Add(1)
+	shard.lru.MoveToFront(elem)
+	return item.entry, true
+}
+
+// put stores the decision for IP. When the cache is full the least recently
+// used entry across all shards is evicted, never the one just stored.
+// With eviction disabled it reports whether caching was disabled or
+// re-enabled by the hard limit instead.
+func (c *IPCache) put(ip string, d decision) bool {
+	if c.ttl <= 0 {
+		return false
+	}
+
+	entry := CacheEntry{
+		Status:    d.status,
+		Rule:      d.rule,
+		Timestamp: time.Now().UnixNano(),
+		Geo:       d.geo,
+	}
+	if d.retryAfter > 0 {
+		entry.Expires = entry.Timestamp + int64(d.retryAfter)
+	}
+
+	if c.noEviction {
+		return c.putCapped(ip, entry)
+	}
+
+	shard := c.shardFor(ip)
+	shard.mu.Lock()
+	added := c.store(shard, ip, entry)
+	shard.mu.Unlock()
+	if !added || c.maxEntries <= 0 {
+		return false
+	}
+
+	for c.len() > c.maxEntries {
+		if !c.evictOldest(ip) {
+			break
+		}
+	}
+	return false
+}
+
+// putCapped stores entry for IP without evicting, disabling caching once
+// the hard limit is reached. It reports whether caching was disabled or
+// re-enabled.
+func (c *IPCache) putCapped(ip string, entry CacheEntry) bool {
+	if c.disabled.Load() {
+		return c.reenable(ip, entry)
+	}
+
+	limit := maxCacheEntries
+	if c.maxEntries > 0 && c.maxEntries < limit {
+		limit = c.maxEntries
+	}
+	if c.len() >= limit {
+		c.cleanup()
+	}
+
+	// Concurrent puts to different shards may overshoot the hard limit
+	// by a few entries before caching is disabled
+	shard := c.shardFor(ip)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	_, exists := shard.cache[ip]
+	if !exists && c.maxEntries > 0 && c.len() >= c.maxEntries {
+		return c.disabled.CompareAndSwap(false, true)
+	}
+
+	c.store(shard, ip, entry)
+	return false
+}
+
+// reenable stores entry for IP once expired entries bring usage down to
+// half the hard limit. It reports whether caching was re-enabled.
+func (c *IPCache) reenable(ip string, entry CacheEntry) bool {
+	c.limitMu.Lock()
+	defer c.limitMu.Unlock()
+
+	if !c.disabled.Load() || entry.Timestamp-c.lastCleanup.Load() < int64(cacheDisabledCleanupInterval) {
+		return false
+	}
+	c.cleanup()
+	if c.len() > c.maxEntries/2 {
+		return false
+	}
+	c.disabled.Store(false)
+
+	shard := c.shardFor(ip)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	c.store(shard, ip, entry)
+	return true
+}
+
+// isDisabled reports whether the hard limit has disabled caching
+func (c *IPCache) isDisabled() bool {
+	return c.disabled.Load()
+}
+
+// evictOldest removes the least recently used entry across all shards
+// other than keep and reports whether there was one. It compares the tail
+// of every shard, locking one shard at a time.
+func (c *IPCache) evictOldest(keep string) bool {
+	var oldest *cacheShard
+	oldestUsed := int64(0)
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		if elem := lruTail(shard, keep); elem != nil {
+			if used := elem.Value.(*cacheItem).used; oldest == nil || used < oldestUsed {
+				oldest, oldestUsed = shard, used
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	if oldest == nil {
+		return false
+	}
+
+	// The tail may have been used or removed since it was compared, in
+	// which case the shard's new tail is evicted instead
+	oldest.mu.Lock()
+	defer oldest.mu.Unlock()
+	elem := lruTail(oldest, keep)
+	if elem == nil {
+		return true
+	}
+	c.remove(oldest, elem)
+	c.evictions.Add(1)
+	return true
+}
+
+// lruTail returns the least recently used entry of shard other than keep.
+// Callers must hold shard.mu.
+func lruTail(shard *cacheShard, keep string) *list.Element {
+	elem := shard.lru.Back()
+	if elem != nil && elem.Value.(*cacheItem).ip == keep {
+		elem = elem.Prev()
+	}
+	return elem
+}
+
+// remove drops elem from shard. Callers must hold shard.mu.
+func (c *IPCache) remove(shard *cacheShard, elem *list.Element) {
+	shard.lru.Remove(elem)
+	delete(shard.cache, elem.Value.(*cacheItem).ip)
+	c.size.Add(-1)
+}
+
+// clear drops every entry
+func (c *IPCache) clear() {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		c.size.Add(-int64(len(shard.cache)))
+		shard.cache = make(map[string]*list.Element)
+		shard.lru.Init()
+		shard.mu.Unlock()
+	}
+}
+
+// store writes entry as the most recently used one and reports whether it
+// was added rather than replaced. Callers must hold shard.mu.
+func (c *IPCache) store(shard *cacheShard, ip string, entry CacheEntry) bool {
+	if elem, exists := shard.cache[ip]; exists {
+		item := elem.Value.(*cacheItem)
+		item.entry, item.used = entry, c.clock.Add(1)
+		shard.lru.MoveToFront(elem)
+		return false
+	}
+	shard.cache[ip] = shard.lru.PushFront(&cacheItem{ip: ip, entry: entry, used: c.clock.Add(1)})
+	c.size.Add(1)
+	return true
+}
+
+// delete drops the entry for ip
+func (c *IPCache) delete(ip string) {
+	shard := c.shardFor(ip)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if elem, exists := shard.cache[ip]; exists {
+		c.remove(shard, elem)
+	}
+}
+
+// cleanup removes expired entries and returns how many were removed. It
+// locks one shard at a time.
+func (c *IPCache) cleanup() int {
+	now := time.Now().UnixNano()
+	c.lastCleanup.Store(now)
+	removed := 0
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		for _, elem := range shard.cache {
+			if elem.Value.(*cacheItem).entry.expired(now, c.ttl) {
+				c.remove(shard, elem)
+				removed++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return removed
+}
+
+// isValidIP checks if a string is a valid IP address
+func isValidIP(ip string) bool {
+	return net.ParseIP(strings.TrimSpace(ip)) != nil
+}
+
+// parseCanonicalCIDR parses cidr like net.ParseCIDR, rewriting IPv4-mapped
+// IPv6 networks such as ::ffff:203.0.113.0/120 to the IPv4 network they
+// cover so they match IPv4 clients
+func parseCanonicalCIDR(cidr string) (*net.IPNet, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	ip4 := ipnet.IP.To4()
+	if bits == net.IPv6len*8 && ones >= 96 && ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(ones-96, net.IPv4len*8)}, nil
+	}
+	return ipnet, nil
+}
+
+// canonicalIP returns ip in the form net.IP.String gives it, so that
+// different spellings of an address share a map key: IPv6 is lowercased and
+// compressed and IPv4-mapped IPv6 becomes dotted-quad. Invalid input is
+// returned unchanged.
+func canonicalIP(ip string) string {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return ip
+	}
+	return parsed.String()
+}
+
+// isErrorStatusCode checks if code is a 4xx or 5xx HTTP status
+func isErrorStatusCode(code int) bool {
+	return code >= 400 && code < 600
 }
@@ -0,0 +1,134 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// metricsPrefix namespaces the exported Prometheus metrics
+const metricsPrefix = "blockip_"
+
+// responsesMetricPrefix starts the Metrics keys counting block responses by
+// status code, exported as one responses_total series per code
+const responsesMetricPrefix = "responses_"
+
+// requestMetrics counts requests by outcome. Counters are atomic so the
+// request path never takes a lock.
+type requestMetrics struct {
+	requests    atomic.Int64
+	blocked     atomic.Int64
+	wouldBlock  atomic.Int64
+	whitelisted atomic.Int64
+	allowed     atomic.Int64
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+}
+
+// metricsHelp describes each metric for the exposition format
+var metricsHelp = map[string]string{
+	"requests_total":     "Requests evaluated by the plugin",
+	"blocked_total":      "Requests decided as blocked, including dry runs",
+	"would_block_total":  "Blocked requests passed on by dry run or passthrough mode",
+	"whitelisted_total":  "Requests from whitelisted IPs",
+	"allowed_total":      "Requests allowed without a matching rule",
+	"cache_hits_total":   "Decisions served from the cache",
+	"cache_misses_total": "Decisions evaluated against the rules",
+	"responses_total":    "Block responses by the status code served",
+}
+
+// countDecision records a request and its outcome
+func (m *requestMetrics) countDecision(status string) {
+	m.requests.Add(1)
+	switch status {
+	case statusBlocked:
+		m.blocked.Add(1)
+	case statusWhitelisted:
+		m.whitelisted.Add(1)
+	default:
+		m.allowed.Add(1)
+	}
+}
+
+// reset zeroes the request counters
+func (m *requestMetrics) reset() {
+	for _, counter := range []*atomic.Int64{
+		&m.requests, &m.blocked, &m.wouldBlock, &m.whitelisted, &m.allowed, &m.cacheHits, &m.cacheMisses,
+	} {
+		counter.Swap(0)
+	}
+}
+
+// Metrics returns the request counters along with the block responses
+// served per status code as responses_<code>
+func (b *BlockIP) Metrics() map[string]int64 {
+	metrics := map[string]int64{
+		"requests_total":     b.metrics.requests.Load(),
+		"blocked_total":      b.metrics.blocked.Load(),
+		"would_block_total":  b.metrics.wouldBlock.Load(),
+		"whitelisted_total":  b.metrics.whitelisted.Load(),
+		"allowed_total":      b.metrics.allowed.Load(),
+		"cache_hits_total":   b.metrics.cacheHits.Load(),
+		"cache_misses_total": b.metrics.cacheMisses.Load(),
+	}
+
+	for status := range b.stats.responses {
+		if count := b.stats.responses[status].Load(); count > 0 {
+			metrics[fmt.Sprintf("%s%d", responsesMetricPrefix, status)] = count
+		}
+	}
+	return metrics
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a counter
+func writeMetricHeader(out *strings.Builder, name string) {
+	fmt.Fprintf(out, "# HELP %s%s %s\n", metricsPrefix, name, metricsHelp[name])
+	fmt.Fprintf(out, "# TYPE %s%s counter\n", metricsPrefix, name)
+}
+
+// isMetricsRequest checks if the request targets the metrics endpoint
+func (b *BlockIP) isMetricsRequest(req *http.Request) bool {
+	return b.metricsPath != "" && req.URL.Path == b.metricsPath
+}
+
+// serveMetrics renders the counters in the Prometheus text format for
+// requests carrying the admin token
+func (b *BlockIP) serveMetrics(rw http.ResponseWriter, req *http.Request) {
+	if !b.hasAdminToken(req) {
+		writeJSON(rw, http.StatusUnauthorized, map[string]string{"error": "invalid admin token"})
+		return
+	}
+
+	metrics := b.Metrics()
+	names := make([]string, 0, len(metrics))
+	var codes []string
+	for name := range metrics {
+		if code, ok := strings.CutPrefix(name, responsesMetricPrefix); ok {
+			codes = append(codes, code)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Strings(codes)
+
+	var out strings.Builder
+	for _, name := range names {
+		writeMetricHeader(&out, name)
+		fmt.Fprintf(&out, "%s%s %d\n", metricsPrefix, name, metrics[name])
+	}
+	if len(codes) > 0 {
+		writeMetricHeader(&out, "responses_total")
+		for _, code := range codes {
+			fmt.Fprintf(&out, "%sresponses_total{code=\"%s\"} %d\n", metricsPrefix, code, metrics[responsesMetricPrefix+code])
+		}
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	if _, err := rw.Write([]byte(out.String())); err != nil {
+		b.logger.Error("[%s] Error writing metrics: %v", b.name, err)
+	}
+}
@@ -0,0 +1,190 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WhitelistIPs = []string{"10.0.0.5"}
+	config.MetricsPath = "/metrics"
+	config.AdminToken = "secret"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	for _, addr := range []string{"192.168.1.100:1", "192.168.1.100:2", "10.0.0.5:1", "10.0.0.1:1", "10.0.0.2:1", "10.0.0.1:2"} {
+		requestFrom(handler, addr)
+	}
+
+	expected := map[string]int64{
+		"requests_total":     6,
+		"blocked_total":      2,
+		"would_block_total":  0,
+		"whitelisted_total":  1,
+		"allowed_total":      3,
+		"cache_hits_total":   2,
+		"cache_misses_total": 4,
+	}
+	metrics := b.Metrics()
+	for name, value := range expected {
+		if metrics[name] != value {
+			t.Errorf("Expected %s to be %d, got %d", name, value, metrics[name])
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.RemoteAddr = "192.168.1.100:12345"
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 200 {
+		t.Errorf("Expected 200 from the metrics endpoint, got %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Expected Prometheus content type, got %q", contentType)
+	}
+	for _, line := range []string{
+		"# TYPE blockip_requests_total counter",
+		"blockip_requests_total 6",
+		"blockip_blocked_total 2",
+		"blockip_cache_hits_total 2",
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("Expected metrics output to contain %q, got %q", line, w.Body.String())
+		}
+	}
+
+	// Scrapes are not counted as requests
+	if requests := b.Metrics()["requests_total"]; requests != 6 {
+		t.Errorf("Expected the scrape not to be counted, got %d requests", requests)
+	}
+}
+
+func TestMetricsResponsesByStatus(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.ListGroups = []ListGroup{{Name: "legal", StatusCode: 451, BlockedIPs: []string{"198.51.100.7"}}}
+	config.MetricsPath = "/metrics"
+	config.AdminToken = "secret"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	for _, addr := range []string{"192.168.1.100:1", "192.168.1.100:2", "198.51.100.7:1", "10.0.0.1:1"} {
+		requestFrom(handler, addr)
+	}
+
+	metrics := b.Metrics()
+	if metrics["responses_403"] != 2 || metrics["responses_451"] != 1 {
+		t.Errorf("Expected 2 responses with 403 and 1 with 451, got %d and %d", metrics["responses_403"], metrics["responses_451"])
+	}
+	if _, ok := metrics["responses_200"]; ok {
+		t.Error("Expected no response count for allowed requests")
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE blockip_responses_total counter",
+		`blockip_responses_total{code="403"} 2`,
+		`blockip_responses_total{code="451"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics output to contain %q, got %q", line, body)
+		}
+	}
+	if strings.Contains(body, "blockip_responses_403") {
+		t.Errorf("Expected status codes as labels rather than metric names, got %q", body)
+	}
+}
+
+func TestMetricsRequireAdminToken(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.MetricsPath = "/metrics"
+	config.AdminToken = "secret"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		header   string
+		value    string
+		expected int
+		testName string
+	}{
+		{"", "", 401, "No token"},
+		{"Authorization", "Bearer wrong", 401, "Wrong bearer token"},
+		{"X-Admin-Token", "wrong", 401, "Wrong admin token"},
+		{"Authorization", "Bearer secret", 200, "Bearer token"},
+		{"X-Admin-Token", "secret", 200, "Admin token header"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+		if test.expected == 401 && strings.Contains(w.Body.String(), "blockip_requests_total") {
+			t.Errorf("%s: expected no counters without the token, got %q", test.testName, w.Body.String())
+		}
+	}
+
+	config.AdminToken = ""
+	if _, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), config, "blockip-test"); err == nil {
+		t.Error("Expected an error when metricsPath is set without adminToken")
+	}
+}
+
+func TestMetricsPathDisabled(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Expected /metrics to reach the next handler without metricsPath, got %d", w.Code)
+	}
+}
@@ -0,0 +1,465 @@
+package traefik_plugin_blockip
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mmdbMetadataMarker starts the metadata section of a MaxMind DB file
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbDataSeparator is the size of the zero gap between the search tree
+// and the data section
+const mmdbDataSeparator = 16
+
+// MaxMind DB data types
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// mmdbReader resolves IPs from a MaxMind DB (.mmdb) file held in memory,
+// such as GeoLite2-Country, GeoLite2-City or GeoLite2-ASN
+type mmdbReader struct {
+	buf          []byte
+	data         []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint
+	databaseType string
+}
+
+// openMMDB reads and parses the MaxMind DB file at path
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("cannot read GeoIP database %s", path), err)
+	}
+	r, err := parseMMDB(buf)
+	if err != nil {
+		return nil, NewBlockIPError(ErrCodeParseError, fmt.Sprintf("invalid GeoIP database %s", path), err)
+	}
+	return r, nil
+}
+
+// parseMMDB parses a MaxMind DB file
+func parseMMDB(buf []byte) (*mmdbReader, error) {
+	i := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("metadata marker not found")
+	}
+
+	meta := &mmdbReader{data: buf[i+len(mmdbMetadataMarker):]}
+	value, _, err := meta.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("metadata is not a map")
+	}
+
+	r := &mmdbReader{buf: buf}
+	r.nodeCount = uint(mmdbUint(metadata["node_count"]))
+	r.recordSize = uint(mmdbUint(metadata["record_size"]))
+	r.ipVersion = uint(mmdbUint(metadata["ip_version"]))
+	r.databaseType, _ = metadata["database_type"].(string)
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+mmdbDataSeparator > uint(i) {
+		return nil, fmt.Errorf("search tree of %d nodes exceeds the file", r.nodeCount)
+	}
+	r.data = buf[treeSize+mmdbDataSeparator : i]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for depth := 0; depth < 96 && node < r.nodeCount; depth++ {
+			node = r.readRecord(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of node
+func (r *mmdbReader) readRecord(node uint, bit uint) uint {
+	offset := node * r.recordSize / 4
+	b := r.buf[offset : offset+r.recordSize/4]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Lookup resolves ip to a GeoRecord. It returns nil when the database has
+// no entry for ip.
+func (r *mmdbReader) Lookup(ip net.IP) (*GeoRecord, error) {
+	node := uint(0)
+	addr := ip.To16()
+	if ip4 := ip.To4(); ip4 != nil {
+		addr = ip4
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if addr == nil {
+		return nil, fmt.Errorf("invalid IP")
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < len(addr)*8 && node < r.nodeCount; i++ {
+		node = r.readRecord(node, uint(addr[i/8]>>(7-uint(i%8))&1))
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, fmt.Errorf("search tree is too deep")
+	}
+
+	value, _, err := r.decode(int(node - r.nodeCount - mmdbDataSeparator))
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("record is not a map")
+	}
+	return geoRecordFromMMDB(fields), nil
+}
+
+// geoRecordFromMMDB picks the GeoRecord attributes out of a decoded record
+func geoRecordFromMMDB(fields map[string]interface{}) *GeoRecord {
+	record := &GeoRecord{
+		Country:   mmdbPath(fields, "country", "iso_code"),
+		Continent: mmdbPath(fields, "continent", "code"),
+		ASN:       uint32(mmdbUint(fields["autonomous_system_number"])),
+	}
+	if record.Country == "" {
+		record.Country = mmdbPath(fields, "registered_country", "iso_code")
+	}
+	if subdivisions, _ := fields["subdivisions"].([]interface{}); len(subdivisions) > 0 {
+		subdivision, _ := subdivisions[0].(map[string]interface{})
+		record.Region, _ = subdivision["iso_code"].(string)
+	}
+	return record
+}
+
+// mmdbPath returns the string at the nested map path, or ""
+func mmdbPath(fields map[string]interface{}, outer, inner string) string {
+	nested, _ := fields[outer].(map[string]interface{})
+	value, _ := nested[inner].(string)
+	return value
+}
+
+// mmdbUint converts a decoded unsigned value to uint64, or 0
+func mmdbUint(value interface{}) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int32:
+		return uint64(v)
+	default:
+		return 0
+	}
+}
+
+// decode decodes the value at offset in the data section, returning it and
+// the offset following it
+func (r *mmdbReader) decode(offset int) (interface{}, int, error) {
+	if offset < 0 || offset >= len(r.data) {
+		return nil, 0, fmt.Errorf("offset %d out of range", offset)
+	}
+
+	ctrl := r.data[offset]
+	offset++
+	kind := int(ctrl >> 5)
+
+	if kind == mmdbPointer {
+		pointer, next, err := r.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := r.decode(pointer)
+		return value, next, err
+	}
+
+	if kind == mmdbExtended {
+		if offset >= len(r.data) {
+			return nil, 0, fmt.Errorf("truncated extended type")
+		}
+		kind = 7 + int(r.data[offset])
+		offset++
+	}
+
+	size, offset, err := r.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			var key, value interface{}
+			if key, offset, err = r.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			if value, offset, err = r.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			m[name] = value
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			var value interface{}
+			if value, offset, err = r.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(r.data) {
+		return nil, 0, fmt.Errorf("value at %d overruns the data section", offset)
+	}
+	b := r.data[offset : offset+size]
+	offset += size
+
+	switch kind {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes:
+		return b, offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case mmdbInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int32(v), offset, nil
+	case mmdbUint128:
+		return b, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+	}
+}
+
+// pointer decodes a pointer whose control byte is ctrl
+func (r *mmdbReader) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int(ctrl>>3&0x3) + 1
+	if offset+n > len(r.data) {
+		return 0, 0, fmt.Errorf("truncated pointer")
+	}
+	b := r.data[offset : offset+n]
+
+	var pointer int
+	switch n {
+	case 1:
+		pointer = int(ctrl&0x7)<<8 | int(b[0])
+	case 2:
+		pointer = (int(ctrl&0x7)<<16 | int(b[0])<<8 | int(b[1])) + 2048
+	case 3:
+		pointer = (int(ctrl&0x7)<<24 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])) + 526336
+	default:
+		pointer = int(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + n, nil
+}
+
+// size decodes the payload size encoded in ctrl and the bytes that follow
+func (r *mmdbReader) size(ctrl byte, offset int) (int, int, error) {
+	size := int(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > len(r.data) {
+		return 0, 0, fmt.Errorf("truncated size")
+	}
+	var extra int
+	for _, c := range r.data[offset : offset+n] {
+		extra = extra<<8 | int(c)
+	}
+	switch n {
+	case 1:
+		size = 29 + extra
+	case 2:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return size, offset + n, nil
+}
+
+// geoDatabase is a GeoIP database file that can be reloaded while serving.
+// Each lookup uses the reader current when it starts, so in-flight lookups
+// finish on the previous database.
+type geoDatabase struct {
+	path    string
+	reader  atomic.Value // *mmdbReader
+	mu      sync.Mutex   // serializes reloads
+	modTime time.Time
+}
+
+// current returns the loaded database reader, nil before the first load
+func (d *geoDatabase) current() *mmdbReader {
+	reader, _ := d.reader.Load().(*mmdbReader)
+	return reader
+}
+
+// Lookup resolves ip with the current database
+func (d *geoDatabase) Lookup(ip net.IP) (*GeoRecord, error) {
+	return d.current().Lookup(ip)
+}
+
+// load reads the database file and swaps it in. The current database is
+// kept when the file cannot be read or parsed.
+func (d *geoDatabase) load() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("cannot read GeoIP database %s", d.path), err)
+	}
+	reader, err := openMMDB(d.path)
+	if err != nil {
+		return err
+	}
+
+	d.reader.Store(reader)
+	d.modTime = info.ModTime()
+	return nil
+}
+
+// changed reports whether the database file was modified since it was loaded
+func (d *geoDatabase) changed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	info, err := os.Stat(d.path)
+	return err != nil || !info.ModTime().Equal(d.modTime)
+}
+
+// geoDatabases returns the configured GeoIP database files
+func (b *BlockIP) geoDatabases() []*geoDatabase {
+	var databases []*geoDatabase
+	for _, d := range []*geoDatabase{b.geoDatabase, b.asnDatabase} {
+		if d != nil {
+			databases = append(databases, d)
+		}
+	}
+	return databases
+}
+
+// ReloadGeoDatabase reloads the configured GeoIP database files and clears
+// the decision cache. The current databases are kept on errors.
+func (b *BlockIP) ReloadGeoDatabase() error {
+	databases := b.geoDatabases()
+	if len(databases) == 0 {
+		return NewBlockIPError(ErrCodeInvalidConfig, "no geoDatabaseFile is configured", nil)
+	}
+	for _, d := range databases {
+		if err := d.load(); err != nil {
+			return err
+		}
+		if b.debug {
+			b.logger.Debug("[%s] Loaded GeoIP database %s (%s)", b.name, d.path, d.current().databaseType)
+		}
+	}
+	b.lookup.clearCache()
+	return nil
+}
+
+// watchGeoDatabase reloads the GeoIP databases when one of their files changes,
+// checking every interval until ctx is done
+func (b *BlockIP) watchGeoDatabase(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed := false
+			for _, d := range b.geoDatabases() {
+				changed = changed || d.changed()
+			}
+			if !changed {
+				continue
+			}
+			if err := b.ReloadGeoDatabase(); err != nil {
+				b.logger.Error("[%s] Error reloading GeoIP database, keeping the previous one: %v", b.name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// encodeMMDBString encodes s as a MaxMind DB string
+func encodeMMDBString(s string) []byte {
+	return append([]byte{mmdbString<<5 | byte(len(s))}, s...)
+}
+
+// mmdbRecord encodes a GeoRecord the way GeoLite2 databases lay it out
+func mmdbRecord(record GeoRecord) []byte {
+	b := []byte{mmdbMap<<5 | 3}
+	if record.Region != "" {
+		b[0]++
+		b = append(b, encodeMMDBString("subdivisions")...)
+		b = append(b, 1, mmdbArray-7)
+		b = append(b, mmdbMap<<5|1)
+		b = append(b, encodeMMDBString("iso_code")...)
+		b = append(b, encodeMMDBString(record.Region)...)
+	}
+	b = append(b, encodeMMDBString("country")...)
+	b = append(b, mmdbMap<<5|1)
+	b = append(b, encodeMMDBString("iso_code")...)
+	b = append(b, encodeMMDBString(record.Country)...)
+	b = append(b, encodeMMDBString("continent")...)
+	b = append(b, mmdbMap<<5|1)
+	b = append(b, encodeMMDBString("code")...)
+	b = append(b, encodeMMDBString(record.Continent)...)
+	b = append(b, encodeMMDBString("autonomous_system_number")...)
+	b = append(b, mmdbUint32<<5|4)
+	return binary.BigEndian.AppendUint32(b, record.ASN)
+}
+
+// buildMMDB builds a MaxMind DB with 24-bit records mapping each CIDR to
+// its record. CIDRs must not overlap.
+func buildMMDB(t *testing.T, ipVersion int, networks map[string]GeoRecord) []byte {
+	t.Helper()
+
+	// records hold a child node index, -1 for no data or -(2+i) for data i
+	nodes := [][2]int{{-1, -1}}
+	var data [][]byte
+	for cidr, record := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("invalid fixture CIDR %s: %v", cidr, err)
+		}
+		ones, _ := network.Mask.Size()
+		addr := network.IP.To16()
+		if ip4 := network.IP.To4(); ip4 != nil && ipVersion == 4 {
+			addr = ip4
+		} else if ip4 != nil {
+			// IPv4 networks live under ::/96
+			addr = append(make(net.IP, 12), ip4...)
+			ones += 96
+		}
+
+		data = append(data, mmdbRecord(record))
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(addr[i/8] >> (7 - uint(i%8)) & 1)
+			if i == ones-1 {
+				nodes[node][bit] = -(1 + len(data))
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	var section []byte
+	offsets := make([]int, len(data))
+	for i, d := range data {
+		offsets[i] = len(section)
+		section = append(section, d...)
+	}
+
+	var buf []byte
+	for _, n := range nodes {
+		for _, record := range n {
+			value := len(nodes)
+			if record >= 0 {
+				value = record
+			} else if record < -1 {
+				value = len(nodes) + mmdbDataSeparator + offsets[-record-2]
+			}
+			buf = append(buf, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	buf = append(buf, make([]byte, mmdbDataSeparator)...)
+	buf = append(buf, section...)
+
+	buf = append(buf, mmdbMetadataMarker...)
+	buf = append(buf, mmdbMap<<5|4)
+	buf = append(buf, encodeMMDBString("node_count")...)
+	buf = append(buf, mmdbUint32<<5|4)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(nodes)))
+	buf = append(buf, encodeMMDBString("record_size")...)
+	buf = append(buf, mmdbUint16<<5|1, 24)
+	buf = append(buf, encodeMMDBString("ip_version")...)
+	buf = append(buf, mmdbUint16<<5|1, byte(ipVersion))
+	buf = append(buf, encodeMMDBString("database_type")...)
+	buf = append(buf, encodeMMDBString("Test-Country")...)
+	return buf
+}
+
+// writeMMDB writes a fixture database to path, stamping it with modTime
+func writeMMDB(t *testing.T, path string, modTime time.Time, networks map[string]GeoRecord) {
+	t.Helper()
+	if err := os.WriteFile(path, buildMMDB(t, 6, networks), 0o600); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set database time: %v", err)
+	}
+}
+
+func TestMMDBLookup(t *testing.T) {
+	networks := map[string]GeoRecord{
+		"203.0.113.0/24":  {Country: "NG", Continent: "AF", ASN: 64500},
+		"198.51.100.0/25": {Country: "DE", Continent: "EU", ASN: 64501},
+		"2001:db8::/32":   {Country: "JP", Continent: "AS", ASN: 64502},
+		"192.0.2.128/25":  {Country: "US", Continent: "NA", Region: "CA", ASN: 64503},
+	}
+
+	for _, ipVersion := range []int{4, 6} {
+		r, err := parseMMDB(buildMMDB(t, ipVersion, networks))
+		if err != nil {
+			t.Fatalf("IPv%d database: unexpected error: %v", ipVersion, err)
+		}
+
+		tests := []struct {
+			ip       string
+			expected *GeoRecord
+			testName string
+		}{
+			{"203.0.113.77", &GeoRecord{Country: "NG", Continent: "AF", ASN: 64500}, "IPv4 network"},
+			{"198.51.100.1", &GeoRecord{Country: "DE", Continent: "EU", ASN: 64501}, "IPv4 /25"},
+			{"198.51.100.200", nil, "outside the /25"},
+			{"192.0.2.200", &GeoRecord{Country: "US", Continent: "NA", Region: "CA", ASN: 64503}, "IPv4 with subdivision"},
+			{"192.0.2.1", nil, "unknown IPv4"},
+			{"2001:db8::1", &GeoRecord{Country: "JP", Continent: "AS", ASN: 64502}, "IPv6 network"},
+			{"2001:db9::1", nil, "unknown IPv6"},
+		}
+
+		for _, tt := range tests {
+			if ipVersion == 4 && tt.expected != nil && net.ParseIP(tt.ip).To4() == nil {
+				tt.expected = nil
+			}
+			record, err := r.Lookup(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Errorf("IPv%d %s: unexpected error: %v", ipVersion, tt.testName, err)
+				continue
+			}
+			if (record == nil) != (tt.expected == nil) || record != nil && *record != *tt.expected {
+				t.Errorf("IPv%d %s: expected %+v, got %+v", ipVersion, tt.testName, tt.expected, record)
+			}
+		}
+	}
+}
+
+func TestInvalidMMDB(t *testing.T) {
+	valid := buildMMDB(t, 6, map[string]GeoRecord{"203.0.113.0/24": {Country: "NG"}})
+
+	tests := []struct {
+		buf      []byte
+		testName string
+	}{
+		{[]byte("not a database"), "missing metadata"},
+		{valid[len(valid)-40:], "truncated tree"},
+		{append([]byte{}, mmdbMetadataMarker...), "empty metadata"},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseMMDB(tt.buf); err == nil {
+			t.Errorf("%s: expected an error", tt.testName)
+		}
+	}
+
+	_, err := openMMDB(filepath.Join(t.TempDir(), "missing.mmdb"))
+	if err == nil {
+		t.Errorf("missing file: expected an error")
+	}
+}
+
+func TestGeoDatabaseReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	start := time.Now().Add(-time.Hour)
+	writeMMDB(t, path, start, map[string]GeoRecord{
+		"203.0.113.0/24":  {Country: "NG", Continent: "AF"},
+		"198.51.100.0/24": {Country: "DE", Continent: "EU"},
+	})
+
+	config := CreateConfig()
+	config.BlockedContinents = []string{"AF"}
+	config.GeoDatabaseFile = path
+	config.GeoDatabaseReloadIntervalDuration = "20ms"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	defer handler.(*BlockIP).Stop()
+
+	if status := requestFrom(handler, "203.0.113.5:1234"); status != http.StatusForbidden {
+		t.Errorf("before reload: expected 203.0.113.5 to be blocked, got %d", status)
+	}
+	if status := requestFrom(handler, "198.51.100.5:1234"); status != http.StatusOK {
+		t.Errorf("before reload: expected 198.51.100.5 to be allowed, got %d", status)
+	}
+
+	// The second database swaps the continents of the two networks
+	writeMMDB(t, path, start.Add(time.Minute), map[string]GeoRecord{
+		"203.0.113.0/24":  {Country: "DE", Continent: "EU"},
+		"198.51.100.0/24": {Country: "NG", Continent: "AF"},
+	})
+
+	if status := waitForStatus(handler, "198.51.100.5:1234", http.StatusForbidden); status != http.StatusForbidden {
+		t.Errorf("after reload: expected 198.51.100.5 to be blocked, got %d", status)
+	}
+	if status := requestFrom(handler, "203.0.113.5:1234"); status != http.StatusOK {
+		t.Errorf("after reload: expected 203.0.113.5 to be allowed, got %d", status)
+	}
+
+	// A broken database keeps the previous one
+	if err := os.WriteFile(path, []byte("corrupt"), 0o600); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+	if err := handler.(*BlockIP).ReloadGeoDatabase(); err == nil {
+		t.Errorf("corrupt database: expected an error")
+	}
+	if status := requestFrom(handler, "198.51.100.5:1234"); status != http.StatusForbidden {
+		t.Errorf("corrupt database: expected 198.51.100.5 to stay blocked, got %d", status)
+	}
+}
+
+func TestGeoDatabaseConcurrentReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeMMDB(t, path, time.Now(), map[string]GeoRecord{"203.0.113.0/24": {Country: "NG", Continent: "AF"}})
+
+	config := CreateConfig()
+	config.BlockedContinents = []string{"AF"}
+	config.GeoDatabaseFile = path
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	b := handler.(*BlockIP)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := b.ReloadGeoDatabase(); err != nil {
+				t.Errorf("reload %d: unexpected error: %v", i, err)
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		if status := requestFrom(handler, "203.0.113.5:1234"); status != http.StatusForbidden {
+			t.Errorf("request %d: expected 403 during reloads, got %d", i, status)
+			break
+		}
+	}
+	<-done
+}
+
+func TestGeoDatabaseFileMissing(t *testing.T) {
+	config := CreateConfig()
+	config.GeoDatabaseFile = filepath.Join(t.TempDir(), "missing.mmdb")
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), config, "blockip-test")
+	if err == nil {
+		t.Errorf("expected an error for a missing GeoIP database")
+	}
+}
@@ -0,0 +1,88 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
+)
+
+// negationPrefix marks a blocked CIDR that blocks every IP outside it
+const negationPrefix = "!"
+
+// addNegatedCIDR adds a "!<cidr>" block rule. IPs outside every negated CIDR
+// are blocked; whitelisted IPs are still allowed.
+func (b *BlockIP) addNegatedCIDR(cidr string, group string) error {
+	ipnet, err := parseCanonicalCIDR(ipsanitize.Clean(cidr))
+	if err != nil {
+		return fmt.Errorf("invalid negated CIDR format: %w", err)
+	}
+
+	b.lookup.negatedNets = append(b.lookup.negatedNets, ipnet)
+	rule := negationPrefix + ipnet.String()
+	if _, exists := b.lookup.ruleGroups[rule]; !exists {
+		b.lookup.ruleGroups[rule] = group
+	}
+	if b.debug {
+		b.logger.Debug("[%s] Added negated blocked CIDR: %s", b.name, rule)
+	}
+	return nil
+}
+
+// matchNegated returns the negated rule blocking ip when it lies outside
+// every negated CIDR. Callers must hold s.mu.
+func (s *ipLookupService) matchNegated(ip net.IP) (string, bool) {
+	if len(s.negatedNets) == 0 {
+		return "", false
+	}
+	for _, ipnet := range s.negatedNets {
+		if ipnet.Contains(ip) {
+			return "", false
+		}
+	}
+	return negationPrefix + s.negatedNets[0].String(), true
+}
+
+// negatedRanges returns the address ranges blocked by the negated CIDRs:
+// the gaps between them across both address families. Callers must hold
+// s.mu.
+func (s *ipLookupService) negatedRanges() []addrRange {
+	if len(s.negatedNets) == 0 {
+		return nil
+	}
+
+	kept := make([]addrRange, 0, len(s.negatedNets))
+	for _, ipnet := range s.negatedNets {
+		if prefix, ok := netPrefix(ipnet); ok {
+			kept = append(kept, addrRange{from: prefix.Addr(), to: lastAddr(prefix)})
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].from.Less(kept[j].from)
+	})
+
+	var gaps []addrRange
+	for _, family := range []addrRange{
+		{from: netip.IPv4Unspecified(), to: netip.AddrFrom4([4]byte{255, 255, 255, 255})},
+		{from: netip.IPv6Unspecified(), to: lastAddr(netip.PrefixFrom(netip.IPv6Unspecified(), 0))},
+	} {
+		next := family.from
+		for _, r := range kept {
+			if r.from.Is4() != family.from.Is4() || !next.IsValid() {
+				continue
+			}
+			if next.Less(r.from) {
+				gaps = append(gaps, addrRange{from: next, to: r.from.Prev()})
+			}
+			if next.Compare(r.to) <= 0 {
+				next = r.to.Next()
+			}
+		}
+		if next.IsValid() {
+			gaps = append(gaps, addrRange{from: next, to: family.to})
+		}
+	}
+	return gaps
+}
@@ -0,0 +1,81 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNegatedCIDRs(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"!10.0.0.0/8", "!192.168.0.0/16", "10.66.0.0/16"}
+	config.WhitelistIPs = []string{"203.0.113.5"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"10.1.2.3:12345", 200, "Inside negated range"},
+		{"192.168.1.1:12345", 200, "Inside second negated range"},
+		{"198.51.100.1:12345", 403, "Outside negated ranges"},
+		{"[2001:db8::1]:12345", 403, "Other address family"},
+		{"203.0.113.5:12345", 200, "Whitelist wins over negation"},
+		{"10.66.1.1:12345", 403, "Plain CIDR inside negated range still blocks"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "198.51.100.1:12345"
+	if status, rule := handler.(*BlockIP).Evaluate(req); status != statusBlocked || rule != "!10.0.0.0/8" {
+		t.Errorf("Expected block by !10.0.0.0/8, got %s %q", status, rule)
+	}
+}
+
+func TestNegatedCIDRExport(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"!128.0.0.0/1", "!::/1"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	expected := []string{"0.0.0.0/1", "8000::/1"}
+	if merged := handler.(*BlockIP).ExportMergedCIDRs(); !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v, got %v", expected, merged)
+	}
+}
+
+func TestNegatedWhitelistCIDRRejected(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"198.51.100.1"}
+	config.WhitelistCIDRs = []string{"!10.0.0.0/8"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	if code := requestFrom(handler, "192.0.2.1:12345"); code != 200 {
+		t.Errorf("Expected negated whitelist entry to be ignored, got %d", code)
+	}
+}
@@ -0,0 +1,150 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// netset holds the entries loaded from FireHOL-style netset and ipset files
+type netset struct {
+	ips  map[string]bool
+	nets []*net.IPNet
+	trie *cidrTrie // index over nets, built once the set is loaded
+
+	// sources maps each entry to the file or URL it was first loaded from
+	sources map[string]string
+}
+
+// newNetset creates an empty netset
+func newNetset() *netset {
+	return &netset{ips: make(map[string]bool), sources: make(map[string]string)}
+}
+
+// addSource records source as the origin of rule unless it already has one
+func (s *netset) addSource(rule, source string) {
+	if _, exists := s.sources[rule]; !exists {
+		s.sources[rule] = source
+	}
+}
+
+// netsetList is a set of netset files that can be reloaded while serving
+type netsetList struct {
+	files []string
+	set   atomic.Value // *netset
+}
+
+// current returns the loaded netset, nil before the first load
+func (l *netsetList) current() *netset {
+	set, _ := l.set.Load().(*netset)
+	return set
+}
+
+// size returns the number of loaded entries
+func (l *netsetList) size() int {
+	set := l.current()
+	if set == nil {
+		return 0
+	}
+	return len(set.ips) + len(set.nets)
+}
+
+// match returns the netset entry containing ip
+func (l *netsetList) match(ip string) (string, bool) {
+	set := l.current()
+	if set == nil {
+		return "", false
+	}
+
+	if set.ips[ip] {
+		return ip, true
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return "", false
+	}
+	if ipnet, ok := set.trie.match(parsedIP); ok {
+		return ipnet.String(), true
+	}
+	return "", false
+}
+
+// sourceOf returns the netset file rule was loaded from
+func (l *netsetList) sourceOf(rule string) string {
+	set := l.current()
+	if set == nil {
+		return ""
+	}
+	return set.sources[rule]
+}
+
+// loadNetsets reads every netset file and swaps in the result. The current
+// entries are kept when any file cannot be read.
+func (b *BlockIP) loadNetsets() error {
+	set := newNetset()
+
+	for _, file := range b.netsets.files {
+		if _, err := b.loadListFile(file, b.netsetAdder(set, b.rejectCatchAllCIDR, file)); err != nil {
+			return err
+		}
+	}
+
+	set.trie = newCIDRTrie(set.nets)
+	b.netsets.set.Store(set)
+	b.lookup.clearCache()
+
+	if b.debug {
+		b.logger.Debug("[%s] Loaded %d netset entries", b.name, len(set.ips)+len(set.nets))
+	}
+	return nil
+}
+
+// netsetAdder returns a list entry handler that adds IPs and CIDRs loaded
+// from source to set, rejecting catch-all CIDRs when rejectCatchAll is set
+func (b *BlockIP) netsetAdder(set *netset, rejectCatchAll bool, source string) func(entry string) error {
+	return func(entry string) error {
+		if strings.Contains(entry, "/") {
+			ipnet, err := parseCanonicalCIDR(entry)
+			if err != nil {
+				return fmt.Errorf("invalid CIDR format: %w", err)
+			}
+			if rejectCatchAll && isCatchAll(ipnet) {
+				return catchAllError(ipnet)
+			}
+			if _, exists := set.sources[ipnet.String()]; exists {
+				return nil
+			}
+			set.nets = append(set.nets, ipnet)
+			set.addSource(ipnet.String(), source)
+			return nil
+		}
+		if !isValidIP(entry) {
+			return fmt.Errorf("invalid IP format: %s", entry)
+		}
+		entry = canonicalIP(entry)
+		set.ips[entry] = true
+		set.addSource(entry, source)
+		return nil
+	}
+}
+
+// refreshNetsets reloads the netset files every interval until ctx is done
+func (b *BlockIP) refreshNetsets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.loadNetsets(); err != nil {
+				b.logger.Error("[%s] Error refreshing netset files: %v", b.name, err)
+			}
+		}
+	}
+}
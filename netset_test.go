@@ -0,0 +1,146 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+const sampleNetset = `#
+# firehol_level1
+#
+# ipv4 hash:net ipset
+#
+# Maintainer      : FireHOL
+# Source URL      : http://iplists.firehol.org/
+# This File Date  : Mon Jan  1 00:00:00 UTC 2024
+#
+# 198.51.100.0/24 was removed from this list
+#
+203.0.113.0/24
+192.0.2.15
+10.250.0.0/16 # inline comment
+not-an-entry
+`
+
+func TestNetsetFile(t *testing.T) {
+	config := CreateConfig()
+	config.NetsetFiles = []string{writeListFile(t, sampleNetset)}
+	b := newTestHandler(t, config)
+
+	if size := b.netsets.size(); size != 3 {
+		t.Errorf("Expected 3 netset entries, got %d", size)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.42:12345", 403, "CIDR entry"},
+		{"192.0.2.15:12345", 403, "IP entry"},
+		{"10.250.3.4:12345", 403, "Entry with inline comment"},
+		{"198.51.100.7:12345", 200, "Network named only in a comment"},
+		{"8.8.8.8:12345", 200, "Unlisted IP"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(b, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestNetsetMatch(t *testing.T) {
+	config := CreateConfig()
+	config.NetsetFiles = []string{writeListFile(t, "10.0.0.0/25\n10.0.0.128/25\n10.1.0.0/16\n10.1.2.0/24\n2001:db8::/32\n192.0.2.15\n")}
+	b := newTestHandler(t, config)
+
+	tests := []struct {
+		ip       string
+		expected string
+		testName string
+	}{
+		{"10.0.0.5", "10.0.0.0/25", "Lower half of adjacent networks"},
+		{"10.0.0.200", "10.0.0.128/25", "Upper half of adjacent networks"},
+		{"10.1.2.3", "10.1.0.0/16", "Nested network"},
+		{"10.1.9.9", "10.1.0.0/16", "Outer network"},
+		{"2001:db8::1", "2001:db8::/32", "IPv6 network"},
+		{"192.0.2.15", "192.0.2.15", "IP entry"},
+		{"10.2.0.1", "", "Unlisted IP"},
+	}
+
+	for _, test := range tests {
+		rule, ok := b.netsets.match(test.ip)
+		if ok != (test.expected != "") || rule != test.expected {
+			t.Errorf("%s: expected %q, got %q (matched %v)", test.testName, test.expected, rule, ok)
+		}
+	}
+}
+
+func TestNetsetRefresh(t *testing.T) {
+	path := writeListFile(t, "203.0.113.0/24\n")
+
+	config := CreateConfig()
+	config.NetsetFiles = []string{path}
+	config.NetsetRefreshIntervalDuration = "10ms"
+	b := newTestHandler(t, config)
+
+	if code := requestFrom(b, "203.0.113.5:12345"); code != 403 {
+		t.Fatalf("Expected netset entry to be blocked, got %d", code)
+	}
+
+	if err := os.WriteFile(path, []byte("# replaced\n198.51.100.0/24\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite netset file: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for requestFrom(b, "198.51.100.5:12345") != 403 {
+		if time.Now().After(deadline) {
+			t.Fatal("Netset file was never reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if code := requestFrom(b, "203.0.113.5:12345"); code != 200 {
+		t.Errorf("Expected removed entry to be allowed after reload, got %d", code)
+	}
+}
+
+func TestNetsetRefreshKeepsEntriesOnError(t *testing.T) {
+	path := writeListFile(t, "203.0.113.0/24\n")
+
+	config := CreateConfig()
+	config.NetsetFiles = []string{path}
+	config.NetsetRefreshInterval = 0
+	b := newTestHandler(t, config)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove netset file: %v", err)
+	}
+
+	captureStdout(t, func() {
+		if err := b.loadNetsets(); err == nil {
+			t.Error("Expected error reloading a missing netset file")
+		}
+	})
+
+	if code := requestFrom(b, "203.0.113.5:12345"); code != 403 {
+		t.Errorf("Expected previous entries to be kept, got %d", code)
+	}
+}
+
+func TestMissingNetsetFile(t *testing.T) {
+	config := CreateConfig()
+	config.NetsetFiles = []string{"/nonexistent/firehol_level1.netset"}
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for missing netset file")
+	}
+}
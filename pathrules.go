@@ -0,0 +1,90 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// PathRule holds additional lists applied to requests for matching paths.
+// Paths are prefixes such as "/admin"; PathRegexps are matched against the
+// whole request path.
+type PathRule struct {
+	Paths          []string `json:"paths,omitempty"`
+	PathRegexps    []string `json:"pathRegexps,omitempty"`
+	BlockedIPs     []string `json:"blockedIPs,omitempty"`
+	BlockedCIDRs   []string `json:"blockedCIDRs,omitempty"`
+	WhitelistIPs   []string `json:"whitelistIPs,omitempty"`
+	WhitelistCIDRs []string `json:"whitelistCIDRs,omitempty"`
+}
+
+// pathRuleset is a loaded path rule
+type pathRuleset struct {
+	prefixes []string
+	regexps  []*regexp.Regexp
+	lookup   *ipLookupService
+}
+
+// loadPathRules builds the path rulesets in configuration order, compiling
+// their regexps. Catch-all blocked CIDRs are refused when rejectCatchAll is
+// set.
+func loadPathRules(rules []PathRule, rejectCatchAll bool) ([]*pathRuleset, error) {
+	rulesets := make([]*pathRuleset, 0, len(rules))
+	for i, rule := range rules {
+		if len(rule.Paths) == 0 && len(rule.PathRegexps) == 0 {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("path rule %d has no paths", i), nil)
+		}
+
+		lookup, err := newRulesetLookup("path rule", rule.BlockedIPs, rule.BlockedCIDRs, rule.WhitelistIPs, rule.WhitelistCIDRs, rejectCatchAll)
+		if err != nil {
+			return nil, err
+		}
+
+		rs := &pathRuleset{lookup: lookup}
+		for _, path := range rule.Paths {
+			if path = strings.TrimSpace(path); path != "" {
+				rs.prefixes = append(rs.prefixes, path)
+			}
+		}
+		for _, pattern := range rule.PathRegexps {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid path rule regexp %q", pattern), err)
+			}
+			rs.regexps = append(rs.regexps, re)
+		}
+		rulesets = append(rulesets, rs)
+	}
+	return rulesets, nil
+}
+
+// matches reports whether path is covered by the ruleset
+func (rs *pathRuleset) matches(path string) bool {
+	for _, prefix := range rs.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, re := range rs.regexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPathRules checks the lists of the first path rule matching the
+// request path for an IP allowed by the global and host lists
+func (b *BlockIP) applyPathRules(req *http.Request, clientIP string, d decision) decision {
+	if len(b.pathRules) == 0 || (d.status != statusAllowed && d.rule != ruleDefaultDeny) {
+		return d
+	}
+
+	for _, rs := range b.pathRules {
+		if rs.matches(req.URL.Path) {
+			return b.applyRulesetLookup("path rule", rs.lookup, clientIP, d)
+		}
+	}
+	return d
+}
@@ -0,0 +1,66 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestPathRules(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.PathRules = []PathRule{
+		{Paths: []string{"/admin"}, BlockedCIDRs: []string{"203.0.113.0/24"}, WhitelistIPs: []string{"203.0.113.9"}},
+		{PathRegexps: []string{`^/api/v[0-9]+/internal/`}, BlockedIPs: []string{"198.51.100.7"}},
+	}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		path       string
+		expected   int
+		testName   string
+	}{
+		{"203.0.113.5:12345", "/admin", 403, "Blocked on /admin"},
+		{"203.0.113.5:12345", "/admin/users", 403, "Blocked under /admin"},
+		{"203.0.113.5:12345", "/public", 200, "Same IP allowed on /public"},
+		{"203.0.113.9:12345", "/admin", 200, "Path rule whitelist"},
+		{"198.51.100.7:12345", "/api/v2/internal/jobs", 403, "Blocked by regexp"},
+		{"198.51.100.7:12345", "/api/v2/public", 200, "Regexp does not match"},
+		{"192.168.1.100:12345", "/public", 403, "Global rules still apply"},
+	}
+
+	for _, test := range tests {
+		if code := requestPath(handler, test.remoteAddr, test.path); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestInvalidPathRules(t *testing.T) {
+	tests := []struct {
+		rule     PathRule
+		testName string
+	}{
+		{PathRule{BlockedIPs: []string{"203.0.113.5"}}, "No paths"},
+		{PathRule{PathRegexps: []string{"/admin("}, BlockedIPs: []string{"203.0.113.5"}}, "Invalid regexp"},
+		{PathRule{Paths: []string{"/admin"}, BlockedCIDRs: []string{"203.0.113.0/33"}}, "Invalid CIDR"},
+		{PathRule{Paths: []string{"/admin"}, WhitelistIPs: []string{"not-an-ip"}}, "Invalid IP"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.PathRules = []PathRule{test.rule}
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
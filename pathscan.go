@@ -0,0 +1,71 @@
+package traefik_plugin_blockip
+
+import (
+	"sync"
+	"time"
+)
+
+// ruleDistinctPaths identifies blocks of IPs probing too many distinct paths
+const ruleDistinctPaths = "distinct-paths"
+
+// maxTrackedPathLength bounds the part of a path remembered per request
+const maxTrackedPathLength = 256
+
+// pathWindow records the distinct paths one IP requested in a fixed window
+type pathWindow struct {
+	start int64
+	paths map[string]struct{}
+}
+
+// pathTracker counts distinct paths per IP. At most limit+1 paths are
+// remembered per IP, so memory stays bounded however many paths are probed.
+type pathTracker struct {
+	mu      sync.Mutex
+	limit   int
+	period  time.Duration
+	windows map[string]*pathWindow
+}
+
+// newPathTracker creates a tracker allowing limit distinct paths per period
+func newPathTracker(limit int, period time.Duration) *pathTracker {
+	return &pathTracker{
+		limit:   limit,
+		period:  period,
+		windows: make(map[string]*pathWindow),
+	}
+}
+
+// allow records path for ip and reports whether the IP is still within the
+// distinct path limit
+func (p *pathTracker) allow(ip, path string) bool {
+	if len(path) > maxTrackedPathLength {
+		path = path[:maxTrackedPathLength]
+	}
+	now := time.Now().UnixNano()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, ok := p.windows[ip]
+	if !ok || now-w.start >= int64(p.period) {
+		if !ok && len(p.windows) >= maxCacheEntries {
+			p.cleanup(now)
+		}
+		w = &pathWindow{start: now, paths: make(map[string]struct{})}
+		p.windows[ip] = w
+	}
+
+	if len(w.paths) <= p.limit {
+		w.paths[path] = struct{}{}
+	}
+	return len(w.paths) <= p.limit
+}
+
+// cleanup removes windows that have ended. Callers must hold p.mu.
+func (p *pathTracker) cleanup(now int64) {
+	for ip, w := range p.windows {
+		if now-w.start >= int64(p.period) {
+			delete(p.windows, ip)
+		}
+	}
+}
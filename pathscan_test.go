@@ -0,0 +1,83 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPathScanHandler(t *testing.T, limit int) http.Handler {
+	config := CreateConfig()
+	config.MaxDistinctPaths = limit
+	config.WhitelistIPs = []string{"10.0.0.1"}
+	return newTestHandler(t, config)
+}
+
+func TestMaxDistinctPaths(t *testing.T) {
+	handler := newPathScanHandler(t, 5)
+
+	for i := 1; i <= 5; i++ {
+		if code := requestPath(handler, "203.0.113.5:12345", fmt.Sprintf("/probe-%d", i)); code != 200 {
+			t.Fatalf("Expected path %d to be allowed, got %d", i, code)
+		}
+	}
+	// Repeating a known path does not count
+	if code := requestPath(handler, "203.0.113.5:12345", "/probe-1"); code != 200 {
+		t.Errorf("Expected repeated path to be allowed, got %d", code)
+	}
+
+	if code := requestPath(handler, "203.0.113.5:12345", "/probe-6"); code != 403 {
+		t.Errorf("Expected IP to be blocked past the distinct path limit, got %d", code)
+	}
+	if code := requestPath(handler, "203.0.113.5:12345", "/probe-1"); code != 403 {
+		t.Errorf("Expected IP to stay blocked for the window, got %d", code)
+	}
+
+	if code := requestPath(handler, "203.0.113.6:12345", "/probe-6"); code != 200 {
+		t.Errorf("Expected other IPs to be unaffected, got %d", code)
+	}
+}
+
+func TestMaxDistinctPathsWhitelisted(t *testing.T) {
+	handler := newPathScanHandler(t, 2)
+
+	for i := 1; i <= 10; i++ {
+		if code := requestPath(handler, "10.0.0.1:12345", fmt.Sprintf("/page-%d", i)); code != 200 {
+			t.Fatalf("Expected whitelisted IP to be exempt, got %d", code)
+		}
+	}
+}
+
+func TestPathTrackerBoundsMemory(t *testing.T) {
+	tracker := newPathTracker(3, time.Minute)
+
+	for i := 0; i < 1000; i++ {
+		tracker.allow("203.0.113.5", fmt.Sprintf("/%d/%s", i, strings.Repeat("x", 1000)))
+	}
+
+	w := tracker.windows["203.0.113.5"]
+	if len(w.paths) != 4 {
+		t.Errorf("Expected at most 4 remembered paths, got %d", len(w.paths))
+	}
+	for path := range w.paths {
+		if len(path) > maxTrackedPathLength {
+			t.Errorf("Expected remembered paths to be truncated, got length %d", len(path))
+		}
+	}
+}
+
+func TestPathTrackerWindowReset(t *testing.T) {
+	tracker := newPathTracker(1, time.Minute)
+
+	tracker.allow("203.0.113.5", "/a")
+	if tracker.allow("203.0.113.5", "/b") {
+		t.Fatal("Expected second distinct path to exceed the limit")
+	}
+
+	tracker.windows["203.0.113.5"].start -= int64(time.Minute)
+	if !tracker.allow("203.0.113.5", "/b") {
+		t.Error("Expected a new window to reset the count")
+	}
+}
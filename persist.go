@@ -0,0 +1,154 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistedCacheVersion is the format version of persisted cache files
+const persistedCacheVersion = 1
+
+// persistedCache is the on-disk form of the blocked and whitelisted cache
+type persistedCache struct {
+	Version int                   `json:"version"`
+	Entries map[string]CacheEntry `json:"entries"`
+}
+
+// snapshot returns a copy of the unexpired entries
+func (c *IPCache) snapshot() map[string]CacheEntry {
+	entries := make(map[string]CacheEntry, c.len())
+	if c.ttl <= 0 {
+		return entries
+	}
+
+	now := time.Now().UnixNano()
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		for ip, elem := range shard.cache {
+			if entry := elem.Value.(*cacheItem).entry; !entry.expired(now, c.ttl) {
+				entries[ip] = entry
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return entries
+}
+
+// restore stores an entry with its original timestamp unless it has
+// expired, and reports whether it was stored
+func (c *IPCache) restore(ip string, entry CacheEntry) bool {
+	if c.ttl <= 0 || entry.expired(time.Now().UnixNano(), c.ttl) {
+		return false
+	}
+	if c.maxEntries > 0 && c.len() >= c.maxEntries {
+		return false
+	}
+
+	shard := c.shardFor(ip)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	c.store(shard, ip, entry)
+	return true
+}
+
+// saveCache writes the blocked and whitelisted cache entries to path. The
+// file is replaced atomically so a crash never leaves a partial file.
+func (b *BlockIP) saveCache(path string) error {
+	data, err := json.Marshal(persistedCache{
+		Version: persistedCacheVersion,
+		Entries: b.lookup.cache.snapshot(),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadPersistedCache restores the cache entries saved at path, dropping
+// expired ones, those the current whitelist contradicts and blocks whose
+// rule no longer matches. A missing file is not an error.
+func (b *BlockIP) loadPersistedCache(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("cannot read cache file %s", path), err)
+	}
+
+	var persisted persistedCache
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return NewBlockIPError(ErrCodeParseError, fmt.Sprintf("cannot parse cache file %s", path), err)
+	}
+	if persisted.Version != persistedCacheVersion {
+		return NewBlockIPError(ErrCodeParseError, fmt.Sprintf("unsupported cache file version %d in %s", persisted.Version, path), nil)
+	}
+
+	restored := 0
+	for ip, entry := range persisted.Entries {
+		if !isValidIP(ip) || (entry.Status != statusBlocked && entry.Status != statusWhitelisted) {
+			continue
+		}
+		if (entry.Status == statusWhitelisted) != b.lookup.isWhitelisted(ip) {
+			continue
+		}
+		if entry.Status == statusBlocked {
+			if rule, ok := b.lookup.matchBlocked(ip); !ok || rule != entry.Rule {
+				continue
+			}
+		}
+		if b.lookup.cache.restore(ip, entry) {
+			restored++
+		}
+	}
+
+	if b.debug {
+		b.logger.Debug("[%s] Restored %d of %d cache entries from %s", b.name, restored, len(persisted.Entries), path)
+	}
+	return nil
+}
+
+// persistCache saves the cache to path every interval, if positive, and
+// once more when ctx is done
+func (b *BlockIP) persistCache(ctx context.Context, path string, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.saveCache(path); err != nil {
+				b.logger.Error("[%s] Error saving cache to %s: %v", b.name, path, err)
+			}
+			return
+		case <-tick:
+			if err := b.saveCache(path); err != nil {
+				b.logger.Error("[%s] Error saving cache to %s: %v", b.name, path, err)
+			}
+		}
+	}
+}
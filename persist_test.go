@@ -0,0 +1,193 @@
+package traefik_plugin_blockip
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"192.168.1.0/24"}
+	config.WhitelistIPs = []string{"10.0.0.1"}
+	config.CachePersistPath = path
+	config.CachePersistInterval = 0
+
+	first := newTestHandler(t, config)
+	requestFrom(first, "192.168.1.100:12345")
+	requestFrom(first, "10.0.0.1:12345")
+	requestFrom(first, "203.0.113.5:12345")
+	if err := first.saveCache(path); err != nil {
+		t.Fatalf("Failed to save cache: %v", err)
+	}
+
+	second := newTestHandler(t, config)
+
+	tests := []struct {
+		ip       string
+		expected string
+		testName string
+	}{
+		{"192.168.1.100", statusBlocked, "Blocked entry restored"},
+		{"10.0.0.1", statusWhitelisted, "Whitelisted entry restored"},
+		{"203.0.113.5", "", "Allowed entries are not persisted"},
+	}
+
+	for _, test := range tests {
+		entry, ok := second.lookup.cache.get(test.ip)
+		if test.expected == "" {
+			if ok {
+				t.Errorf("%s: expected no entry, got %+v", test.testName, entry)
+			}
+			continue
+		}
+		if !ok || entry.Status != test.expected {
+			t.Errorf("%s: expected %s entry, got %+v (found %v)", test.testName, test.expected, entry, ok)
+		}
+		if ok && test.expected == statusBlocked && entry.Rule != "192.168.1.0/24" {
+			t.Errorf("%s: expected the original rule, got %q", test.testName, entry.Rule)
+		}
+	}
+}
+
+func TestCachePersistenceDropsRemovedRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"192.168.1.0/24", "10.1.0.0/16", "172.16.0.0/12"}
+	config.CachePersistPath = path
+	config.CachePersistInterval = 0
+
+	first := newTestHandler(t, config)
+	requestFrom(first, "192.168.1.100:12345")
+	requestFrom(first, "10.1.2.3:12345")
+	requestFrom(first, "172.16.5.5:12345")
+	if err := first.saveCache(path); err != nil {
+		t.Fatalf("Failed to save cache: %v", err)
+	}
+
+	config.BlockedCIDRs = []string{"192.168.1.0/24", "172.16.5.0/24"}
+	second := newTestHandler(t, config)
+
+	tests := []struct {
+		ip       string
+		restored bool
+		testName string
+	}{
+		{"192.168.1.100", true, "Rule still configured"},
+		{"10.1.2.3", false, "Rule removed"},
+		{"172.16.5.5", false, "Still blocked but by a different rule"},
+	}
+
+	for _, test := range tests {
+		if _, ok := second.lookup.cache.get(test.ip); ok != test.restored {
+			t.Errorf("%s: expected restored=%v, got %v", test.testName, test.restored, ok)
+		}
+	}
+}
+
+func TestCachePersistenceDropsStaleEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	now := time.Now()
+
+	data, err := json.Marshal(persistedCache{
+		Version: persistedCacheVersion,
+		Entries: map[string]CacheEntry{
+			"192.168.1.1": {Status: statusBlocked, Rule: "192.168.1.0/24", Timestamp: now.Add(-time.Minute).UnixNano()},
+			"192.168.1.2": {Status: statusBlocked, Rule: "192.168.1.0/24", Timestamp: now.Add(-time.Hour).UnixNano()},
+			"10.0.0.1":    {Status: statusBlocked, Rule: "10.0.0.0/8", Timestamp: now.UnixNano()},
+			"10.0.0.2":    {Status: statusWhitelisted, Timestamp: now.UnixNano()},
+			"not-an-ip":   {Status: statusBlocked, Timestamp: now.UnixNano()},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode cache: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write cache file: %v", err)
+	}
+
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"192.168.1.0/24"}
+	config.WhitelistIPs = []string{"10.0.0.1"}
+	config.CacheTTL = 300
+	config.CachePersistPath = path
+	b := newTestHandler(t, config)
+
+	tests := []struct {
+		ip       string
+		restored bool
+		testName string
+	}{
+		{"192.168.1.1", true, "Unexpired entry"},
+		{"192.168.1.2", false, "Expired entry"},
+		{"10.0.0.1", false, "Blocked entry of a now whitelisted IP"},
+		{"10.0.0.2", false, "Whitelisted entry of an IP no longer whitelisted"},
+		{"not-an-ip", false, "Invalid IP"},
+	}
+
+	for _, test := range tests {
+		if _, ok := b.lookup.cache.get(test.ip); ok != test.restored {
+			t.Errorf("%s: expected restored=%v, got %v", test.testName, test.restored, ok)
+		}
+	}
+}
+
+func TestCachePersistedOnStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.CachePersistPath = path
+	config.CachePersistInterval = 0
+
+	b := newTestHandler(t, config)
+	requestFrom(b, "192.168.1.100:12345")
+	b.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var persisted persistedCache
+			if err := json.Unmarshal(data, &persisted); err != nil {
+				t.Fatalf("Failed to decode cache file: %v", err)
+			}
+			if persisted.Entries["192.168.1.100"].Status != statusBlocked {
+				t.Errorf("Expected the blocked entry to be saved, got %+v", persisted.Entries)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the cache to be saved on stop")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCachePersistenceCorruptFile(t *testing.T) {
+	for _, content := range []string{"not json", `{"version": 99, "entries": {}}`} {
+		path := filepath.Join(t.TempDir(), "cache.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write cache file: %v", err)
+		}
+
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.CachePersistPath = path
+		b := newTestHandler(t, config)
+
+		if code := requestFrom(b, "192.168.1.100:12345"); code != http.StatusForbidden {
+			t.Errorf("%q: expected a working plugin with a cold cache, got %d", content, code)
+		}
+		if logs := strings.Join(b.logger.GetLogs(0), "\n"); !strings.Contains(logs, "Ignoring persisted cache") {
+			t.Errorf("%q: expected a warning about the cache file, got %v", content, logs)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ruleSourcePortPrefix identifies blocks by the RemoteAddr source port
+const ruleSourcePortPrefix = "source-port:"
+
+// portRange is an inclusive range of ports
+type portRange struct {
+	low, high int
+}
+
+// parsePortRanges parses ports such as "8080" and ranges such as "0-1023"
+func parsePortRanges(field string, entries []string) ([]portRange, error) {
+	ranges := make([]portRange, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		low, high, isRange := strings.Cut(entry, "-")
+		if !isRange {
+			high = low
+		}
+
+		lowPort, errLow := strconv.Atoi(strings.TrimSpace(low))
+		highPort, errHigh := strconv.Atoi(strings.TrimSpace(high))
+		if errLow != nil || errHigh != nil || lowPort < 0 || highPort > 65535 || lowPort > highPort {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid %s entry: %q", field, entry), nil)
+		}
+		ranges = append(ranges, portRange{low: lowPort, high: highPort})
+	}
+	return ranges, nil
+}
+
+// containsPort reports whether port falls in any of ranges
+func containsPort(ranges []portRange, port int) bool {
+	for _, r := range ranges {
+		if port >= r.low && port <= r.high {
+			return true
+		}
+	}
+	return false
+}
+
+// remotePort returns the port of the request's RemoteAddr
+func remotePort(req *http.Request) (int, bool) {
+	_, port, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// matchSourcePort returns the port rule req is blocked by, if any. Ports in
+// the blocked ranges are refused, and when allowed ranges are configured
+// every port outside them is refused too. Requests without a port pass.
+func (b *BlockIP) matchSourcePort(req *http.Request) (string, bool) {
+	port, ok := remotePort(req)
+	if !ok {
+		return "", false
+	}
+
+	if containsPort(b.blockedSourcePorts, port) ||
+		(len(b.allowedSourcePorts) > 0 && !containsPort(b.allowedSourcePorts, port)) {
+		return ruleSourcePortPrefix + strconv.Itoa(port), true
+	}
+	return "", false
+}
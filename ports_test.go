@@ -0,0 +1,69 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestSourcePortRules(t *testing.T) {
+	tests := []struct {
+		blocked    []string
+		allowed    []string
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{[]string{"0-1023"}, nil, "203.0.113.5:80", 403, "Privileged source port blocked"},
+		{[]string{"0-1023"}, nil, "203.0.113.5:40000", 200, "Ephemeral source port allowed"},
+		{[]string{"6667"}, nil, "[2001:db8::1]:6667", 403, "Single blocked port over IPv6"},
+		{nil, []string{"32768-60999"}, "203.0.113.5:40000", 200, "Port inside the allowed range"},
+		{nil, []string{"32768-60999"}, "203.0.113.5:1234", 403, "Port outside the allowed range"},
+		{[]string{"40000"}, []string{"32768-60999"}, "203.0.113.5:40000", 403, "Blocked port beats allowed range"},
+		{[]string{"0-1023"}, nil, "203.0.113.5", 200, "RemoteAddr without port"},
+		{[]string{"0-1023"}, nil, "10.0.0.1:80", 200, "Whitelisted IP"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedSourcePorts = test.blocked
+		config.AllowedSourcePorts = test.allowed
+		config.WhitelistIPs = []string{"10.0.0.1"}
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestInvalidSourcePorts(t *testing.T) {
+	tests := []struct {
+		ports    []string
+		testName string
+	}{
+		{[]string{"http"}, "Not a number"},
+		{[]string{"70000"}, "Out of range"},
+		{[]string{"2000-1000"}, "Reversed range"},
+		{[]string{""}, "Empty entry"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedSourcePorts = test.ports
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
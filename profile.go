@@ -0,0 +1,71 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+)
+
+// Profile holds per-environment overrides merged over the base settings
+// when selected through Config.ActiveProfile. Unset fields keep the base
+// value and lists are appended to the base lists.
+type Profile struct {
+	DryRun     *bool  `json:"dryRun,omitempty"`
+	Debug      *bool  `json:"debug,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Message    string `json:"message,omitempty"`
+	FlagHeader string `json:"flagHeader,omitempty"`
+	CacheTTL   *int   `json:"cacheTTL,omitempty"`
+
+	BlockedIPs     []string `json:"blockedIPs,omitempty"`
+	BlockedCIDRs   []string `json:"blockedCIDRs,omitempty"`
+	WhitelistIPs   []string `json:"whitelistIPs,omitempty"`
+	WhitelistCIDRs []string `json:"whitelistCIDRs,omitempty"`
+}
+
+// applyProfile returns the effective configuration with the active profile
+// merged in. The given config is not modified.
+func applyProfile(config *Config) (*Config, error) {
+	if config.ActiveProfile == "" {
+		return config, nil
+	}
+
+	profile, ok := config.Profiles[config.ActiveProfile]
+	if !ok {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig,
+			fmt.Sprintf("active profile %q is not defined", config.ActiveProfile), nil)
+	}
+
+	effective := *config
+	if profile.DryRun != nil {
+		effective.DryRun = *profile.DryRun
+	}
+	if profile.Debug != nil {
+		effective.Debug = *profile.Debug
+	}
+	if profile.StatusCode != 0 {
+		effective.StatusCode = profile.StatusCode
+	}
+	if profile.Message != "" {
+		effective.Message = profile.Message
+	}
+	if profile.FlagHeader != "" {
+		effective.FlagHeader = profile.FlagHeader
+	}
+	if profile.CacheTTL != nil {
+		effective.CacheTTL = *profile.CacheTTL
+		effective.CacheTTLDuration = ""
+	}
+
+	effective.BlockedIPs = mergeLists(config.BlockedIPs, profile.BlockedIPs)
+	effective.BlockedCIDRs = mergeLists(config.BlockedCIDRs, profile.BlockedCIDRs)
+	effective.WhitelistIPs = mergeLists(config.WhitelistIPs, profile.WhitelistIPs)
+	effective.WhitelistCIDRs = mergeLists(config.WhitelistCIDRs, profile.WhitelistCIDRs)
+
+	return &effective, nil
+}
+
+// mergeLists returns a new slice holding base followed by extra
+func mergeLists(base, extra []string) []string {
+	merged := make([]string, 0, len(base)+len(extra))
+	merged = append(merged, base...)
+	return append(merged, extra...)
+}
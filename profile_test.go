@@ -0,0 +1,100 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func profileConfig(active string) *Config {
+	dryRun := true
+	enforce := false
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"203.0.113.5"}
+	config.Profiles = map[string]Profile{
+		"staging": {DryRun: &dryRun, FlagHeader: "X-Would-Block"},
+		"prod":    {DryRun: &enforce, StatusCode: 451, BlockedIPs: []string{"198.51.100.7"}},
+	}
+	config.ActiveProfile = active
+	return config
+}
+
+func TestApplyProfile(t *testing.T) {
+	tests := []struct {
+		profile    string
+		dryRun     bool
+		statusCode int
+		blocked    int
+		testName   string
+	}{
+		{"", false, 403, 1, "No profile"},
+		{"staging", true, 403, 1, "Staging profile"},
+		{"prod", false, 451, 2, "Prod profile"},
+	}
+
+	for _, test := range tests {
+		base := profileConfig(test.profile)
+		effective, err := applyProfile(base)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.testName, err)
+		}
+
+		if effective.DryRun != test.dryRun {
+			t.Errorf("%s: expected dryRun %v, got %v", test.testName, test.dryRun, effective.DryRun)
+		}
+		if effective.StatusCode != test.statusCode {
+			t.Errorf("%s: expected status code %d, got %d", test.testName, test.statusCode, effective.StatusCode)
+		}
+		if len(effective.BlockedIPs) != test.blocked {
+			t.Errorf("%s: expected %d blocked IPs, got %d", test.testName, test.blocked, len(effective.BlockedIPs))
+		}
+		if len(base.BlockedIPs) != 1 {
+			t.Errorf("%s: base config was modified", test.testName)
+		}
+	}
+}
+
+func TestActiveProfileBehavior(t *testing.T) {
+	tests := []struct {
+		profile    string
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"staging", "203.0.113.5:12345", 200, "Staging passes blocked IP"},
+		{"prod", "203.0.113.5:12345", 451, "Prod blocks base list"},
+		{"prod", "198.51.100.7:12345", 451, "Prod blocks profile list"},
+		{"staging", "198.51.100.7:12345", 200, "Staging lacks prod list"},
+	}
+
+	for _, test := range tests {
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), profileConfig(test.profile), "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestUnknownActiveProfile(t *testing.T) {
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), profileConfig("qa"), "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for undefined active profile")
+	}
+}
@@ -0,0 +1,206 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ruleRateLimit identifies decisions made by the rate limiter
+const ruleRateLimit = "rate-limit"
+
+// ruleCIDRRateLimitPrefix starts the rule of decisions made by a CIDR rate
+// limit, followed by the CIDR
+const ruleCIDRRateLimitPrefix = ruleRateLimit + ":"
+
+// rateLimitBody is the response body sent to rate limited clients
+const rateLimitBody = "Too Many Requests"
+
+// tokenBucket holds the tokens left for one key
+type tokenBucket struct {
+	tokens float64
+	last   int64 // unix nanos of the last refill
+}
+
+// rateLimiter is a token bucket limiter keyed on the client IP, or on the
+// client IP and path when limits are per path. Each bucket holds up to limit
+// tokens and refills at limit tokens per period.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	period  time.Duration
+	perPath bool
+	buckets map[string]*tokenBucket
+}
+
+// newRateLimiter creates a limiter allowing bursts of limit requests and
+// limit requests per period on average
+func newRateLimiter(limit int, period time.Duration, perPath bool) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		period:  period,
+		perPath: perPath,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// key returns the counter key for a request
+func (l *rateLimiter) key(ip, path string) string {
+	if l.perPath {
+		return ip + " " + path
+	}
+	return ip
+}
+
+// allow takes a token for a request. When none is left it reports how long
+// until the next one.
+func (l *rateLimiter) allow(ip, path string) (bool, time.Duration) {
+	now := time.Now().UnixNano()
+	key := l.key(ip, path)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxCacheEntries {
+			l.cleanup(now)
+		}
+		bucket = &tokenBucket{tokens: float64(l.limit), last: now}
+		l.buckets[key] = bucket
+	} else {
+		l.refill(bucket, now)
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := (1 - bucket.tokens) * float64(l.period) / float64(l.limit)
+	return false, time.Duration(math.Ceil(wait))
+}
+
+// refill adds the tokens accrued since the bucket was last refilled
+func (l *rateLimiter) refill(bucket *tokenBucket, now int64) {
+	if l.period <= 0 {
+		bucket.tokens = float64(l.limit)
+	} else {
+		accrued := float64(now-bucket.last) * float64(l.limit) / float64(l.period)
+		bucket.tokens = math.Min(float64(l.limit), bucket.tokens+accrued)
+	}
+	bucket.last = now
+}
+
+// RateRule limits the requests of a whole CIDR
+type RateRule struct {
+	Requests int `json:"requests,omitempty"`
+	Period   int `json:"period,omitempty"` // seconds, defaults to ratePeriod
+}
+
+// cidrRateLimit counts the requests of every IP in network in one window
+type cidrRateLimit struct {
+	network *net.IPNet
+	rule    string
+	limiter *rateLimiter
+}
+
+// loadCIDRRateLimits parses the per-CIDR rate limits, sorted by CIDR
+func loadCIDRRateLimits(rules map[string]RateRule, defaultPeriod time.Duration) ([]*cidrRateLimit, error) {
+	limits := make([]*cidrRateLimit, 0, len(rules))
+	for cidr, rule := range rules {
+		network, err := parseCanonicalCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, NewBlockIPError(ErrCodeInvalidCIDR, fmt.Sprintf("invalid cidrRateLimits CIDR: %q", cidr), err)
+		}
+		if rule.Requests <= 0 || rule.Period < 0 {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig,
+				fmt.Sprintf("cidrRateLimits %s: requests must be positive and period must not be negative", cidr), nil)
+		}
+
+		period := time.Duration(rule.Period) * time.Second
+		if period == 0 {
+			period = defaultPeriod
+		}
+		limits = append(limits, &cidrRateLimit{
+			network: network,
+			rule:    ruleCIDRRateLimitPrefix + network.String(),
+			limiter: newRateLimiter(rule.Requests, period, false),
+		})
+	}
+
+	sort.Slice(limits, func(i, j int) bool { return limits[i].rule < limits[j].rule })
+	return limits, nil
+}
+
+// allowCIDRs counts a request against every CIDR limit containing ip and
+// returns the rule of the first exceeded limit and how long until it allows
+// requests again
+func allowCIDRs(limits []*cidrRateLimit, ip string) (string, time.Duration, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", 0, true
+	}
+
+	exceeded := ""
+	var retryAfter time.Duration
+	for _, limit := range limits {
+		if !limit.network.Contains(parsed) {
+			continue
+		}
+		if ok, wait := limit.limiter.allow(limit.network.String(), ""); !ok && exceeded == "" {
+			exceeded, retryAfter = limit.rule, wait
+		}
+	}
+	return exceeded, retryAfter, exceeded == ""
+}
+
+// isRateLimitRule reports whether rule comes from a rate limit
+func isRateLimitRule(rule string) bool {
+	return rule == ruleRateLimit || strings.HasPrefix(rule, ruleCIDRRateLimitPrefix)
+}
+
+// cleanup removes buckets idle for long enough to have refilled, which
+// behave like new ones. Callers must hold l.mu.
+func (l *rateLimiter) cleanup(now int64) {
+	for key, bucket := range l.buckets {
+		if now-bucket.last >= int64(l.period) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// sweep removes idle buckets
+func (l *rateLimiter) sweep() {
+	now := time.Now().UnixNano()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cleanup(now)
+}
+
+// sweepRateLimits periodically removes idle rate limit buckets until ctx
+// is done, bounding the memory used by clients that went away
+func (b *BlockIP) sweepRateLimits(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if b.rateLimiter != nil {
+				b.rateLimiter.sweep()
+			}
+			for _, limit := range b.cidrLimits {
+				limit.limiter.sweep()
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// requestPath sends a request for path from remoteAddr and returns the status
+func requestPath(handler http.Handler, remoteAddr, path string) int {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestPerPathRateLimit(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.RateLimit = 3
+	config.PerPathRateLimit = true
+
+	handler := newTestHandler(t, config)
+
+	for i := 0; i < 3; i++ {
+		if code := requestPath(handler, "10.0.0.1:12345", "/login"); code != 200 {
+			t.Fatalf("Request %d to /login: expected 200, got %d", i+1, code)
+		}
+	}
+
+	tests := []struct {
+		remoteAddr string
+		path       string
+		expected   int
+		testName   string
+	}{
+		{"10.0.0.1:12345", "/login", 429, "Abused path is throttled"},
+		{"10.0.0.1:12345", "/home", 200, "Other path is not throttled"},
+		{"10.0.0.2:12345", "/login", 200, "Other client on the abused path"},
+	}
+
+	for _, test := range tests {
+		if code := requestPath(handler, test.remoteAddr, test.path); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestRateLimitPerIP(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.RateLimit = 2
+
+	handler := newTestHandler(t, config)
+
+	requestPath(handler, "10.0.0.1:12345", "/login")
+	requestPath(handler, "10.0.0.1:12345", "/login")
+
+	if code := requestPath(handler, "10.0.0.1:12345", "/home"); code != 429 {
+		t.Errorf("Expected limit to span paths without perPathRateLimit, got %d", code)
+	}
+	if code := requestPath(handler, "192.168.1.100:12345", "/home"); code != 403 {
+		t.Errorf("Expected blocked IP to get the block response, got %d", code)
+	}
+}
+
+func TestRateLimitWindowReset(t *testing.T) {
+	limiter := newRateLimiter(1, 0, false)
+
+	// A zero period refills the bucket on every request
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("10.0.0.1", "/"); !ok {
+			t.Errorf("Request %d: expected refilled bucket to allow the request", i+1)
+		}
+	}
+}
+
+func TestInvalidRateLimit(t *testing.T) {
+	config := CreateConfig()
+	config.RateLimit = -1
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for negative rate limit")
+	}
+}
+
+func TestCIDRRateLimits(t *testing.T) {
+	config := CreateConfig()
+	config.CIDRRateLimits = map[string]RateRule{
+		"203.0.113.0/24": {Requests: 3, Period: 60},
+	}
+	config.WhitelistIPs = []string{"203.0.113.200"}
+	handler := newTestHandler(t, config)
+
+	// Three requests from different IPs in the /24 use up its budget
+	for i, addr := range []string{"203.0.113.1:1", "203.0.113.2:1", "203.0.113.3:1"} {
+		if code := requestFrom(handler, addr); code != 200 {
+			t.Errorf("request %d: expected 200 within the CIDR limit, got %d", i+1, code)
+		}
+	}
+
+	if code := requestFrom(handler, "203.0.113.4:1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a fresh IP in the limited /24 to get 429, got %d", code)
+	}
+	if code := requestFrom(handler, "203.0.113.1:1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected an earlier IP in the limited /24 to get 429, got %d", code)
+	}
+
+	if code := requestFrom(handler, "198.51.100.1:1"); code != 200 {
+		t.Errorf("Expected an IP outside the CIDR to pass, got %d", code)
+	}
+	if code := requestFrom(handler, "203.0.113.200:1"); code != 200 {
+		t.Errorf("Expected a whitelisted IP in the CIDR to pass, got %d", code)
+	}
+
+	hits := handler.RuleHits()
+	if hits["rate-limit:203.0.113.0/24"] != 2 {
+		t.Errorf("Expected 2 hits for the CIDR rate limit rule, got %v", hits)
+	}
+}
+
+func TestInvalidCIDRRateLimits(t *testing.T) {
+	tests := []struct {
+		limits   map[string]RateRule
+		testName string
+	}{
+		{map[string]RateRule{"203.0.113.0/33": {Requests: 1}}, "Invalid CIDR"},
+		{map[string]RateRule{"203.0.113.0/24": {Requests: 0}}, "Missing request count"},
+		{map[string]RateRule{"203.0.113.0/24": {Requests: 1, Period: -1}}, "Negative period"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.CIDRRateLimits = test.limits
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
+
+func TestRateLimitConcurrentBurst(t *testing.T) {
+	config := CreateConfig()
+	config.RateLimit = 10
+	config.RatePeriod = 60
+	config.WhitelistIPs = []string{"10.0.0.9"}
+	handler := newTestHandler(t, config)
+
+	var allowed, limited atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch requestFrom(handler, "10.0.0.1:12345") {
+			case http.StatusOK:
+				allowed.Add(1)
+			case http.StatusTooManyRequests:
+				limited.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != 10 || limited.Load() != 40 {
+		t.Errorf("Expected 10 allowed and 40 limited requests, got %d and %d", allowed.Load(), limited.Load())
+	}
+
+	for i := 0; i < 20; i++ {
+		if code := requestFrom(handler, "10.0.0.9:12345"); code != http.StatusOK {
+			t.Fatalf("Expected whitelisted IP to bypass the limiter, got %d", code)
+		}
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	config := CreateConfig()
+	config.RateLimit = 2
+	config.RatePeriod = 60
+	handler := newTestHandler(t, config)
+
+	requestFrom(handler, "10.0.0.1:12345")
+	requestFrom(handler, "10.0.0.1:12345")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	// Two tokens per minute refill one token every 30 seconds
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 29 || retryAfter > 30 {
+		t.Errorf("Expected Retry-After of about 30 seconds, got %q", w.Header().Get("Retry-After"))
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:12345"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Retry-After") != "" {
+		t.Errorf("Expected no Retry-After on allowed requests, got %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	limiter := newRateLimiter(2, 100*time.Millisecond, false)
+
+	limiter.allow("10.0.0.1", "/")
+	limiter.allow("10.0.0.1", "/")
+	if ok, wait := limiter.allow("10.0.0.1", "/"); ok || wait <= 0 || wait > 50*time.Millisecond {
+		t.Fatalf("Expected empty bucket to wait up to 50ms, got ok=%v wait=%s", ok, wait)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := limiter.allow("10.0.0.1", "/"); !ok {
+		t.Error("Expected a token to be refilled after half the period")
+	}
+	if ok, _ := limiter.allow("10.0.0.1", "/"); ok {
+		t.Error("Expected a single refilled token")
+	}
+}
+
+func TestRateLimitSweep(t *testing.T) {
+	limiter := newRateLimiter(5, 20*time.Millisecond, false)
+	limiter.allow("10.0.0.1", "/")
+	limiter.allow("10.0.0.2", "/")
+
+	time.Sleep(30 * time.Millisecond)
+	limiter.allow("10.0.0.2", "/")
+	limiter.sweep()
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if _, ok := limiter.buckets["10.0.0.1"]; ok {
+		t.Error("Expected idle bucket to be removed")
+	}
+	if _, ok := limiter.buckets["10.0.0.2"]; !ok {
+		t.Error("Expected active bucket to be kept")
+	}
+}
@@ -0,0 +1,43 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// parseRedirectURL checks that raw is an absolute http or https URL
+func parseRedirectURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid redirectURL %q", raw), err)
+	}
+	if !u.IsAbs() || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("redirectURL %q must be an absolute http or https URL", raw), nil)
+	}
+	return u.String(), nil
+}
+
+// redirectStatusCode returns the status code redirects are sent with. The
+// default 403 becomes 302; any other code must be a redirect status.
+func redirectStatusCode(code int) (int, error) {
+	if code == http.StatusForbidden {
+		return http.StatusFound, nil
+	}
+	if !isRedirectStatusCode(code) {
+		return 0, NewBlockIPError(ErrCodeInvalidStatusCode,
+			fmt.Sprintf("invalid status code: %d, must be 301, 302, 303, 307 or 308 when redirectURL is set", code), nil)
+	}
+	return code, nil
+}
+
+// isRedirectStatusCode checks if code is a 3xx status that redirects to its
+// Location header. 300, 304 and 305 don't, so browsers would not follow them.
+func isRedirectStatusCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectURL(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		expected   int
+		testName   string
+	}{
+		{403, http.StatusFound, "Default status code"},
+		{307, http.StatusTemporaryRedirect, "Configured 3xx"},
+		{308, http.StatusPermanentRedirect, "Permanent redirect"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.RedirectURL = "https://example.com/blocked?reason=ip"
+		config.StatusCode = test.statusCode
+		config.ResponseFormat = "json"
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != "https://example.com/blocked?reason=ip" {
+			t.Errorf("%s: expected Location header, got %q", test.testName, location)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("%s: expected no body, got %q", test.testName, w.Body.String())
+		}
+
+		if code := requestFrom(handler, "10.0.0.1:12345"); code != 200 {
+			t.Errorf("%s: expected allowed IP to pass, got %d", test.testName, code)
+		}
+	}
+}
+
+func TestRedirectURLKeepsRateLimitResponse(t *testing.T) {
+	config := CreateConfig()
+	config.RedirectURL = "https://example.com/blocked"
+	config.RateLimit = 1
+	config.RatePeriod = 60
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	requestFrom(handler, "10.0.0.1:12345")
+	if code := requestFrom(handler, "10.0.0.1:12345"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected rate limited requests to get 429, got %d", code)
+	}
+}
+
+func TestInvalidRedirectURL(t *testing.T) {
+	tests := []struct {
+		redirectURL string
+		statusCode  int
+		testName    string
+	}{
+		{"/blocked", 302, "Relative URL"},
+		{"ftp://example.com/blocked", 302, "Unsupported scheme"},
+		{"https://", 302, "Missing host"},
+		{"https://example.com/%zz", 302, "Malformed URL"},
+		{"https://example.com/blocked", 404, "Non-3xx status code"},
+		{"https://example.com/blocked", 200, "2xx status code"},
+		{"https://example.com/blocked", 304, "Not Modified"},
+		{"https://example.com/blocked", 300, "Multiple Choices"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.RedirectURL = test.redirectURL
+		config.StatusCode = test.statusCode
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+)
+
+// decidedContextKey marks requests an instance has already decided, so
+// requests re-entering the chain after an internal redirect or rewrite are
+// not evaluated and counted twice. Each instance has its own key.
+type decidedContextKey struct {
+	b *BlockIP
+}
+
+// isDecided reports whether b already decided req
+func (b *BlockIP) isDecided(req *http.Request) bool {
+	return req.Context().Value(decidedContextKey{b}) != nil
+}
+
+// markDecided returns req marked as decided by b
+func (b *BlockIP) markDecided(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), decidedContextKey{b}, true))
+}
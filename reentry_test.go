@@ -0,0 +1,81 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newReentrantHandler returns a plugin whose next handler rewrites requests
+// for /old to /new and sends them through the plugin again, like an
+// internal redirect
+func newReentrantHandler(t *testing.T, config *Config) *BlockIP {
+	t.Helper()
+
+	var b *BlockIP
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			r.URL.Path = "/new"
+			b.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	b = newTestHandlerWithNext(t, config, next)
+	return b
+}
+
+func TestReentrantRequests(t *testing.T) {
+	tests := []struct {
+		reevaluate bool
+		expected   int
+		requests   int64
+		testName   string
+	}{
+		{false, http.StatusOK, 1, "Decided once"},
+		{true, http.StatusTooManyRequests, 2, "Re-evaluated"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.BlockedIPs = []string{"192.168.1.100"}
+		config.RateLimit = 1
+		config.ReevaluateReentrantRequests = test.reevaluate
+		b := newReentrantHandler(t, config)
+
+		if code := requestPath(b, "10.0.0.1:12345", "/old"); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, code)
+		}
+		if requests := b.Metrics()["requests_total"]; requests != test.requests {
+			t.Errorf("%s: expected %d evaluations, got %d", test.testName, test.requests, requests)
+		}
+	}
+}
+
+func TestReentrantRequestsAcrossInstances(t *testing.T) {
+	inner, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), &Config{BlockedIPs: []string{"10.0.0.1"}, StatusCode: 403, Message: "Inner"}, "blockip-inner")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	outer, err := New(context.Background(), inner, config, "blockip-outer")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	// The outer instance's marker does not stop the inner one from deciding
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	w := httptest.NewRecorder()
+	outer.ServeHTTP(w, req)
+
+	if w.Code != 403 || w.Body.String() != "Inner" {
+		t.Errorf("Expected the inner instance to block, got %d %q", w.Code, w.Body.String())
+	}
+}
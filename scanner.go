@@ -0,0 +1,77 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// statusRecorder captures the status code written by the next handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records code before writing it
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the implicit 200 of a body written without a status
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush flushes the underlying writer when it supports flushing
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// newScannerDetector validates the scanner detection settings. Scanners
+// are counted like blocked attempts, with 4xx responses as the attempts.
+func newScannerDetector(max4xx int, window, duration time.Duration) (*autoBanner, error) {
+	if max4xx < 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("max4xxPerWindow must not be negative, got %d", max4xx), nil)
+	}
+	if window <= 0 || duration <= 0 {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "max4xxWindow and max4xxBanDuration must be positive when max4xxPerWindow is set", nil)
+	}
+	return &autoBanner{
+		attempts:  make(map[string][]int64),
+		threshold: max4xx,
+		window:    window,
+		duration:  duration,
+	}, nil
+}
+
+// serveDetectingScanners calls next and counts 4xx responses to clientIP,
+// banning it temporarily once it crosses max4xxPerWindow
+func (b *BlockIP) serveDetectingScanners(rw http.ResponseWriter, req *http.Request, clientIP string) {
+	recorder := &statusRecorder{ResponseWriter: rw}
+	b.next.ServeHTTP(recorder, req)
+
+	if recorder.status < 400 || recorder.status > 499 || !b.scanDetector.record(clientIP, time.Now()) {
+		return
+	}
+
+	if err := b.AddTemporaryBlock(clientIP, b.scanDetector.duration); err != nil {
+		b.logger.Warn("[%s] Error banning scanner IP %s: %v", b.name, clientIP, err)
+		return
+	}
+	b.stats.scannerBans.Add(1)
+	b.logger.Info("[%s] Banned IP %s for %s after more than %d 4xx responses within %s",
+		b.name, clientIP, b.scanDetector.duration, b.scanDetector.threshold, b.scanDetector.window)
+}
@@ -0,0 +1,111 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newScannerHandler(t *testing.T, max4xx int) *BlockIP {
+	config := CreateConfig()
+	config.WhitelistIPs = []string{"203.0.113.9"}
+	config.Max4xxPerWindow = max4xx
+
+	return newTestHandlerWithNext(t, config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte("ok"))
+		case "/private":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestScannerDetection(t *testing.T) {
+	b := newScannerHandler(t, 3)
+
+	for _, path := range []string{"/wp-login.php", "/.env", "/private"} {
+		if code := requestPath(b, "203.0.113.5:12345", path); code != 404 && code != 401 {
+			t.Fatalf("Expected %s to reach next, got %d", path, code)
+		}
+	}
+	if code := requestPath(b, "203.0.113.5:12345", "/"); code != 200 {
+		t.Errorf("Expected IP to be allowed at the threshold, got %d", code)
+	}
+
+	requestPath(b, "203.0.113.5:12345", "/.git/config")
+	if code := requestPath(b, "203.0.113.5:12345", "/"); code != 403 {
+		t.Errorf("Expected IP to be blocked after crossing the threshold, got %d", code)
+	}
+	if code := requestPath(b, "203.0.113.6:12345", "/"); code != 200 {
+		t.Errorf("Expected other IPs to be unaffected, got %d", code)
+	}
+	if bans := b.Stats()["scanner_bans"]; bans != 1 {
+		t.Errorf("Expected 1 scanner ban, got %d", bans)
+	}
+
+	// The block response itself is not a 4xx from next and bans no further
+	requestPath(b, "203.0.113.5:12345", "/missing")
+	if bans := b.Stats()["scanner_bans"]; bans != 1 {
+		t.Errorf("Expected blocked requests not to count, got %d scanner bans", bans)
+	}
+}
+
+func TestScannerDetectionIgnores(t *testing.T) {
+	b := newScannerHandler(t, 1)
+
+	for i := 0; i < 5; i++ {
+		requestPath(b, "203.0.113.5:12345", "/")
+		requestPath(b, "203.0.113.9:12345", "/missing")
+	}
+	if code := requestPath(b, "203.0.113.5:12345", "/"); code != 200 {
+		t.Errorf("Expected successful responses not to count, got %d", code)
+	}
+	if code := requestPath(b, "203.0.113.9:12345", "/"); code != 200 {
+		t.Errorf("Expected whitelisted IPs not to be banned, got %d", code)
+	}
+}
+
+func TestScannerDetectionPreservesResponse(t *testing.T) {
+	b := newScannerHandler(t, 5)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.5:12345"
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, req)
+
+	if w.Code != 200 || w.Body.String() != "ok" {
+		t.Errorf("Expected next's response to pass through, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestScannerDetectionConfig(t *testing.T) {
+	tests := []struct {
+		max4xx   int
+		window   int
+		duration int
+		testName string
+	}{
+		{-1, 60, 3600, "Negative threshold"},
+		{3, 0, 3600, "Zero window"},
+		{3, 60, 0, "Zero duration"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.Max4xxPerWindow = test.max4xx
+		config.Max4xxWindow = test.window
+		config.Max4xxBanDuration = test.duration
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", test.testName)
+		}
+	}
+}
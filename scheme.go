@@ -0,0 +1,54 @@
+package traefik_plugin_blockip
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ruleSchemePrefix identifies blocks of requests made over a blocked scheme
+const ruleSchemePrefix = "scheme:"
+
+// parseSchemes validates and normalizes the blocked schemes
+func parseSchemes(schemes []string) (map[string]bool, error) {
+	if len(schemes) == 0 {
+		return nil, nil
+	}
+
+	blocked := make(map[string]bool, len(schemes))
+	for _, scheme := range schemes {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme == "" {
+			return nil, NewBlockIPError(ErrCodeInvalidConfig, "blockedSchemes contains an empty scheme", nil)
+		}
+		blocked[scheme] = true
+	}
+	return blocked, nil
+}
+
+// requestScheme returns the effective scheme of req. X-Forwarded-Proto is
+// used when sent by a trusted proxy.
+func (b *BlockIP) requestScheme(req *http.Request) string {
+	if b.isTrustedProxy(remoteIP(req)) {
+		if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+		}
+	}
+
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// matchScheme returns the scheme rule req is blocked by, if any
+func (b *BlockIP) matchScheme(req *http.Request, clientIP string) (string, bool) {
+	scheme := b.requestScheme(req)
+	if !b.blockedSchemes[scheme] {
+		return "", false
+	}
+
+	if b.debug {
+		b.logger.Debug("[%s] Request from IP %s over blocked scheme %s", b.name, clientIP, scheme)
+	}
+	return ruleSchemePrefix + scheme, true
+}
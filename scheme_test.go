@@ -0,0 +1,69 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlockedSchemes(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedSchemes = []string{"HTTP"}
+	config.TrustedProxies = []string{"10.0.0.0/8"}
+	config.WhitelistIPs = []string{"192.168.1.10"}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr     string
+		tls            bool
+		forwardedProto string
+		expected       int
+		testName       string
+	}{
+		{"203.0.113.5:12345", false, "", 403, "Plain HTTP blocked"},
+		{"203.0.113.5:12345", true, "", 200, "HTTPS allowed for the same IP"},
+		{"10.0.0.1:12345", true, "http", 403, "Forwarded HTTP from trusted proxy"},
+		{"10.0.0.1:12345", false, "https", 200, "Forwarded HTTPS from trusted proxy"},
+		{"203.0.113.5:12345", false, "https", 403, "Forwarded proto ignored from untrusted peer"},
+		{"192.168.1.10:12345", false, "", 200, "Whitelisted IP"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if test.forwardedProto != "" {
+			req.Header.Set("X-Forwarded-Proto", test.forwardedProto)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.testName, test.expected, w.Code)
+		}
+	}
+}
+
+func TestInvalidBlockedScheme(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedSchemes = []string{" "}
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for empty scheme")
+	}
+}
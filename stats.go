@@ -0,0 +1,118 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// maxStatusCode bounds the status codes counted per block response
+const maxStatusCode = 599
+
+// pluginStats holds the plugin counters
+type pluginStats struct {
+	whitelistOverrides    atomic.Int64
+	temporaryBlocksPurged atomic.Int64
+	headerConflicts       atomic.Int64
+	candidateMismatches   atomic.Int64
+	autoBans              atomic.Int64
+	scannerBans           atomic.Int64
+	eventsDropped         atomic.Int64
+
+	// ruleHits maps each matched block rule to an *atomic.Int64
+	ruleHits sync.Map
+
+	// responses counts block responses by the status code served
+	responses [maxStatusCode + 1]atomic.Int64
+}
+
+// countResponse records a block response served with status
+func (s *pluginStats) countResponse(status int) {
+	if status >= 0 && status <= maxStatusCode {
+		s.responses[status].Add(1)
+	}
+}
+
+// countRuleHit records a match of a block rule
+func (s *pluginStats) countRuleHit(rule string) {
+	counter, ok := s.ruleHits.Load(rule)
+	if !ok {
+		counter, _ = s.ruleHits.LoadOrStore(rule, new(atomic.Int64))
+	}
+	counter.(*atomic.Int64).Add(1)
+}
+
+// RuleHits returns how many times each block rule has matched. Rules that
+// never matched are absent.
+func (b *BlockIP) RuleHits() map[string]int64 {
+	hits := make(map[string]int64)
+	b.stats.ruleHits.Range(func(rule, counter interface{}) bool {
+		hits[rule.(string)] = counter.(*atomic.Int64).Load()
+		return true
+	})
+	return hits
+}
+
+// RuleSources returns the list file, netset file or URL each matched block
+// rule was loaded from. Rules from the configuration are absent.
+func (b *BlockIP) RuleSources() map[string]string {
+	sources := make(map[string]string)
+	b.stats.ruleHits.Range(func(rule, _ interface{}) bool {
+		if source := b.ruleSource(rule.(string)); source != "" {
+			sources[rule.(string)] = source
+		}
+		return true
+	})
+	return sources
+}
+
+// Stats returns a snapshot of the plugin counters and list sizes
+func (b *BlockIP) Stats() map[string]int64 {
+	blocked, whitelist := b.lookup.familyCounts()
+
+	stats := map[string]int64{
+		"whitelist_overrides":     b.stats.whitelistOverrides.Load(),
+		"temporary_blocks_purged": b.stats.temporaryBlocksPurged.Load(),
+		"header_conflicts":        b.stats.headerConflicts.Load(),
+		"candidate_mismatches":    b.stats.candidateMismatches.Load(),
+		"auto_bans":               b.stats.autoBans.Load(),
+		"scanner_bans":            b.stats.scannerBans.Load(),
+		"events_dropped":          b.stats.eventsDropped.Load(),
+		"blocked_ipv4":            int64(blocked.ipv4),
+		"blocked_ipv6":            int64(blocked.ipv6),
+		"whitelist_ipv4":          int64(whitelist.ipv4),
+		"whitelist_ipv6":          int64(whitelist.ipv6),
+		"cache_shards":            int64(len(b.lookup.cache.shards)),
+		"cache_evictions":         b.lookup.cache.evictions.Load() + b.lookup.allowedCache.evictions.Load(),
+	}
+
+	for status := range b.stats.responses {
+		if count := b.stats.responses[status].Load(); count > 0 {
+			stats[fmt.Sprintf("responses_%d", status)] = count
+		}
+	}
+	return stats
+}
+
+// ResetStats zeroes the plugin counters and request metrics. Increments
+// racing with the reset land either before it or after it and are never
+// lost.
+func (b *BlockIP) ResetStats() {
+	b.stats.whitelistOverrides.Swap(0)
+	b.stats.temporaryBlocksPurged.Swap(0)
+	b.stats.headerConflicts.Swap(0)
+	b.stats.candidateMismatches.Swap(0)
+	b.stats.autoBans.Swap(0)
+	b.stats.scannerBans.Swap(0)
+	b.stats.eventsDropped.Swap(0)
+	b.lookup.cache.evictions.Swap(0)
+	b.lookup.allowedCache.evictions.Swap(0)
+	b.metrics.reset()
+	for status := range b.stats.responses {
+		b.stats.responses[status].Swap(0)
+	}
+	b.stats.ruleHits.Range(func(_, counter interface{}) bool {
+		counter.(*atomic.Int64).Swap(0)
+		return true
+	})
+}
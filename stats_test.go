@@ -0,0 +1,315 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureStdout returns everything written to stdout while f runs
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestWhitelistOverrideLogged(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"192.168.0.0/16"}
+	config.WhitelistIPs = []string{"192.168.1.50", "10.0.0.1"}
+	config.LogWhitelistOverrides = true
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	output := captureStdout(t, func() {
+		for _, remoteAddr := range []string{"192.168.1.50:12345", "192.168.1.50:12345", "10.0.0.1:12345"} {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = remoteAddr
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != 200 {
+				t.Errorf("Expected whitelisted IP %s to be allowed, got %d", remoteAddr, w.Code)
+			}
+		}
+	})
+
+	if strings.Count(output, "Whitelist override: IP 192.168.1.50 matched block rule 192.168.0.0/16") != 1 {
+		t.Errorf("Expected one override event, not repeated for the cached decision, got output: %q", output)
+	}
+	if strings.Contains(output, "10.0.0.1") {
+		t.Errorf("Expected no override event for an IP that is only whitelisted, got output: %q", output)
+	}
+
+	if overrides := handler.(*BlockIP).Stats()["whitelist_overrides"]; overrides != 1 {
+		t.Errorf("Expected 1 whitelist override, got %d", overrides)
+	}
+}
+
+func TestWhitelistOverrideDisabled(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WhitelistIPs = []string{"192.168.1.100"}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	output := captureStdout(t, func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	if strings.Contains(output, "Whitelist override") {
+		t.Errorf("Expected no override event when disabled, got output: %q", output)
+	}
+	if overrides := handler.(*BlockIP).Stats()["whitelist_overrides"]; overrides != 0 {
+		t.Errorf("Expected 0 whitelist overrides, got %d", overrides)
+	}
+}
+
+func TestResetStats(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WhitelistIPs = []string{"192.168.1.100"}
+	config.LogWhitelistOverrides = true
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	b := handler.(*BlockIP)
+
+	captureStdout(t, func() {
+		for i := 0; i < 3; i++ {
+			requestFrom(handler, "192.168.1.100:12345")
+			b.lookup.clearCache()
+		}
+	})
+
+	if overrides := b.Stats()["whitelist_overrides"]; overrides != 3 {
+		t.Fatalf("Expected 3 whitelist overrides, got %d", overrides)
+	}
+
+	b.ResetStats()
+
+	if overrides := b.Stats()["whitelist_overrides"]; overrides != 0 {
+		t.Errorf("Expected 0 whitelist overrides after reset, got %d", overrides)
+	}
+}
+
+func TestResetStatsMetrics(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WhitelistIPs = []string{"10.0.0.1"}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	b := handler.(*BlockIP)
+
+	for _, addr := range []string{"192.168.1.100:12345", "192.168.1.100:12345", "10.0.0.1:12345", "10.0.0.2:12345"} {
+		requestFrom(handler, addr)
+	}
+	b.metrics.wouldBlock.Add(1)
+
+	for name, value := range b.Metrics() {
+		if value == 0 {
+			t.Fatalf("Expected %s to be counted before the reset", name)
+		}
+	}
+
+	b.ResetStats()
+
+	for name, value := range b.Metrics() {
+		if value != 0 {
+			t.Errorf("Expected %s to be 0 after reset, got %d", name, value)
+		}
+	}
+}
+
+func TestResetStatsConcurrent(t *testing.T) {
+	b := &BlockIP{lookup: newIPLookupService(0, 0, 0, 0)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b.stats.whitelistOverrides.Add(1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b.ResetStats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	b.ResetStats()
+	if overrides := b.Stats()["whitelist_overrides"]; overrides != 0 {
+		t.Errorf("Expected 0 whitelist overrides after reset, got %d", overrides)
+	}
+
+	b.stats.whitelistOverrides.Add(1)
+	if overrides := b.Stats()["whitelist_overrides"]; overrides != 1 {
+		t.Errorf("Expected counting to resume after reset, got %d", overrides)
+	}
+}
+
+func TestRuleHits(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100", "192.168.1.101"}
+	config.BlockedCIDRs = []string{"10.0.0.0/8", "172.16.0.0/12"}
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	b := handler.(*BlockIP)
+
+	for _, remoteAddr := range []string{
+		"192.168.1.100:12345",
+		"192.168.1.100:12345",
+		"10.1.1.1:12345",
+		"10.2.2.2:12345",
+		"10.3.3.3:12345",
+		"8.8.8.8:12345",
+	} {
+		requestFrom(handler, remoteAddr)
+	}
+
+	hits := b.RuleHits()
+	expected := map[string]int64{
+		"192.168.1.100": 2,
+		"10.0.0.0/8":    3,
+	}
+
+	if len(hits) != len(expected) {
+		t.Errorf("Expected hits for %d rules, got %v", len(expected), hits)
+	}
+	for rule, count := range expected {
+		if hits[rule] != count {
+			t.Errorf("Expected %d hits for %s, got %d", count, rule, hits[rule])
+		}
+	}
+
+	b.ResetStats()
+	for rule, count := range b.RuleHits() {
+		if count != 0 {
+			t.Errorf("Expected %s hits to be 0 after reset, got %d", rule, count)
+		}
+	}
+}
+
+func TestRuleHitsConcurrent(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"10.0.0.0/8"}
+	config.CacheTTL = 0
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				requestFrom(handler, "10.0.0.1:12345")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if hits := handler.(*BlockIP).RuleHits()["10.0.0.0/8"]; hits != 800 {
+		t.Errorf("Expected 800 hits, got %d", hits)
+	}
+}
+
+func TestResponseStatusBreakdown(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.ListGroups = []ListGroup{{Name: "legal", BlockedIPs: []string{"198.51.100.7"}, StatusCode: 451}}
+	config.RateLimit = 1
+	config.AdminPath = "/_blockip"
+	config.AdminToken = "secret"
+
+	handler, _ := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	for _, remoteAddr := range []string{
+		"192.168.1.100:12345",
+		"192.168.1.100:12345",
+		"198.51.100.7:12345",
+		"8.8.8.8:12345",
+		"8.8.8.8:12345",
+		"8.8.8.8:12345",
+	} {
+		requestFrom(handler, remoteAddr)
+	}
+
+	expected := map[string]int64{
+		"responses_403": 2,
+		"responses_451": 1,
+		"responses_429": 2,
+	}
+
+	stats := handler.(*BlockIP).Stats()
+	for name, count := range expected {
+		if stats[name] != count {
+			t.Errorf("Expected %s to be %d, got %d", name, count, stats[name])
+		}
+	}
+	if _, ok := stats["responses_200"]; ok {
+		t.Error("Expected allowed requests not to be counted as block responses")
+	}
+
+	req := httptest.NewRequest("GET", "/_blockip/stats", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var served map[string]int64
+	if err := json.NewDecoder(w.Body).Decode(&served); err != nil {
+		t.Fatalf("Invalid stats response: %v", err)
+	}
+	for name, count := range expected {
+		if served[name] != count {
+			t.Errorf("Expected stats endpoint %s to be %d, got %d", name, count, served[name])
+		}
+	}
+
+	handler.(*BlockIP).ResetStats()
+	if count := handler.(*BlockIP).Stats()["responses_403"]; count != 0 {
+		t.Errorf("Expected responses_403 to be reset, got %d", count)
+	}
+}
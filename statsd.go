@@ -0,0 +1,109 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// statsdQueueSize bounds the metrics waiting to be sent; further metrics
+// are dropped so requests never wait on StatsD
+const statsdQueueSize = 1024
+
+// statsdClient sends counters and gauges to a StatsD server over UDP
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+	queue  chan string
+}
+
+// newStatsDClient connects to the StatsD server at address
+func newStatsDClient(address string, prefix string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid statsDAddress %q", address), err)
+	}
+	return &statsdClient{
+		conn:   conn,
+		prefix: prefix,
+		queue:  make(chan string, statsdQueueSize),
+	}, nil
+}
+
+// count increments the counter name by one
+func (c *statsdClient) count(name string) {
+	c.enqueue(fmt.Sprintf("%s:1|c", c.metric(name)))
+}
+
+// gauge sets the gauge name to value
+func (c *statsdClient) gauge(name string, value int64) {
+	c.enqueue(fmt.Sprintf("%s:%d|g", c.metric(name), value))
+}
+
+// metric returns name with the configured prefix
+func (c *statsdClient) metric(name string) string {
+	if c.prefix == "" {
+		return name
+	}
+	return c.prefix + "." + name
+}
+
+// enqueue queues a metric for sending, dropping it when the queue is full
+func (c *statsdClient) enqueue(metric string) {
+	select {
+	case c.queue <- metric:
+	default:
+	}
+}
+
+// run sends queued metrics until ctx is done. Send errors are ignored.
+func (c *statsdClient) run(ctx context.Context) {
+	defer c.conn.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case metric := <-c.queue:
+			_, _ = c.conn.Write([]byte(metric))
+		}
+	}
+}
+
+// emitStatsDGauges sends every value of Stats as a gauge each interval
+// until ctx is done
+func (b *BlockIP) emitStatsDGauges(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for name, value := range b.Stats() {
+				b.statsd.gauge(name, value)
+			}
+		}
+	}
+}
+
+// startStatsD connects to the StatsD server and starts the sender and the
+// periodic gauge emitter
+func (b *BlockIP) startStatsD(ctx context.Context, config *Config) error {
+	interval, err := resolveDuration("statsDIntervalDuration", config.StatsDIntervalDuration, config.StatsDInterval, time.Second)
+	if err != nil {
+		return err
+	}
+
+	if b.statsd, err = newStatsDClient(config.StatsDAddress, config.StatsDPrefix); err != nil {
+		return err
+	}
+
+	go b.statsd.run(ctx)
+	if interval > 0 {
+		go b.emitStatsDGauges(ctx, interval)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenStatsD starts a UDP listener collecting received packets
+func listenStatsD(t *testing.T) (string, <-chan string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	packets := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			packets <- string(buf[:n])
+		}
+	}()
+	return conn.LocalAddr().String(), packets
+}
+
+// waitForPacket returns the first packet containing want
+func waitForPacket(t *testing.T, packets <-chan string, want string) string {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case packet := <-packets:
+			if strings.Contains(packet, want) {
+				return packet
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for StatsD packet %q", want)
+			return ""
+		}
+	}
+}
+
+func TestStatsDDecisionCounters(t *testing.T) {
+	address, packets := listenStatsD(t)
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.StatsDAddress = address
+	config.StatsDInterval = 0
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	defer handler.(*BlockIP).Stop()
+
+	requestFrom(handler, "192.168.1.100:12345")
+	if packet := waitForPacket(t, packets, "blocked"); packet != "blockip.decisions.blocked:1|c" {
+		t.Errorf("Unexpected blocked counter packet %q", packet)
+	}
+
+	requestFrom(handler, "8.8.8.8:12345")
+	if packet := waitForPacket(t, packets, "allowed"); packet != "blockip.decisions.allowed:1|c" {
+		t.Errorf("Unexpected allowed counter packet %q", packet)
+	}
+}
+
+func TestStatsDGauges(t *testing.T) {
+	address, packets := listenStatsD(t)
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100", "192.168.1.101"}
+	config.StatsDAddress = address
+	config.StatsDPrefix = "edge"
+	config.StatsDIntervalDuration = "20ms"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	defer handler.(*BlockIP).Stop()
+
+	if packet := waitForPacket(t, packets, "blocked_ipv4"); packet != "edge.blocked_ipv4:2|g" {
+		t.Errorf("Unexpected gauge packet %q", packet)
+	}
+}
+
+func TestStatsDQueueFullDoesNotBlock(t *testing.T) {
+	client := &statsdClient{prefix: "blockip", queue: make(chan string, 1)}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			client.count("decisions.allowed")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected metrics to be dropped when the queue is full")
+	}
+}
+
+func TestInvalidStatsDAddress(t *testing.T) {
+	config := CreateConfig()
+	config.StatsDAddress = "missing-port"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid StatsD address")
+	}
+}
@@ -0,0 +1,124 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
+)
+
+// ruleTemporaryBlock identifies decisions made by a temporary block
+const ruleTemporaryBlock = "temporary-block"
+
+// AddTemporaryBlock blocks ip until ttl has elapsed. Expired blocks are
+// removed by the background sweep.
+func (b *BlockIP) AddTemporaryBlock(ip string, ttl time.Duration) error {
+	ip = ipsanitize.Clean(ip)
+	if !isValidIP(ip) {
+		return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid IP format: %s", ip), nil)
+	}
+	if ttl <= 0 {
+		return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid temporary block duration: %s", ttl), nil)
+	}
+	ip = canonicalIP(ip)
+
+	b.lookup.addTemporaryBlock(ip, time.Now().Add(ttl))
+	if b.cacheTemporaryBlocks {
+		// A decision cached before the block would otherwise outlive it
+		b.lookup.forgetCached(ip)
+	}
+
+	if b.debug {
+		b.logger.Debug("[%s] Temporarily blocked IP %s for %s", b.name, ip, ttl)
+	}
+	return nil
+}
+
+// addTemporaryBlock blocks ip until expires
+func (s *ipLookupService) addTemporaryBlock(ip string, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tempBlocks[ip] = expires.UnixNano()
+}
+
+// loadTemporaryBlocks adds the configured "<ip>=<seconds>" temporary blocks
+func (b *BlockIP) loadTemporaryBlocks(entries []string) error {
+	for _, entry := range entries {
+		ip, seconds, ok := strings.Cut(entry, "=")
+		ttl, err := strconv.Atoi(strings.TrimSpace(seconds))
+		if !ok || err != nil {
+			return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid temporaryBlocks entry %q, expected <ip>=<seconds>", entry), err)
+		}
+		if err := b.AddTemporaryBlock(strings.TrimSpace(ip), time.Duration(ttl)*time.Second); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// temporaryBlockRemaining returns how long the temporary block of ip
+// lasts, removing the block once it has expired
+func (s *ipLookupService) temporaryBlockRemaining(ip string) (time.Duration, bool) {
+	s.mu.RLock()
+	expires, ok := s.tempBlocks[ip]
+	s.mu.RUnlock()
+
+	if !ok {
+		return 0, false
+	}
+	now := time.Now().UnixNano()
+	if now < expires {
+		return time.Duration(expires - now), true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A new block may have been added since the read lock was released
+	if expires, ok := s.tempBlocks[ip]; ok && now >= expires {
+		delete(s.tempBlocks, ip)
+	}
+	return 0, false
+}
+
+// purgeTemporaryBlocks removes expired temporary blocks and returns how
+// many were removed
+func (s *ipLookupService) purgeTemporaryBlocks() int {
+	now := time.Now().UnixNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for ip, expires := range s.tempBlocks {
+		if now >= expires {
+			delete(s.tempBlocks, ip)
+			purged++
+		}
+	}
+	return purged
+}
+
+// sweepTemporaryBlocks periodically purges expired temporary blocks until
+// ctx is done
+func (b *BlockIP) sweepTemporaryBlocks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if purged := b.lookup.purgeTemporaryBlocks(); purged > 0 {
+				b.stats.temporaryBlocksPurged.Add(int64(purged))
+				if b.debug {
+					b.logger.Debug("[%s] Purged %d expired temporary blocks", b.name, purged)
+				}
+			}
+		}
+	}
+}
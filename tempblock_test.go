@@ -0,0 +1,240 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTemporaryBlock(t *testing.T) {
+	config := CreateConfig()
+	config.WhitelistIPs = []string{"10.0.0.2"}
+	b := newTestHandler(t, config)
+
+	if err := b.AddTemporaryBlock("10.0.0.1", 50*time.Millisecond); err != nil {
+		t.Fatalf("Failed to add temporary block: %v", err)
+	}
+	if err := b.AddTemporaryBlock("10.0.0.2", time.Minute); err != nil {
+		t.Fatalf("Failed to add temporary block: %v", err)
+	}
+
+	if code := requestFrom(b, "10.0.0.1:12345"); code != 403 {
+		t.Errorf("Expected temporarily blocked IP to be blocked, got %d", code)
+	}
+	if code := requestFrom(b, "10.0.0.2:12345"); code != 200 {
+		t.Errorf("Expected whitelisted IP to bypass the temporary block, got %d", code)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if code := requestFrom(b, "10.0.0.1:12345"); code != 200 {
+		t.Errorf("Expected IP to be allowed after the block expired, got %d", code)
+	}
+}
+
+func TestTemporaryBlockInvalid(t *testing.T) {
+	b := newTestHandler(t, CreateConfig())
+
+	tests := []struct {
+		ip       string
+		ttl      time.Duration
+		testName string
+	}{
+		{"not-an-ip", time.Minute, "Invalid IP"},
+		{"10.0.0.1", 0, "Zero duration"},
+		{"10.0.0.1", -time.Second, "Negative duration"},
+	}
+
+	for _, test := range tests {
+		if err := b.AddTemporaryBlock(test.ip, test.ttl); err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
+
+func TestTemporaryBlockSweep(t *testing.T) {
+	config := CreateConfig()
+	config.TemporaryBlockSweepIntervalDuration = "10ms"
+	b := newTestHandler(t, config)
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if err := b.AddTemporaryBlock(ip, 20*time.Millisecond); err != nil {
+			t.Fatalf("Failed to add temporary block: %v", err)
+		}
+	}
+	if err := b.AddTemporaryBlock("10.0.0.4", time.Minute); err != nil {
+		t.Fatalf("Failed to add temporary block: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats()["temporary_blocks_purged"] < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 purged temporary blocks, got %d", b.Stats()["temporary_blocks_purged"])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if purged := b.Stats()["temporary_blocks_purged"]; purged != 3 {
+		t.Errorf("Expected the unexpired block to be kept, got %d purged", purged)
+	}
+	if code := requestFrom(b, "10.0.0.4:12345"); code != 403 {
+		t.Errorf("Expected unexpired temporary block to remain, got %d", code)
+	}
+}
+
+func TestTemporaryBlocksConfig(t *testing.T) {
+	config := CreateConfig()
+	config.TemporaryBlocks = []string{"10.0.0.1=3600", " 2001:db8::1 = 60 "}
+	b := newTestHandler(t, config)
+
+	if code := requestFrom(b, "10.0.0.1:12345"); code != 403 {
+		t.Errorf("Expected configured temporary block, got %d", code)
+	}
+	if code := requestFrom(b, "[2001:db8::1]:12345"); code != 403 {
+		t.Errorf("Expected configured IPv6 temporary block, got %d", code)
+	}
+	if code := requestFrom(b, "10.0.0.2:12345"); code != 200 {
+		t.Errorf("Expected unlisted IP to be allowed, got %d", code)
+	}
+
+	for _, entry := range []string{"10.0.0.1", "10.0.0.1=", "10.0.0.1=abc", "10.0.0.1=0", "not-an-ip=60"} {
+		config := CreateConfig()
+		config.TemporaryBlocks = []string{entry}
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("Expected error for temporaryBlocks entry %q", entry)
+		}
+	}
+}
+
+func TestTemporaryBlockPurgedOnLookup(t *testing.T) {
+	config := CreateConfig()
+	config.TemporaryBlockSweepInterval = 0
+	b := newTestHandler(t, config)
+
+	if err := b.AddTemporaryBlock("10.0.0.1", 20*time.Millisecond); err != nil {
+		t.Fatalf("Failed to add temporary block: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if code := requestFrom(b, "10.0.0.1:12345"); code != 200 {
+		t.Errorf("Expected expired temporary block to allow the IP, got %d", code)
+	}
+
+	b.lookup.mu.RLock()
+	_, ok := b.lookup.tempBlocks["10.0.0.1"]
+	b.lookup.mu.RUnlock()
+	if ok {
+		t.Error("Expected the expired temporary block to be purged by the lookup")
+	}
+}
+
+func TestTemporaryBlockRetryAfter(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	b := newTestHandler(t, config)
+
+	if err := b.AddTemporaryBlock("10.0.0.1", 90*time.Second); err != nil {
+		t.Fatalf("Failed to add temporary block: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		min, max   int
+		testName   string
+	}{
+		{"10.0.0.1:12345", 89, 90, "Temporary block"},
+		{"192.168.1.100:12345", 0, 0, "Permanent block"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", test.testName, w.Code)
+		}
+		header := w.Header().Get("Retry-After")
+		if test.max == 0 {
+			if header != "" {
+				t.Errorf("%s: expected no Retry-After, got %q", test.testName, header)
+			}
+			continue
+		}
+		if seconds, err := strconv.Atoi(header); err != nil || seconds < test.min || seconds > test.max {
+			t.Errorf("%s: expected Retry-After between %d and %d, got %q", test.testName, test.min, test.max, header)
+		}
+	}
+}
+
+func TestAutoBanRetryAfter(t *testing.T) {
+	config := CreateConfig()
+	config.PathRules = []PathRule{{Paths: []string{"/admin"}, BlockedIPs: []string{"10.0.0.1"}}}
+	config.AutoBanThreshold = 1
+	config.AutoBanDuration = 600
+	b := newTestHandler(t, config)
+
+	requestPath(b, "10.0.0.1:12345", "/admin")
+	requestPath(b, "10.0.0.1:12345", "/admin")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, req)
+
+	if seconds, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || seconds < 599 || seconds > 600 {
+		t.Errorf("Expected Retry-After of the auto-ban duration, got %q (status %d)", w.Header().Get("Retry-After"), w.Code)
+	}
+}
+
+func TestCachedTemporaryBlockRetryAfter(t *testing.T) {
+	config := CreateConfig()
+	config.CacheTemporaryBlocks = true
+	b := newTestHandler(t, config)
+
+	// An allowed decision cached before the block must not outlive it
+	if code := requestFrom(b, "10.0.0.1:12345"); code != http.StatusOK {
+		t.Fatalf("Expected 200 before the block, got %d", code)
+	}
+	if err := b.AddTemporaryBlock("10.0.0.1", 300*time.Millisecond); err != nil {
+		t.Fatalf("Failed to add temporary block: %v", err)
+	}
+
+	first := b.decide(context.Background(), "10.0.0.1")
+	hits := b.Metrics()["cache_hits_total"]
+	time.Sleep(20 * time.Millisecond)
+	second := b.decide(context.Background(), "10.0.0.1")
+
+	if first.status != statusBlocked || second.status != statusBlocked || second.rule != ruleTemporaryBlock {
+		t.Fatalf("Expected temporary blocks, got %+v and %+v", first, second)
+	}
+	if b.Metrics()["cache_hits_total"] != hits+1 {
+		t.Errorf("Expected the second decision to be served from the cache")
+	}
+	if second.retryAfter <= 0 || second.retryAfter >= first.retryAfter-15*time.Millisecond {
+		t.Errorf("Expected Retry-After to decrease from %s, got %s", first.retryAfter, second.retryAfter)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 403 with Retry-After 1, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// The cached block expires with the block, not the cache TTL
+	time.Sleep(300 * time.Millisecond)
+	if code := requestFrom(b, "10.0.0.1:12345"); code != http.StatusOK {
+		t.Errorf("Expected 200 once the block expired, got %d", code)
+	}
+}
@@ -0,0 +1,123 @@
+package traefik_plugin_blockip
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultTemplateContentType is sent with templated responses by default
+const defaultTemplateContentType = "application/json"
+
+// htmlTemplateContentType is sent with responseTemplateFile pages
+const htmlTemplateContentType = "text/html; charset=utf-8"
+
+// ResponseData is the data a response template is rendered with
+type ResponseData struct {
+	ClientIP   string
+	Rule       string
+	Group      string
+	StatusCode int
+	Message    string
+	Method     string
+	Host       string
+	Path       string
+	Time       time.Time
+}
+
+// templateExecutor is satisfied by both text/template and html/template
+type templateExecutor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// responseTemplate renders block response bodies
+type responseTemplate struct {
+	tmpl        templateExecutor
+	contentType string
+	isJSON      bool
+}
+
+// templateFuncs are the helpers available to response templates. json
+// encodes a value as JSON, e.g. {"ip": {{json .ClientIP}}}.
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// parseResponseTemplate parses the response template and checks that it
+// renders valid JSON when the content type is JSON
+func parseResponseTemplate(text string, contentType string) (*responseTemplate, error) {
+	if contentType == "" {
+		contentType = defaultTemplateContentType
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid responseContentType %q", contentType), err)
+	}
+
+	tmpl, err := template.New("response").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "invalid responseTemplate", err)
+	}
+
+	rt := &responseTemplate{
+		tmpl:        tmpl,
+		contentType: contentType,
+		isJSON:      mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"),
+	}
+	if err := rt.check(); err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, "responseTemplate does not render", err)
+	}
+	return rt, nil
+}
+
+// loadResponseTemplateFile parses the HTML block page at path. Values are
+// escaped for HTML by html/template.
+func loadResponseTemplateFile(path string) (*responseTemplate, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("cannot read responseTemplateFile %s", path), err)
+	}
+
+	tmpl, err := htmltemplate.New("response").Funcs(htmltemplate.FuncMap(templateFuncs)).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid responseTemplateFile %s", path), err)
+	}
+
+	rt := &responseTemplate{tmpl: tmpl, contentType: htmlTemplateContentType}
+	if err := rt.check(); err != nil {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("responseTemplateFile %s does not render", path), err)
+	}
+	return rt, nil
+}
+
+// check renders the template with sample data
+func (rt *responseTemplate) check() error {
+	sample := ResponseData{ClientIP: "203.0.113.5", Rule: "203.0.113.0/24", StatusCode: http.StatusForbidden,
+		Message: "Access Denied", Method: http.MethodGet, Host: "example.com", Path: "/", Time: time.Now()}
+	_, err := rt.render(sample)
+	return err
+}
+
+// render executes the template, rejecting output that is not valid JSON
+// when the content type is JSON
+func (rt *responseTemplate) render(data ResponseData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := rt.tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	if rt.isJSON && !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("rendered response is not valid JSON: %q", buf.String())
+	}
+	return buf.Bytes(), nil
+}
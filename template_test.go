@@ -0,0 +1,172 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseTemplate(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"203.0.113.0/24"}
+	config.ResponseTemplate = `{"ip": {{json .ClientIP}}, "rule": {{json .Rule}}, "status": {{.StatusCode}}, "path": {{json .Path}}}`
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", `/admin"/panel`, nil)
+	req.RemoteAddr = "203.0.113.5:12345"
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 403 {
+		t.Errorf("Expected 403, got %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", contentType)
+	}
+
+	var body struct {
+		IP     string `json:"ip"`
+		Rule   string `json:"rule"`
+		Status int    `json:"status"`
+		Path   string `json:"path"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected valid JSON body, got %q: %v", w.Body.String(), err)
+	}
+	if body.IP != "203.0.113.5" || body.Rule != "203.0.113.0/24" || body.Status != 403 || body.Path != `/admin"/panel` {
+		t.Errorf("Unexpected rendered body %+v", body)
+	}
+}
+
+func TestResponseTemplateCustomContentType(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.ResponseTemplate = "blocked {{.ClientIP}}"
+	config.ResponseContentType = "text/plain; charset=utf-8"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.1.100:12345"
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Body.String() != "blocked 192.168.1.100" {
+		t.Errorf("Expected rendered text body, got %q", w.Body.String())
+	}
+}
+
+func TestInvalidResponseTemplate(t *testing.T) {
+	tests := []struct {
+		template    string
+		contentType string
+		testName    string
+	}{
+		{`{"ip": {{.ClientIP}`, "", "Unparsable template"},
+		{`{"ip": {{.ClientIP}}}`, "", "Renders invalid JSON"},
+		{`{"ip": {{json .Missing}}}`, "", "Unknown field"},
+		{`{}`, "not a type;;", "Invalid content type"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.ResponseTemplate = test.template
+		config.ResponseContentType = test.contentType
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
+
+func TestResponseTemplateFile(t *testing.T) {
+	path := writeListFile(t, `<html><body><h1>{{.StatusCode}} {{.Message}}</h1><p>Your IP {{.ClientIP}} is blocked.</p>`+
+		`{{if eq .Path "/broken"}}{{.Missing}}{{end}}<p>{{.Path}}</p></body></html>`)
+
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"203.0.113.0/24"}
+	config.ResponseTemplateFile = path
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/<script>", nil)
+	req.RemoteAddr = "203.0.113.5:12345"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 403 {
+		t.Errorf("Expected 403, got %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Expected HTML content type, got %q", contentType)
+	}
+	expected := `<html><body><h1>403 Access Denied</h1><p>Your IP 203.0.113.5 is blocked.</p><p>/&lt;script&gt;</p></body></html>`
+	if w.Body.String() != expected {
+		t.Errorf("Expected escaped HTML page %q, got %q", expected, w.Body.String())
+	}
+
+	// Execution errors fall back to the plain message
+	req = httptest.NewRequest("GET", "/broken", nil)
+	req.RemoteAddr = "203.0.113.5:12345"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 403 || w.Body.String() != "Access Denied" {
+		t.Errorf("Expected plain 403 fallback, got %d %q", w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType == "text/html; charset=utf-8" {
+		t.Errorf("Expected the plain content type on fallback, got %q", contentType)
+	}
+}
+
+func TestInvalidResponseTemplateFile(t *testing.T) {
+	tests := []struct {
+		path     string
+		template string
+		testName string
+	}{
+		{writeListFile(t, `<p>{{.ClientIP</p>`), "", "Unparsable template"},
+		{writeListFile(t, `<p>{{.Missing}}</p>`), "", "Unknown field"},
+		{"/nonexistent/block.html", "", "Missing file"},
+		{writeListFile(t, `<p>{{.ClientIP}}</p>`), "blocked {{.ClientIP}}", "Both templates set"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig()
+		config.ResponseTemplateFile = test.path
+		config.ResponseTemplate = test.template
+		config.ResponseContentType = "text/plain"
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+
+		if err == nil {
+			t.Errorf("%s: expected error but got none", test.testName)
+		}
+	}
+}
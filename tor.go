@@ -0,0 +1,108 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ruleTorExit identifies decisions made by the Tor exit node list
+const ruleTorExit = "tor-exit"
+
+// torFetchTimeout bounds a single download of the Tor exit list
+const torFetchTimeout = 30 * time.Second
+
+// torExitList is the set of known Tor exit node IPs, swapped atomically
+// on every successful refresh
+type torExitList struct {
+	file string
+	url  string
+	ips  atomic.Value // map[string]bool
+}
+
+// contains checks if ip is a known Tor exit node
+func (l *torExitList) contains(ip string) bool {
+	ips, _ := l.ips.Load().(map[string]bool)
+	return ips[ip]
+}
+
+// loadTorExits loads the Tor exit list from its file or URL. Both the bulk
+// exit list (one IP per line) and the exit-addresses format are accepted.
+func (b *BlockIP) loadTorExits(ctx context.Context) error {
+	ips := make(map[string]bool)
+	add := func(entry string) error {
+		fields := strings.Fields(entry)
+		if len(fields) >= 2 && fields[0] == "ExitAddress" {
+			entry = fields[1]
+		} else if len(fields) != 1 {
+			return nil
+		}
+		if !isValidIP(entry) {
+			return fmt.Errorf("invalid IP format: %s", entry)
+		}
+		ips[canonicalIP(entry)] = true
+		return nil
+	}
+
+	var err error
+	if b.torExits.url != "" {
+		err = b.fetchTorExits(ctx, add)
+	} else {
+		_, err = b.loadListFile(b.torExits.file, add)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.torExits.ips.Store(ips)
+	b.lookup.clearCache()
+	if b.debug {
+		b.logger.Debug("[%s] Loaded %d Tor exit nodes", b.name, len(ips))
+	}
+	return nil
+}
+
+// fetchTorExits downloads the Tor exit list from its URL
+func (b *BlockIP) fetchTorExits(ctx context.Context, add func(entry string) error) error {
+	ctx, cancel := context.WithTimeout(ctx, torFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.torExits.url, nil)
+	if err != nil {
+		return NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid Tor exit list URL %s", b.torExits.url), err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return NewBlockIPError(ErrCodeInternalError, "cannot fetch Tor exit list", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return NewBlockIPError(ErrCodeInternalError, fmt.Sprintf("cannot fetch Tor exit list: status %d", resp.StatusCode), nil)
+	}
+
+	_, err = b.scanList(resp.Body, b.torExits.url, add)
+	return err
+}
+
+// refreshTorExits reloads the Tor exit list every interval until ctx is
+// done. A failed refresh keeps the previous list.
+func (b *BlockIP) refreshTorExits(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.loadTorExits(ctx); err != nil {
+				b.logger.Error("[%s] Error refreshing Tor exit list: %v", b.name, err)
+			}
+		}
+	}
+}
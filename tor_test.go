@@ -0,0 +1,113 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+const sampleTorExitAddresses = `ExitNode 0011BD2485AD45D984EC4159C88FC066E5E3300E
+Published 2024-05-01 12:00:00
+LastStatus 2024-05-01 13:00:00
+ExitAddress 203.0.113.10 2024-05-01 13:05:00
+ExitNode 0111BA9B604669E636FFD5B503F382A4B7AD6E80
+Published 2024-05-01 11:00:00
+LastStatus 2024-05-01 12:00:00
+ExitAddress 203.0.113.11 2024-05-01 12:10:00
+`
+
+func TestTorExitListFile(t *testing.T) {
+	config := CreateConfig()
+	config.TorExitListFile = writeListFile(t, "# bulk exit list\n198.51.100.20\n198.51.100.21\n")
+	config.WhitelistIPs = []string{"198.51.100.21"}
+	config.BlockTorExits = true
+	handler := newTestHandler(t, config)
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+		testName   string
+	}{
+		{"198.51.100.20:12345", 403, "Exit node blocked"},
+		{"198.51.100.21:12345", 200, "Whitelisted exit node"},
+		{"198.51.100.22:12345", 200, "Regular client"},
+	}
+
+	for _, test := range tests {
+		if code := requestFrom(handler, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.testName, test.expected, code)
+		}
+	}
+}
+
+func TestTorExitListURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sampleTorExitAddresses)
+	}))
+	defer server.Close()
+
+	config := CreateConfig()
+	config.TorExitListURL = server.URL
+	config.BlockTorExits = true
+	handler := newTestHandler(t, config)
+
+	for _, remoteAddr := range []string{"203.0.113.10:12345", "203.0.113.11:12345"} {
+		if code := requestFrom(handler, remoteAddr); code != 403 {
+			t.Errorf("Expected exit address %s to be blocked, got %d", remoteAddr, code)
+		}
+	}
+	if code := requestFrom(handler, "203.0.113.12:12345"); code != 200 {
+		t.Errorf("Expected non-exit address to be allowed, got %d", code)
+	}
+}
+
+func TestTorExitListRefresh(t *testing.T) {
+	path := writeListFile(t, "198.51.100.20\n")
+
+	config := CreateConfig()
+	config.TorExitListFile = path
+	config.TorExitRefreshIntervalDuration = "10ms"
+	config.BlockTorExits = true
+	handler := newTestHandler(t, config)
+
+	// Cache both decisions so the refresh has to drop them
+	if code := requestFrom(handler, "198.51.100.20:12345"); code != 403 {
+		t.Fatalf("Expected exit node to be blocked, got %d", code)
+	}
+	if code := requestFrom(handler, "198.51.100.30:12345"); code != 200 {
+		t.Fatalf("Expected regular client to be allowed, got %d", code)
+	}
+
+	if err := os.WriteFile(path, []byte("198.51.100.30\n"), 0o644); err != nil {
+		t.Fatalf("Failed to update list file: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for requestFrom(handler, "198.51.100.30:12345") != 403 {
+		if time.Now().After(deadline) {
+			t.Fatal("Refreshed exit node was never blocked")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if code := requestFrom(handler, "198.51.100.20:12345"); code != 200 {
+		t.Errorf("Expected removed exit node to be allowed, got %d", code)
+	}
+}
+
+func TestTorExitListRequiresSource(t *testing.T) {
+	config := CreateConfig()
+	config.BlockTorExits = true
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error when no Tor exit list source is configured")
+	}
+}
@@ -0,0 +1,105 @@
+package traefik_plugin_blockip
+
+import "net"
+
+// trieNode is a node of a binary prefix trie. net is set on nodes that end
+// an indexed network; rules is set when that network was merged from
+// several configured ones.
+type trieNode struct {
+	children [2]*trieNode
+	net      *net.IPNet
+	rules    *cidrTrie
+}
+
+// cidrTrie indexes networks by prefix, with separate tries for IPv4 and
+// IPv6, so a lookup walks at most the address length instead of every
+// network
+type cidrTrie struct {
+	v4 *trieNode
+	v6 *trieNode
+
+	networks int // merged networks indexed
+}
+
+// newCIDRTrie builds a trie over nets with overlapping and adjacent networks
+// merged. A merged network keeps a trie of the networks it was made of, so
+// matches are still attributed to a network of nets.
+func newCIDRTrie(nets []*net.IPNet) *cidrTrie {
+	t := &cidrTrie{v4: &trieNode{}, v6: &trieNode{}}
+	for _, merged := range mergeCIDRsWithRules(nets) {
+		if len(merged.rules) == 1 {
+			t.insert(merged.rules[0])
+		} else if node := t.insert(merged.net); node != nil {
+			node.rules = newRuleTrie(merged.rules)
+		}
+		t.networks++
+	}
+	return t
+}
+
+// newRuleTrie builds a trie containing every network in nets unmerged
+func newRuleTrie(nets []*net.IPNet) *cidrTrie {
+	t := &cidrTrie{v4: &trieNode{}, v6: &trieNode{}}
+	for _, ipnet := range nets {
+		t.insert(ipnet)
+	}
+	return t
+}
+
+// insert adds ipnet to the trie and returns its node, or nil when ipnet is
+// not a valid network. Networks nested inside an already inserted one are
+// still stored.
+func (t *cidrTrie) insert(ipnet *net.IPNet) *trieNode {
+	ones, bits := ipnet.Mask.Size()
+	node, ip := t.v6, ipnet.IP.To16()
+	switch {
+	case bits == 8*net.IPv4len:
+		node, ip = t.v4, ipnet.IP.To4()
+	case ones >= 96 && ipnet.IP.To4() != nil:
+		// An IPv4-mapped network such as ::ffff:10.0.0.0/104 contains the
+		// IPv4 addresses of 10.0.0.0/8
+		node, ip, ones = t.v4, ipnet.IP.To4(), ones-96
+	}
+	if ip == nil {
+		return nil
+	}
+
+	for i := 0; i < ones; i++ {
+		bit := ip[i/8] >> (7 - uint(i%8)) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &trieNode{}
+		}
+		node = node.children[bit]
+	}
+	if node.net == nil {
+		node.net = ipnet
+	}
+	return node
+}
+
+// match returns the broadest indexed network containing ip, if any. IPv4
+// and IPv4-mapped IPv6 addresses match IPv4 networks, like
+// net.IPNet.Contains. Within a merged network the broadest network it was
+// made of is returned.
+func (t *cidrTrie) match(ip net.IP) (*net.IPNet, bool) {
+	node := t.v6
+	if ip4 := ip.To4(); ip4 != nil {
+		node, ip = t.v4, ip4
+	} else if ip = ip.To16(); ip == nil {
+		return nil, false
+	}
+
+	for i := 0; node != nil; i++ {
+		if node.net != nil {
+			if node.rules != nil {
+				return node.rules.match(ip)
+			}
+			return node.net, true
+		}
+		if i == 8*len(ip) {
+			break
+		}
+		node = node.children[ip[i/8]>>(7-uint(i%8))&1]
+	}
+	return nil, false
+}
@@ -0,0 +1,122 @@
+package traefik_plugin_blockip
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestCIDRTrieMatchesLinearScan(t *testing.T) {
+	cidrs := append(sparseCIDRs(500), "172.16.0.0/12", "172.16.5.0/24", "192.0.2.0/25", "192.0.2.128/25",
+		"0.0.0.0/0", "2001:db8::/32", "2001:db8:ffff::/48", "::ffff:198.51.100.0/120")
+
+	tests := []struct {
+		ip       string
+		testName string
+	}{
+		{"10.0.7.1", "Sparse /24"},
+		{"10.0.8.1", "Gap between sparse networks"},
+		{"172.20.1.1", "Inside /12"},
+		{"172.16.5.9", "Nested network"},
+		{"192.0.2.200", "Upper half /25"},
+		{"192.0.2.10", "Lower half /25"},
+		{"2001:db8:ffff::1", "IPv6 nested"},
+		{"2001:db9::1", "IPv6 outside"},
+		{"198.51.100.7", "IPv4 in mapped network"},
+		{"::ffff:10.0.7.1", "Mapped IPv4 address"},
+		{"fe80::1", "Link-local IPv6"},
+	}
+
+	for _, withCatchAll := range []bool{false, true} {
+		nets := make([]*net.IPNet, 0, len(cidrs))
+		for _, cidr := range cidrs {
+			if cidr == "0.0.0.0/0" && !withCatchAll {
+				continue
+			}
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatalf("Invalid test CIDR %s: %v", cidr, err)
+			}
+			nets = append(nets, ipnet)
+		}
+		trie := newCIDRTrie(nets)
+
+		for _, test := range tests {
+			ip := net.ParseIP(test.ip)
+			expected := false
+			for _, ipnet := range nets {
+				if ipnet.Contains(ip) {
+					expected = true
+					break
+				}
+			}
+
+			ipnet, ok := trie.match(ip)
+			if ok != expected {
+				t.Errorf("%s (catch-all %v): expected match %v, got %v", test.testName, withCatchAll, expected, ok)
+			}
+			if ok && !ipnet.Contains(ip) {
+				t.Errorf("%s: matched network %s does not contain %s", test.testName, ipnet, ip)
+			}
+			if ok && !containsNet(nets, ipnet) {
+				t.Errorf("%s: matched network %s is not one of the indexed networks", test.testName, ipnet)
+			}
+		}
+	}
+}
+
+func TestCIDRTrieBlocksAndWhitelists(t *testing.T) {
+	lookup := newIPLookupService(0, 0, 0, 0)
+	for _, cidr := range []string{"10.0.0.0/8", "2001:db8::/32"} {
+		_, ipnet, _ := net.ParseCIDR(cidr)
+		lookup.blockedNets = append(lookup.blockedNets, ipnet)
+	}
+	_, whitelisted, _ := net.ParseCIDR("10.1.0.0/16")
+	lookup.whitelistNets = append(lookup.whitelistNets, whitelisted)
+	lookup.buildIndex()
+
+	if rule, ok := lookup.matchBlocked("10.2.3.4"); !ok || rule != "10.0.0.0/8" {
+		t.Errorf("Expected 10.2.3.4 to match 10.0.0.0/8, got %q %v", rule, ok)
+	}
+	if _, ok := lookup.matchBlocked("2001:db8::5"); !ok {
+		t.Error("Expected 2001:db8::5 to be blocked")
+	}
+	if _, ok := lookup.matchBlocked("192.0.2.1"); ok {
+		t.Error("Expected 192.0.2.1 not to be blocked")
+	}
+	if !lookup.isWhitelisted("10.1.2.3") || lookup.isWhitelisted("10.2.3.4") {
+		t.Error("Expected only 10.1.0.0/16 to be whitelisted")
+	}
+}
+
+// largeCIDRLookup returns a lookup service with n blocked /24 networks
+func largeCIDRLookup(b *testing.B, n int) *ipLookupService {
+	lookup := newIPLookupService(0, 0, 0, 0)
+	for i := 0; i < n; i++ {
+		_, ipnet, err := net.ParseCIDR(fmt.Sprintf("%d.%d.%d.0/24", 1+i/65536, i/256%256, i%256))
+		if err != nil {
+			b.Fatalf("Invalid benchmark CIDR: %v", err)
+		}
+		lookup.blockedNets = append(lookup.blockedNets, ipnet)
+	}
+	return lookup
+}
+
+func BenchmarkCIDRLookup10kLinear(b *testing.B) {
+	lookup := largeCIDRLookup(b, 10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookup.matchBlocked("203.0.113.50")
+	}
+}
+
+func BenchmarkCIDRLookup10kTrie(b *testing.B) {
+	lookup := largeCIDRLookup(b, 10000)
+	lookup.buildIndex()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookup.matchBlocked("203.0.113.50")
+	}
+}
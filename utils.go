@@ -1,8 +1,14 @@
 package traefik_plugin_blockip
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/intaacopilot/traefik-plugin-blockip/ipsanitize"
 )
 
 // IPUtils provides utility functions for IP operations
@@ -49,10 +55,64 @@ func (u *IPUtils) IsIPv6(ip string) bool {
 func (u *IPUtils) ExtractIPFromString(s string) string {
 	ips := strings.Split(s, ",")
 	for _, ip := range ips {
-		ip = strings.TrimSpace(ip)
+		ip = ipsanitize.Clean(ip)
 		if u.ValidateIP(ip) {
 			return ip
 		}
 	}
 	return ""
-}
\ No newline at end of file
+}
+
+// resolveDuration returns the parsed duration string when set, otherwise
+// the integer value in the given unit
+func resolveDuration(field string, value string, fallback int, unit time.Duration) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Duration(fallback) * unit, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, NewBlockIPError(ErrCodeParseError, fmt.Sprintf("invalid %s %q", field, value), err)
+	}
+	if d < 0 {
+		return 0, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("negative %s %q", field, value), nil)
+	}
+
+	return d, nil
+}
+
+// normalizeBody validates that a response body is UTF-8, rejecting it when
+// strict and replacing invalid sequences otherwise. CRLF line endings are
+// converted to LF when normalizeLineEndings is set.
+func normalizeBody(field string, body string, strict bool, normalizeLineEndings bool) (string, error) {
+	if !utf8.ValidString(body) {
+		if strict {
+			return "", NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("%s is not valid UTF-8", field), nil)
+		}
+		body = strings.ToValidUTF8(body, "�")
+	}
+
+	if normalizeLineEndings {
+		body = strings.ReplaceAll(body, "\r\n", "\n")
+	}
+	return body, nil
+}
+
+// isCatchAll reports whether ipnet covers its whole address family
+func isCatchAll(ipnet *net.IPNet) bool {
+	ones, _ := ipnet.Mask.Size()
+	return ones == 0
+}
+
+// catchAllError is returned for a /0 block entry when catch-all CIDRs are rejected
+func catchAllError(ipnet *net.IPNet) error {
+	return NewBlockIPError(ErrCodeInvalidCIDR,
+		fmt.Sprintf("catch-all CIDR %s would block every client; remove it or disable rejectCatchAllCIDR", ipnet), nil)
+}
+
+// isCatchAllError reports whether err rejects a catch-all CIDR
+func isCatchAllError(err error) bool {
+	var blockErr *BlockIPError
+	return errors.As(err, &blockErr) && blockErr.Code == ErrCodeInvalidCIDR
+}
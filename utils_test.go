@@ -0,0 +1,154 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResolveDuration(t *testing.T) {
+	tests := []struct {
+		value    string
+		fallback int
+		expected time.Duration
+		valid    bool
+		testName string
+	}{
+		{"", 300, 300 * time.Second, true, "Integer fallback"},
+		{"5m", 300, 5 * time.Minute, true, "Minutes"},
+		{"90s", 0, 90 * time.Second, true, "Seconds"},
+		{"1h30m", 0, 90 * time.Minute, true, "Compound"},
+		{"250ms", 0, 250 * time.Millisecond, true, "Milliseconds"},
+		{" 2m ", 0, 2 * time.Minute, true, "Surrounding whitespace"},
+		{"0s", 300, 0, true, "Zero overrides fallback"},
+		{"5", 0, 0, false, "Missing unit"},
+		{"five minutes", 0, 0, false, "Garbage"},
+		{"-1m", 0, 0, false, "Negative"},
+	}
+
+	for _, test := range tests {
+		result, err := resolveDuration("cacheTTLDuration", test.value, test.fallback, time.Second)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+			continue
+		}
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: expected error for %q", test.testName, test.value)
+			}
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.testName, test.expected, result)
+		}
+	}
+}
+
+func TestCacheTTLDurationPrecedence(t *testing.T) {
+	config := CreateConfig()
+	config.CacheTTL = 300
+	config.CacheTTLDuration = "2m"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	if ttl := handler.(*BlockIP).lookup.cache.ttl; ttl != 2*time.Minute {
+		t.Errorf("Expected cache TTL of 2m, got %v", ttl)
+	}
+}
+
+func TestInvalidCacheTTLDuration(t *testing.T) {
+	config := CreateConfig()
+	config.CacheTTLDuration = "soon"
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+
+	if err == nil {
+		t.Fatal("Expected error for invalid cache TTL duration")
+	}
+}
+
+func TestNormalizeBody(t *testing.T) {
+	tests := []struct {
+		body                 string
+		strict               bool
+		normalizeLineEndings bool
+		expected             string
+		expectError          bool
+		testName             string
+	}{
+		{"Access Denied", true, false, "Access Denied", false, "Valid UTF-8"},
+		{"Zugriff verweigert ✋", true, false, "Zugriff verweigert ✋", false, "Valid multibyte UTF-8"},
+		{"Denied \xff\xfe", true, false, "", true, "Invalid UTF-8 rejected when strict"},
+		{"Denied \xff\xfe", false, false, "Denied �", false, "Invalid UTF-8 sanitized"},
+		{"line one\r\nline two\r\n", false, true, "line one\nline two\n", false, "CRLF normalized"},
+		{"line one\r\nline two", false, false, "line one\r\nline two", false, "CRLF kept without normalization"},
+		{"bad \xc3\r\nend", false, true, "bad �\nend", false, "Sanitized and normalized"},
+	}
+
+	for _, test := range tests {
+		body, err := normalizeBody("message", test.body, test.strict, test.normalizeLineEndings)
+
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", test.testName)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.testName, err)
+			continue
+		}
+		if body != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.testName, test.expected, body)
+		}
+	}
+}
+
+func TestBlockMessageEncoding(t *testing.T) {
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.Message = "Blocked\r\n\xffContact support\r\n"
+	config.NormalizeLineEndings = true
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.1.100:12345"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if body := w.Body.String(); body != "Blocked\n�Contact support\n" {
+		t.Errorf("Expected normalized body, got %q", body)
+	}
+
+	config.StrictBodyEncoding = true
+	_, err = New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err == nil {
+		t.Error("Expected error for invalid UTF-8 message in strict mode")
+	}
+
+	config.Message = "Access Denied"
+	config.ListGroups = []ListGroup{{Name: "spam", BlockedIPs: []string{"10.0.0.1"}, Message: "Spam \xff"}}
+	_, err = New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err == nil {
+		t.Error("Expected error for invalid UTF-8 list group message in strict mode")
+	}
+}
@@ -0,0 +1,189 @@
+package traefik_plugin_blockip
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookQueueSize bounds the events waiting to be delivered; further
+// events are dropped so requests never wait on the webhook
+const webhookQueueSize = 1024
+
+// webhookTimeout bounds each webhook delivery
+const webhookTimeout = 5 * time.Second
+
+// webhookSignatureHeader carries the hex HMAC-SHA256 of the payload
+const webhookSignatureHeader = "X-Signature"
+
+// webhookEvent describes a blocked request
+type webhookEvent struct {
+	Time     string `json:"time"`
+	ClientIP string `json:"client_ip"`
+	Method   string `json:"method"`
+	Host     string `json:"host"`
+	Path     string `json:"path"`
+	Rule     string `json:"rule,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Country  string `json:"country,omitempty"`
+	DryRun   bool   `json:"dry_run,omitempty"`
+}
+
+// webhookClient posts block events as JSON to a webhook URL, one object per
+// event or, when batchSize is above one, as arrays of up to batchSize events
+type webhookClient struct {
+	url       string
+	secret    []byte
+	client    *http.Client
+	queue     chan webhookEvent
+	batchSize int
+}
+
+// newWebhookClient validates rawURL and returns a client posting to it
+func newWebhookClient(rawURL string, secret string, batchSize int) (*webhookClient, error) {
+	if batchSize < 0 || batchSize > webhookQueueSize {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("webhookBatchSize must be between 0 and %d", webhookQueueSize), nil)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, NewBlockIPError(ErrCodeInvalidConfig, fmt.Sprintf("invalid webhookURL %q", rawURL), err)
+	}
+	return &webhookClient{
+		url:       rawURL,
+		secret:    []byte(secret),
+		client:    &http.Client{Timeout: webhookTimeout},
+		queue:     make(chan webhookEvent, webhookQueueSize),
+		batchSize: batchSize,
+	}, nil
+}
+
+// enqueue queues an event for delivery, dropping it when the queue is full
+func (c *webhookClient) enqueue(event webhookEvent) {
+	select {
+	case c.queue <- event:
+	default:
+	}
+}
+
+// sign returns the hex HMAC-SHA256 of payload keyed with the secret
+func (c *webhookClient) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// send posts payload to the webhook URL
+func (c *webhookClient) send(ctx context.Context, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(c.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, c.sign(body))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notifyWebhook queues a block event for req
+func (b *BlockIP) notifyWebhook(req *http.Request, clientIP string, d decision) {
+	event := webhookEvent{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		ClientIP: clientIP,
+		Method:   req.Method,
+		Host:     req.Host,
+		Path:     req.URL.Path,
+		Rule:     d.rule,
+		Source:   b.ruleSource(d.rule),
+		DryRun:   b.dryRun || b.passthrough,
+	}
+	if d.geo != nil {
+		event.Country = d.geo.Country
+	}
+	b.webhook.enqueue(event)
+}
+
+// deliverWebhook sends events one by one or in batches
+func (b *BlockIP) deliverWebhook(ctx context.Context, events []webhookEvent) {
+	if b.webhook.batchSize <= 1 {
+		for _, event := range events {
+			if err := b.webhook.send(ctx, event); err != nil {
+				b.logger.Warn("[%s] Error delivering webhook event for IP %s: %v", b.name, event.ClientIP, err)
+			}
+		}
+		return
+	}
+
+	for len(events) > 0 {
+		n := min(len(events), b.webhook.batchSize)
+		if err := b.webhook.send(ctx, events[:n]); err != nil {
+			b.logger.Warn("[%s] Error delivering batch of %d webhook events: %v", b.name, n, err)
+		}
+		events = events[n:]
+	}
+}
+
+// runWebhook delivers queued events, flushing a batch when it is full and
+// every flushInterval, until ctx is done. Pending events are flushed on
+// shutdown.
+func (b *BlockIP) runWebhook(ctx context.Context, flushInterval time.Duration) {
+	var flushTick <-chan time.Time
+	if flushInterval > 0 && b.webhook.batchSize > 1 {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		flushTick = ticker.C
+	}
+
+	var pending []webhookEvent
+	for {
+		select {
+		case <-ctx.Done():
+			for drained := false; !drained; {
+				select {
+				case event := <-b.webhook.queue:
+					pending = append(pending, event)
+				default:
+					drained = true
+				}
+			}
+			if len(pending) > 0 {
+				flushCtx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+				b.deliverWebhook(flushCtx, pending)
+				cancel()
+			}
+			return
+		case event := <-b.webhook.queue:
+			pending = append(pending, event)
+			if len(pending) >= b.webhook.batchSize {
+				b.deliverWebhook(ctx, pending)
+				pending = nil
+			}
+		case <-flushTick:
+			if len(pending) > 0 {
+				b.deliverWebhook(ctx, pending)
+				pending = nil
+			}
+		}
+	}
+}
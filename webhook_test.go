@@ -0,0 +1,227 @@
+package traefik_plugin_blockip
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// webhookDelivery is a request received by a test webhook server
+type webhookDelivery struct {
+	body      []byte
+	signature string
+}
+
+// listenWebhook starts a webhook server collecting received deliveries
+func listenWebhook(t *testing.T) (string, <-chan webhookDelivery) {
+	deliveries := make(chan webhookDelivery, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- webhookDelivery{body: body, signature: r.Header.Get("X-Signature")}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, deliveries
+}
+
+// waitForDelivery returns the next webhook delivery
+func waitForDelivery(t *testing.T, deliveries <-chan webhookDelivery) webhookDelivery {
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for webhook delivery")
+		return webhookDelivery{}
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	url, deliveries := listenWebhook(t)
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WebhookURL = url
+	config.WebhookSecret = "s3cret"
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	requestFrom(handler, "10.0.0.1:12345")
+	if code := requestPath(handler, "192.168.1.100:12345", "/login"); code != http.StatusForbidden {
+		t.Fatalf("Expected blocked request, got %d", code)
+	}
+
+	delivery := waitForDelivery(t, deliveries)
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(delivery.body)
+	if expected := hex.EncodeToString(mac.Sum(nil)); delivery.signature != expected {
+		t.Errorf("Expected signature %s, got %q", expected, delivery.signature)
+	}
+
+	var event webhookEvent
+	if err := json.Unmarshal(delivery.body, &event); err != nil {
+		t.Fatalf("Failed to decode payload %s: %v", delivery.body, err)
+	}
+	if event.ClientIP != "192.168.1.100" || event.Path != "/login" || event.Rule != "192.168.1.100" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	select {
+	case extra := <-deliveries:
+		t.Errorf("Expected no delivery for allowed requests, got %s", extra.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookWithoutSecret(t *testing.T) {
+	url, deliveries := listenWebhook(t)
+
+	config := CreateConfig()
+	config.BlockedIPs = []string{"192.168.1.100"}
+	config.WebhookURL = url
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	requestFrom(handler, "192.168.1.100:12345")
+	if delivery := waitForDelivery(t, deliveries); delivery.signature != "" {
+		t.Errorf("Expected no signature without a secret, got %q", delivery.signature)
+	}
+}
+
+func TestInvalidWebhookURL(t *testing.T) {
+	for _, rawURL := range []string{"ftp://example.com/hook", "example.com/hook", "http://"} {
+		config := CreateConfig()
+		config.WebhookURL = rawURL
+
+		_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err == nil {
+			t.Errorf("Expected error for webhookURL %q", rawURL)
+		}
+	}
+}
+
+// decodeBatch decodes a batched webhook payload
+func decodeBatch(t *testing.T, delivery webhookDelivery) []webhookEvent {
+	var events []webhookEvent
+	if err := json.Unmarshal(delivery.body, &events); err != nil {
+		t.Fatalf("Failed to decode batch %s: %v", delivery.body, err)
+	}
+	return events
+}
+
+func TestWebhookBatching(t *testing.T) {
+	tests := []struct {
+		batchSize     int
+		flushInterval string
+		stop          bool
+		testName      string
+	}{
+		{3, "1h", false, "Flush when the batch is full"},
+		{10, "50ms", false, "Flush on interval"},
+		{10, "0s", true, "Flush on shutdown"},
+	}
+
+	for _, test := range tests {
+		url, deliveries := listenWebhook(t)
+
+		config := CreateConfig()
+		config.BlockedCIDRs = []string{"192.168.1.0/24"}
+		config.WebhookURL = url
+		config.WebhookSecret = "s3cret"
+		config.WebhookBatchSize = test.batchSize
+		config.WebhookFlushIntervalDuration = test.flushInterval
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), config, "blockip-test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", test.testName, err)
+		}
+
+		requestFrom(handler, "192.168.1.1:12345")
+		requestFrom(handler, "192.168.1.2:12345")
+		requestFrom(handler, "192.168.1.3:12345")
+		if test.stop {
+			handler.(*BlockIP).Stop()
+		}
+
+		delivery := waitForDelivery(t, deliveries)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(delivery.body)
+		if expected := hex.EncodeToString(mac.Sum(nil)); delivery.signature != expected {
+			t.Errorf("%s: expected signature %s, got %q", test.testName, expected, delivery.signature)
+		}
+
+		events := decodeBatch(t, delivery)
+		for len(events) < 3 {
+			events = append(events, decodeBatch(t, waitForDelivery(t, deliveries))...)
+		}
+		if len(events) != 3 || events[0].ClientIP != "192.168.1.1" || events[2].ClientIP != "192.168.1.3" {
+			t.Errorf("%s: unexpected events: %+v", test.testName, events)
+		}
+		handler.(*BlockIP).Stop()
+	}
+}
+
+func TestWebhookBatchFull(t *testing.T) {
+	url, deliveries := listenWebhook(t)
+
+	config := CreateConfig()
+	config.BlockedCIDRs = []string{"192.168.1.0/24"}
+	config.WebhookURL = url
+	config.WebhookBatchSize = 2
+	config.WebhookFlushInterval = 0
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	defer handler.(*BlockIP).Stop()
+
+	for i := 1; i <= 3; i++ {
+		requestFrom(handler, fmt.Sprintf("192.168.1.%d:12345", i))
+	}
+
+	if events := decodeBatch(t, waitForDelivery(t, deliveries)); len(events) != 2 {
+		t.Errorf("Expected a batch of 2 events, got %d", len(events))
+	}
+	select {
+	case delivery := <-deliveries:
+		t.Errorf("Expected the partial batch to wait, got %s", delivery.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestInvalidWebhookBatchSize(t *testing.T) {
+	config := CreateConfig()
+	config.WebhookURL = "http://example.com/hook"
+	config.WebhookBatchSize = -1
+
+	_, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), config, "blockip-test")
+	if err == nil {
+		t.Error("Expected error for negative webhookBatchSize")
+	}
+}